@@ -0,0 +1,97 @@
+// Command keys manages the JWT signing keyring used when the server runs
+// with -jwt-keys-dir.
+//
+//	go run ./cmd/keys -dir=keys generate -alg=EdDSA   # announce a new passive key
+//	go run ./cmd/keys -dir=keys rotate -alg=EdDSA     # make the newest passive (or a new) key active
+//	go run ./cmd/keys -dir=keys retire -kid=<kid>     # stop trusting an old key
+//	go run ./cmd/keys -dir=keys list
+//
+// Send the server SIGHUP (or restart it) to pick up changes.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+)
+
+func main() {
+	var dir string
+	flag.StringVar(&dir, "dir", "keys", "Directory holding the keyring")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: keys [-dir=keys] generate|rotate|retire|list [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(dir, flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keys: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, command string, args []string) error {
+	cmd := flag.NewFlagSet(command, flag.ExitOnError)
+	alg := cmd.String("alg", auth.AlgorithmEdDSA, "Key algorithm: RS256 or EdDSA")
+	kid := cmd.String("kid", "", "Key ID to retire")
+	cmd.Parse(args)
+
+	keyring, err := auth.LoadKeyring(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		keyring = auth.NewKeyring(dir)
+	} else if err != nil {
+		return err
+	}
+
+	switch command {
+	case "generate":
+		key, err := auth.GenerateKey(*alg)
+		if err != nil {
+			return err
+		}
+		keyring.Add(key)
+		fmt.Printf("generated passive %s key %s\n", key.Algorithm, key.ID)
+
+	case "rotate":
+		key, err := keyring.Rotate(*alg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s key %s is now active\n", key.Algorithm, key.ID)
+		fmt.Printf("retire the previous key once its tokens have expired (%s)\n", auth.TokenTTL)
+
+	case "retire":
+		if *kid == "" {
+			return errors.New("retire requires -kid")
+		}
+		err := keyring.Retire(*kid)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("retired key %s\n", *kid)
+
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KID\tALG\tSTATUS\tCREATED")
+		for _, key := range keyring.Keys() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.ID, key.Algorithm, key.Status, key.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	return keyring.Save()
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/LikhithMar14/workout-tracker/internal/app"
@@ -21,6 +25,29 @@ func main() {
         dbname   string
         dbPort   int
         sslmode  string
+
+        jwtSecret  string
+        jwtKeysDir string
+
+        smtpHost     string
+        smtpPort     int
+        smtpUsername string
+        smtpPassword string
+        smtpSender   string
+        mailDir      string
+
+        oidcConfigFile string
+
+        passwordMinLength int
+        bcryptCost        int
+
+        trainingGapDays int
+
+        webhookWorkers int
+
+        jobWorkers int
+
+        legacyWeightUnit string
     )
 
     flag.IntVar(&port, "port", 8080, "Go backend server port")
@@ -31,6 +58,29 @@ func main() {
     flag.IntVar(&dbPort, "dbport", 5432, "Database port")
     flag.StringVar(&sslmode, "sslmode", "disable", "SSL mode for database connection")
 
+    flag.StringVar(&jwtSecret, "jwt-secret", "mysecret", "HMAC secret for HS256 tokens (ignored when -jwt-keys-dir is set)")
+    flag.StringVar(&jwtKeysDir, "jwt-keys-dir", "", "Keyring directory for RS256/EdDSA tokens (see cmd/keys)")
+
+    flag.StringVar(&smtpHost, "smtp-host", "", "SMTP host (leave empty to write emails to -mail-dir)")
+    flag.IntVar(&smtpPort, "smtp-port", 587, "SMTP port")
+    flag.StringVar(&smtpUsername, "smtp-username", "", "SMTP username")
+    flag.StringVar(&smtpPassword, "smtp-password", "", "SMTP password")
+    flag.StringVar(&smtpSender, "smtp-sender", "Workout Tracker <no-reply@workout-tracker.local>", "SMTP sender")
+    flag.StringVar(&mailDir, "mail-dir", "mail", "Directory emails are written to when no SMTP host is set")
+
+    flag.StringVar(&oidcConfigFile, "oidc-config", "", "JSON file listing OpenID Connect providers for external login")
+
+    flag.IntVar(&passwordMinLength, "password-min-length", 8, "Minimum number of characters in new passwords")
+    flag.IntVar(&bcryptCost, "bcrypt-cost", 12, "bcrypt cost for password hashes (existing hashes are upgraded at login)")
+
+    flag.IntVar(&trainingGapDays, "training-gap-days", 7, "Days without a workout before users are reminded (0 disables reminders)")
+
+    flag.IntVar(&webhookWorkers, "webhook-workers", 4, "Number of concurrent webhook deliveries")
+
+    flag.IntVar(&jobWorkers, "job-workers", 4, "Number of background jobs run concurrently")
+
+    flag.StringVar(&legacyWeightUnit, "legacy-weight-unit", "kg", "Unit (kg or lb) of weights logged before units were tracked, used once when migrating them")
+
     flag.Parse()
 
     cfg := pkg.Config{
@@ -41,6 +91,29 @@ func main() {
         DBPort:     dbPort,
         DBSSLMode:  sslmode,
         ServerPort: port,
+
+        JWTSecret:  jwtSecret,
+        JWTKeysDir: jwtKeysDir,
+
+        SMTPHost:     smtpHost,
+        SMTPPort:     smtpPort,
+        SMTPUsername: smtpUsername,
+        SMTPPassword: smtpPassword,
+        SMTPSender:   smtpSender,
+        MailDir:      mailDir,
+
+        OIDCConfigFile: oidcConfigFile,
+
+        PasswordMinLength: passwordMinLength,
+        BcryptCost:        bcryptCost,
+
+        TrainingGapDays: trainingGapDays,
+
+        WebhookWorkers: webhookWorkers,
+
+        JobWorkers: jobWorkers,
+
+        LegacyWeightUnit: legacyWeightUnit,
     }
 
     app, err := app.NewApplication(cfg)
@@ -59,6 +132,27 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Reload the signing keyring on SIGHUP so rotations don't need a restart
+	if app.Keyring != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := app.Keyring.Reload(); err != nil {
+					app.Logger.Printf("ERROR: reloading keyring: %v", err)
+					continue
+				}
+				app.Logger.Printf("Reloaded signing keyring")
+			}
+		}()
+	}
+
+	// Run queued and scheduled background jobs
+	go app.JobRunner.Run(context.Background())
+
+	// Send queued webhook deliveries in the background
+	go app.WebhookDeliverer.Run(context.Background(), 5*time.Second)
+
 	app.Logger.Printf("Starting server on port %d...\n", port)
 
 
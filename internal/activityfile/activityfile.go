@@ -0,0 +1,172 @@
+// Package activityfile reads the GPX, TCX and FIT files exported by GPS
+// watches and bike computers.
+package activityfile
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unrecognized activity file, expected GPX, TCX or FIT")
+	ErrNoActivity    = errors.New("activity file has no timed activity")
+)
+
+// Activity is the recording of a single activity. Sport is one of the
+// store activities, or empty when the file doesn't say or uses a sport
+// the tracker doesn't know.
+type Activity struct {
+	Name            string
+	Sport           string
+	StartTime       time.Time
+	DurationSeconds int
+	DistanceKm      float64
+	ElevationGainM  *float64
+	Calories        *int
+	AvgHeartRate    *int
+	MaxHeartRate    *int
+	HeartRate       []Sample
+	Laps            []Lap
+}
+
+// Sample is a heart rate reading.
+type Sample struct {
+	Time time.Time
+	BPM  int
+}
+
+// Lap is a lap or auto-split recorded by the device.
+type Lap struct {
+	StartTime       time.Time
+	DurationSeconds int
+	DistanceKm      float64
+	ElevationGainM  *float64
+	AvgHeartRate    *int
+}
+
+// Parse reads an activity file, telling the format from its contents.
+func Parse(data []byte) (*Activity, error) {
+	var activity *Activity
+	var err error
+	switch {
+	case len(data) >= 12 && string(data[8:12]) == ".FIT":
+		activity, err = parseFIT(data)
+	case bytes.Contains(data, []byte("<TrainingCenterDatabase")):
+		activity, err = parseTCX(data)
+	case bytes.Contains(data, []byte("<gpx")):
+		activity, err = parseGPX(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return activity, activity.finish()
+}
+
+// finish fills in what the file left to be derived and checks there is
+// something to import.
+func (a *Activity) finish() error {
+	if a.StartTime.IsZero() || a.DurationSeconds <= 0 {
+		return ErrNoActivity
+	}
+
+	if a.DistanceKm == 0 {
+		for _, lap := range a.Laps {
+			a.DistanceKm += lap.DistanceKm
+		}
+	}
+
+	if len(a.HeartRate) > 0 && (a.AvgHeartRate == nil || a.MaxHeartRate == nil) {
+		sum, max := 0, 0
+		for _, sample := range a.HeartRate {
+			sum += sample.BPM
+			if sample.BPM > max {
+				max = sample.BPM
+			}
+		}
+		avg := int(math.Round(float64(sum) / float64(len(a.HeartRate))))
+		if a.AvgHeartRate == nil {
+			a.AvgHeartRate = &avg
+		}
+		if a.MaxHeartRate == nil {
+			a.MaxHeartRate = &max
+		}
+	}
+	return nil
+}
+
+// sportFromName maps the free-form sport names of GPX and TCX files to a
+// store activity.
+func sportFromName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "run"):
+		return store.ActivityRun
+	case strings.Contains(name, "bik"), strings.Contains(name, "cycl"), strings.Contains(name, "ride"):
+		return store.ActivityRide
+	case strings.Contains(name, "row"):
+		return store.ActivityRow
+	case strings.Contains(name, "swim"):
+		return store.ActivitySwim
+	case strings.Contains(name, "walk"):
+		return store.ActivityWalk
+	case strings.Contains(name, "hik"):
+		return store.ActivityHike
+	}
+	return ""
+}
+
+// track accumulates the distance and climb between consecutive points.
+type track struct {
+	distanceKm float64
+	climbM     float64
+	hasClimb   bool
+	lastLat    *float64
+	lastLon    float64
+	lastEle    *float64
+}
+
+func (t *track) addPosition(lat, lon float64) {
+	if t.lastLat != nil {
+		t.distanceKm += haversineKm(*t.lastLat, t.lastLon, lat, lon)
+	}
+	t.lastLat, t.lastLon = &lat, lon
+}
+
+func (t *track) addElevation(ele float64) {
+	if t.lastEle != nil && ele > *t.lastEle {
+		t.climbM += ele - *t.lastEle
+	}
+	t.lastEle = &ele
+	t.hasClimb = true
+}
+
+func (t *track) elevationGain() *float64 {
+	if !t.hasClimb {
+		return nil
+	}
+	climb := math.Round(t.climbM*10) / 10
+	return &climb
+}
+
+const earthRadiusKm = 6371.0088
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func intPtr(i int) *int {
+	return &i
+}
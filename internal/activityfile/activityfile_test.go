@@ -0,0 +1,215 @@
+package activityfile
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <trk>
+    <name>Morning Run</name>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="51.5000" lon="-0.1000"><ele>10</ele><time>2024-03-01T07:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="51.5090" lon="-0.1000"><ele>15</ele><time>2024-03-01T07:05:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>150</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="51.5180" lon="-0.1000"><ele>12</ele><time>2024-03-01T07:10:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>165</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2024-03-02T08:00:00Z</Id>
+      <Lap StartTime="2024-03-02T08:00:00Z">
+        <TotalTimeSeconds>600</TotalTimeSeconds>
+        <DistanceMeters>5000</DistanceMeters>
+        <Calories>120</Calories>
+        <AverageHeartRateBpm><Value>130</Value></AverageHeartRateBpm>
+        <MaximumHeartRateBpm><Value>145</Value></MaximumHeartRateBpm>
+        <Track>
+          <Trackpoint><Time>2024-03-02T08:00:00Z</Time><AltitudeMeters>100</AltitudeMeters><HeartRateBpm><Value>125</Value></HeartRateBpm></Trackpoint>
+          <Trackpoint><Time>2024-03-02T08:10:00Z</Time><AltitudeMeters>130</AltitudeMeters><HeartRateBpm><Value>135</Value></HeartRateBpm></Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2024-03-02T08:10:00Z">
+        <TotalTimeSeconds>540</TotalTimeSeconds>
+        <DistanceMeters>5000</DistanceMeters>
+        <Calories>110</Calories>
+        <AverageHeartRateBpm><Value>140</Value></AverageHeartRateBpm>
+        <MaximumHeartRateBpm><Value>160</Value></MaximumHeartRateBpm>
+        <Track>
+          <Trackpoint><Time>2024-03-02T08:19:00Z</Time><AltitudeMeters>120</AltitudeMeters><HeartRateBpm><Value>150</Value></HeartRateBpm></Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestParseGPX(t *testing.T) {
+	activity, err := Parse([]byte(testGPX))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Morning Run", activity.Name)
+	assert.Equal(t, store.ActivityRun, activity.Sport)
+	assert.Equal(t, time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), activity.StartTime)
+	assert.Equal(t, 600, activity.DurationSeconds)
+	// Two legs of 0.009° of latitude, about a kilometre each
+	assert.InDelta(t, 2.0015, activity.DistanceKm, 0.001)
+	assert.Equal(t, 5.0, *activity.ElevationGainM)
+	assert.Equal(t, 145, *activity.AvgHeartRate)
+	assert.Equal(t, 165, *activity.MaxHeartRate)
+	assert.Len(t, activity.HeartRate, 3)
+	assert.Empty(t, activity.Laps)
+}
+
+func TestParseTCX(t *testing.T) {
+	activity, err := Parse([]byte(testTCX))
+	require.NoError(t, err)
+
+	assert.Equal(t, store.ActivityRide, activity.Sport)
+	assert.Equal(t, time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC), activity.StartTime)
+	assert.Equal(t, 1140, activity.DurationSeconds)
+	assert.Equal(t, 10.0, activity.DistanceKm)
+	assert.Equal(t, 30.0, *activity.ElevationGainM)
+	assert.Equal(t, 230, *activity.Calories)
+	assert.Equal(t, 160, *activity.MaxHeartRate)
+	assert.Equal(t, 137, *activity.AvgHeartRate)
+
+	require.Len(t, activity.Laps, 2)
+	assert.Equal(t, 540, activity.Laps[1].DurationSeconds)
+	assert.Equal(t, 5.0, activity.Laps[1].DistanceKm)
+	assert.Equal(t, 140, *activity.Laps[1].AvgHeartRate)
+	assert.Equal(t, 30.0, *activity.Laps[0].ElevationGainM)
+	assert.Equal(t, 0.0, *activity.Laps[1].ElevationGainM)
+}
+
+// fitBuilder writes little-endian FIT files for tests.
+type fitBuilder struct {
+	records []byte
+}
+
+type fitTestField struct {
+	num   byte
+	size  byte
+	value uint32
+}
+
+func (b *fitBuilder) define(local byte, global uint16, fields ...fitTestField) {
+	b.records = append(b.records, 0x40|local, 0, 0)
+	b.records = binary.LittleEndian.AppendUint16(b.records, global)
+	b.records = append(b.records, byte(len(fields)))
+	for _, field := range fields {
+		b.records = append(b.records, field.num, field.size, 0x84)
+	}
+}
+
+func (b *fitBuilder) message(local byte, global uint16, fields ...fitTestField) {
+	b.define(local, global, fields...)
+	b.records = append(b.records, local)
+	b.data(fields...)
+}
+
+func (b *fitBuilder) data(fields ...fitTestField) {
+	for _, field := range fields {
+		switch field.size {
+		case 1:
+			b.records = append(b.records, byte(field.value))
+		case 2:
+			b.records = binary.LittleEndian.AppendUint16(b.records, uint16(field.value))
+		case 4:
+			b.records = binary.LittleEndian.AppendUint32(b.records, field.value)
+		}
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	file := []byte{12, 0x10, 0, 0}
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(b.records)))
+	file = append(file, ".FIT"...)
+	file = append(file, b.records...)
+	return binary.LittleEndian.AppendUint16(file, fitCRC(file))
+}
+
+func fitTime(t time.Time) uint32 {
+	return uint32(t.Sub(fitEpoch).Seconds())
+}
+
+func TestParseFIT(t *testing.T) {
+	start := time.Date(2024, 3, 3, 6, 30, 0, 0, time.UTC)
+	var b fitBuilder
+
+	b.message(0, fitRecord,
+		fitTestField{fitTimestamp, 4, fitTime(start)},
+		fitTestField{3, 1, 140},
+		fitTestField{2, 2, (100 + 500) * 5},
+	)
+	// A record with a compressed timestamp header, 4 seconds on
+	b.define(3, fitRecord, fitTestField{3, 1, 0}, fitTestField{2, 2, 0})
+	b.records = append(b.records, 0x80|3<<5|byte((fitTime(start)+4)&0x1F))
+	b.data(fitTestField{3, 1, 160}, fitTestField{2, 2, (112 + 500) * 5})
+
+	b.message(1, fitLap,
+		fitTestField{fitTimestamp, 4, fitTime(start.Add(300 * time.Second))},
+		fitTestField{2, 4, fitTime(start)},
+		fitTestField{8, 4, 300000},
+		fitTestField{9, 4, 100000},
+		fitTestField{15, 1, 150},
+	)
+	b.message(2, fitSession,
+		fitTestField{fitTimestamp, 4, fitTime(start.Add(300 * time.Second))},
+		fitTestField{2, 4, fitTime(start)},
+		fitTestField{5, 1, 1},
+		fitTestField{8, 4, 300000},
+		fitTestField{9, 4, 100000},
+		fitTestField{11, 2, 75},
+		fitTestField{16, 1, 150},
+		fitTestField{17, 1, 0xFF},
+	)
+
+	activity, err := Parse(b.bytes())
+	require.NoError(t, err)
+
+	assert.Equal(t, store.ActivityRun, activity.Sport)
+	assert.Equal(t, start, activity.StartTime)
+	assert.Equal(t, 300, activity.DurationSeconds)
+	assert.Equal(t, 1.0, activity.DistanceKm)
+	assert.Equal(t, 75, *activity.Calories)
+	assert.Equal(t, 150, *activity.AvgHeartRate)
+	// Invalid in the session, so taken from the samples
+	assert.Equal(t, 160, *activity.MaxHeartRate)
+	assert.Equal(t, 12.0, *activity.ElevationGainM)
+
+	require.Len(t, activity.HeartRate, 2)
+	assert.Equal(t, start.Add(4*time.Second), activity.HeartRate[1].Time)
+
+	require.Len(t, activity.Laps, 1)
+	assert.Equal(t, 300, activity.Laps[0].DurationSeconds)
+	assert.Equal(t, 150, *activity.Laps[0].AvgHeartRate)
+}
+
+func TestParseRejectsBadFiles(t *testing.T) {
+	_, err := Parse([]byte("name,distance\nrun,5\n"))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	var b fitBuilder
+	b.message(0, fitRecord, fitTestField{fitTimestamp, 4, 1000})
+	file := b.bytes()
+	file[len(file)-3] ^= 0xFF
+	_, err = Parse(file)
+	assert.ErrorIs(t, err, errCorruptFIT)
+
+	_, err = Parse([]byte(`<gpx version="1.1"><trk><trkseg></trkseg></trk></gpx>`))
+	assert.ErrorIs(t, err, ErrNoActivity)
+}
@@ -0,0 +1,313 @@
+package activityfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+var errCorruptFIT = errors.New("FIT file is truncated or corrupt")
+
+// FIT global message numbers.
+const (
+	fitSession = 18
+	fitLap     = 19
+	fitRecord  = 20
+)
+
+// fitTimestamp is the field holding the time of any message.
+const fitTimestamp = 253
+
+// fitEpoch is the zero time of FIT timestamps.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// fitSports maps FIT sport enums to store activities.
+var fitSports = map[uint64]string{
+	1:  store.ActivityRun,
+	2:  store.ActivityRide,
+	5:  store.ActivitySwim,
+	11: store.ActivityWalk,
+	15: store.ActivityRow,
+	17: store.ActivityHike,
+}
+
+type fitField struct {
+	num  byte
+	size int
+}
+
+type fitDefinition struct {
+	global    uint16
+	bigEndian bool
+	fields    []fitField
+	devSize   int
+}
+
+// fitMessage holds the valid integer fields of a data message.
+type fitMessage map[byte]uint64
+
+func (m fitMessage) time(num byte) (time.Time, bool) {
+	v, ok := m[num]
+	if !ok {
+		return time.Time{}, false
+	}
+	return fitEpoch.Add(time.Duration(v) * time.Second), true
+}
+
+// scaled returns a field divided by its scale, as FIT stores fractional
+// values as integers.
+func (m fitMessage) scaled(num byte, scale float64) (float64, bool) {
+	v, ok := m[num]
+	return float64(v) / scale, ok
+}
+
+func (m fitMessage) int(num byte) *int {
+	v, ok := m[num]
+	if !ok || v == 0 {
+		return nil
+	}
+	return intPtr(int(v))
+}
+
+// parseFIT decodes the session, lap and record messages of a FIT file,
+// ignoring everything else. Only the first session is used.
+func parseFIT(data []byte) (*Activity, error) {
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize {
+		return nil, errCorruptFIT
+	}
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if end+2 > len(data) || end < headerSize {
+		return nil, errCorruptFIT
+	}
+	if binary.LittleEndian.Uint16(data[end:end+2]) != fitCRC(data[:end]) {
+		return nil, errCorruptFIT
+	}
+
+	activity := &Activity{}
+	var t track
+	var sessionSeen bool
+	var lastTimestamp uint32
+	definitions := map[byte]*fitDefinition{}
+
+	for pos := headerSize; pos < end; {
+		header := data[pos]
+		pos++
+
+		var local byte
+		compressed := header&0x80 != 0
+		switch {
+		case compressed:
+			// The header carries the low five bits of the timestamp
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp := lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+		case header&0x40 != 0:
+			definition, n, err := readFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			definitions[header&0x0F] = definition
+			pos += n
+			continue
+		default:
+			local = header & 0x0F
+		}
+
+		definition := definitions[local]
+		if definition == nil {
+			return nil, errCorruptFIT
+		}
+		message, n, err := readFITMessage(data[pos:end], definition)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+
+		if compressed {
+			message[fitTimestamp] = uint64(lastTimestamp)
+		} else if v, ok := message[fitTimestamp]; ok {
+			lastTimestamp = uint32(v)
+		}
+
+		switch definition.global {
+		case fitSession:
+			if sessionSeen {
+				continue
+			}
+			sessionSeen = true
+			readFITSession(activity, message)
+		case fitLap:
+			activity.Laps = append(activity.Laps, readFITLap(message))
+		case fitRecord:
+			if bpm, ok := message[3]; ok && bpm > 0 {
+				at, _ := message.time(fitTimestamp)
+				activity.HeartRate = append(activity.HeartRate, Sample{Time: at, BPM: int(bpm)})
+			}
+			if v, ok := message.scaled(78, 5); ok {
+				t.addElevation(v - 500)
+			} else if v, ok := message.scaled(2, 5); ok {
+				t.addElevation(v - 500)
+			}
+			if v, ok := message.scaled(5, 100); ok {
+				t.distanceKm = v / 1000
+			}
+		}
+	}
+
+	// Devices that don't write a session still record every point
+	if !sessionSeen && len(activity.HeartRate) > 0 {
+		first, last := activity.HeartRate[0].Time, activity.HeartRate[len(activity.HeartRate)-1].Time
+		activity.StartTime = first
+		activity.DurationSeconds = int(last.Sub(first).Seconds())
+	}
+	if activity.DistanceKm == 0 {
+		activity.DistanceKm = t.distanceKm
+	}
+	if activity.ElevationGainM == nil {
+		activity.ElevationGainM = t.elevationGain()
+	}
+	return activity, nil
+}
+
+func readFITSession(activity *Activity, message fitMessage) {
+	activity.StartTime, _ = message.time(2)
+	activity.Sport = fitSports[message[5]]
+	if seconds, ok := message.scaled(8, 1000); ok {
+		activity.DurationSeconds = int(math.Round(seconds))
+	} else if seconds, ok := message.scaled(7, 1000); ok {
+		activity.DurationSeconds = int(math.Round(seconds))
+	}
+	if meters, ok := message.scaled(9, 100); ok {
+		activity.DistanceKm = meters / 1000
+	}
+	activity.Calories = message.int(11)
+	activity.AvgHeartRate = message.int(16)
+	activity.MaxHeartRate = message.int(17)
+	if climb, ok := message.scaled(22, 1); ok {
+		activity.ElevationGainM = &climb
+	}
+}
+
+func readFITLap(message fitMessage) Lap {
+	lap := Lap{AvgHeartRate: message.int(15)}
+	lap.StartTime, _ = message.time(2)
+	if seconds, ok := message.scaled(8, 1000); ok {
+		lap.DurationSeconds = int(math.Round(seconds))
+	} else if seconds, ok := message.scaled(7, 1000); ok {
+		lap.DurationSeconds = int(math.Round(seconds))
+	}
+	if meters, ok := message.scaled(9, 100); ok {
+		lap.DistanceKm = meters / 1000
+	}
+	if climb, ok := message.scaled(21, 1); ok {
+		lap.ElevationGainM = &climb
+	}
+	return lap
+}
+
+// readFITDefinition reads a definition message, returning it along with
+// the number of bytes it took.
+func readFITDefinition(data []byte, developer bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, errCorruptFIT
+	}
+	definition := &fitDefinition{bigEndian: data[1] == 1}
+	if definition.bigEndian {
+		definition.global = binary.BigEndian.Uint16(data[2:4])
+	} else {
+		definition.global = binary.LittleEndian.Uint16(data[2:4])
+	}
+
+	count := int(data[4])
+	pos := 5
+	if len(data) < pos+3*count {
+		return nil, 0, errCorruptFIT
+	}
+	for i := 0; i < count; i++ {
+		definition.fields = append(definition.fields, fitField{num: data[pos], size: int(data[pos+1])})
+		pos += 3
+	}
+
+	if developer {
+		if len(data) < pos+1 {
+			return nil, 0, errCorruptFIT
+		}
+		count = int(data[pos])
+		pos++
+		if len(data) < pos+3*count {
+			return nil, 0, errCorruptFIT
+		}
+		for i := 0; i < count; i++ {
+			definition.devSize += int(data[pos+1])
+			pos += 3
+		}
+	}
+	return definition, pos, nil
+}
+
+// readFITMessage reads a data message, keeping its valid one, two and four
+// byte fields. It returns the number of bytes the message took.
+func readFITMessage(data []byte, definition *fitDefinition) (fitMessage, int, error) {
+	message := fitMessage{}
+	pos := 0
+	for _, field := range definition.fields {
+		if len(data) < pos+field.size {
+			return nil, 0, errCorruptFIT
+		}
+		raw := data[pos : pos+field.size]
+		pos += field.size
+
+		var order binary.ByteOrder = binary.LittleEndian
+		if definition.bigEndian {
+			order = binary.BigEndian
+		}
+		var v, invalid uint64
+		switch field.size {
+		case 1:
+			v, invalid = uint64(raw[0]), math.MaxUint8
+		case 2:
+			v, invalid = uint64(order.Uint16(raw)), math.MaxUint16
+		case 4:
+			v, invalid = uint64(order.Uint32(raw)), math.MaxUint32
+		default:
+			continue
+		}
+		if v != invalid {
+			message[field.num] = v
+		}
+	}
+
+	pos += definition.devSize
+	if len(data) < pos {
+		return nil, 0, errCorruptFIT
+	}
+	return message, pos, nil
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC computes the CRC-16 FIT files end with.
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
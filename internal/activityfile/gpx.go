@@ -0,0 +1,78 @@
+package activityfile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type gpxFile struct {
+	Name   string `xml:"metadata>name"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat       float64   `xml:"lat,attr"`
+	Lon       float64   `xml:"lon,attr"`
+	Elevation *float64  `xml:"ele"`
+	Time      time.Time `xml:"time"`
+	// Garmin's TrackPointExtension, which most devices write
+	HeartRate int `xml:"extensions>TrackPointExtension>hr"`
+}
+
+// parseGPX reads a GPX track. GPX has no laps or totals, so the distance
+// and climb are measured along the track and the duration runs from the
+// first point to the last.
+func parseGPX(data []byte) (*Activity, error) {
+	var file gpxFile
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("reading GPX: %w", err)
+	}
+
+	activity := &Activity{Name: file.Name}
+	var t track
+	var first, last time.Time
+	for _, trk := range file.Tracks {
+		if activity.Name == "" {
+			activity.Name = trk.Name
+		}
+		if activity.Sport == "" {
+			activity.Sport = sportFromName(trk.Type)
+		}
+
+		for _, segment := range trk.Segments {
+			// Segments are separated by pauses, so distance isn't carried across
+			t.lastLat, t.lastEle = nil, nil
+			for _, point := range segment.Points {
+				t.addPosition(point.Lat, point.Lon)
+				if point.Elevation != nil {
+					t.addElevation(*point.Elevation)
+				}
+				if point.Time.IsZero() {
+					continue
+				}
+				if first.IsZero() {
+					first = point.Time
+				}
+				last = point.Time
+				if point.HeartRate > 0 {
+					activity.HeartRate = append(activity.HeartRate, Sample{Time: point.Time, BPM: point.HeartRate})
+				}
+			}
+		}
+	}
+
+	activity.StartTime = first
+	activity.DurationSeconds = int(last.Sub(first).Seconds())
+	activity.DistanceKm = t.distanceKm
+	activity.ElevationGainM = t.elevationGain()
+	return activity, nil
+}
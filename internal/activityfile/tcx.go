@@ -0,0 +1,102 @@
+package activityfile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string    `xml:"Sport,attr"`
+		ID    time.Time `xml:"Id"`
+		Notes string    `xml:"Notes"`
+		Laps  []tcxLap  `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxLap struct {
+	StartTime        time.Time  `xml:"StartTime,attr"`
+	TotalTimeSeconds float64    `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64    `xml:"DistanceMeters"`
+	Calories         int        `xml:"Calories"`
+	AverageHeartRate int        `xml:"AverageHeartRateBpm>Value"`
+	MaximumHeartRate int        `xml:"MaximumHeartRateBpm>Value"`
+	Points           []tcxPoint `xml:"Track>Trackpoint"`
+}
+
+type tcxPoint struct {
+	Time      time.Time `xml:"Time"`
+	Altitude  *float64  `xml:"AltitudeMeters"`
+	HeartRate int       `xml:"HeartRateBpm>Value"`
+}
+
+// parseTCX reads the first activity of a Training Center file, using the
+// totals the device recorded for each lap.
+func parseTCX(data []byte) (*Activity, error) {
+	var file tcxFile
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("reading TCX: %w", err)
+	}
+	if len(file.Activities) == 0 {
+		return nil, ErrNoActivity
+	}
+
+	tcx := file.Activities[0]
+	activity := &Activity{
+		Name:      tcx.Notes,
+		Sport:     sportFromName(tcx.Sport),
+		StartTime: tcx.ID,
+	}
+
+	var t track
+	maxHeartRate, calories, seconds := 0, 0, 0.0
+	for _, tcxLap := range tcx.Laps {
+		if activity.StartTime.IsZero() {
+			activity.StartTime = tcxLap.StartTime
+		}
+
+		lap := Lap{
+			StartTime:       tcxLap.StartTime,
+			DurationSeconds: int(math.Round(tcxLap.TotalTimeSeconds)),
+			DistanceKm:      tcxLap.DistanceMeters / 1000,
+		}
+		if tcxLap.AverageHeartRate > 0 {
+			lap.AvgHeartRate = intPtr(tcxLap.AverageHeartRate)
+		}
+
+		climbBefore := t.climbM
+		for _, point := range tcxLap.Points {
+			if point.Altitude != nil {
+				t.addElevation(*point.Altitude)
+			}
+			if point.HeartRate > 0 && !point.Time.IsZero() {
+				activity.HeartRate = append(activity.HeartRate, Sample{Time: point.Time, BPM: point.HeartRate})
+			}
+		}
+		if t.hasClimb {
+			climb := math.Round((t.climbM-climbBefore)*10) / 10
+			lap.ElevationGainM = &climb
+		}
+
+		seconds += tcxLap.TotalTimeSeconds
+		calories += tcxLap.Calories
+		if tcxLap.MaximumHeartRate > maxHeartRate {
+			maxHeartRate = tcxLap.MaximumHeartRate
+		}
+		activity.Laps = append(activity.Laps, lap)
+	}
+
+	activity.DurationSeconds = int(math.Round(seconds))
+	activity.ElevationGainM = t.elevationGain()
+	if calories > 0 {
+		activity.Calories = intPtr(calories)
+	}
+	if maxHeartRate > 0 {
+		activity.MaxHeartRate = intPtr(maxHeartRate)
+	}
+	return activity, nil
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+type AdminHandler struct {
+	UserStore    store.UserStore
+	WorkoutStore store.WorkoutStore
+	SessionStore store.SessionStore
+	AdminStore   store.AdminStore
+	AuditStore   store.AuditStore
+	Auditor      *audit.Auditor
+	Logger       *log.Logger
+}
+
+func NewAdminHandler(userStore store.UserStore, workoutStore store.WorkoutStore, sessionStore store.SessionStore, adminStore store.AdminStore, auditStore store.AuditStore, auditor *audit.Auditor, logger *log.Logger) *AdminHandler {
+	return &AdminHandler{
+		UserStore:    userStore,
+		WorkoutStore: workoutStore,
+		SessionStore: sessionStore,
+		AdminStore:   adminStore,
+		AuditStore:   auditStore,
+		Auditor:      auditor,
+		Logger:       logger,
+	}
+}
+
+// recordAction audits an admin action under the "admin." namespace.
+func (ah *AdminHandler) recordAction(r *http.Request, action, targetType string, targetID int64, metadata map[string]any) {
+	ah.Auditor.Record(r, audit.Entry{
+		Action:     "admin." + action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Metadata:   metadata,
+	})
+}
+
+func (ah *AdminHandler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := utils.ReadPagination(r, 20, 100)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.UserFilter{
+		Query:    query.Get("q"),
+		Role:     query.Get("role"),
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	if filter.Role != "" && !auth.ValidRole(filter.Role) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid role"})
+		return
+	}
+
+	if v := query.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "disabled must be true or false"})
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	users, total, err := ah.UserStore.ListUsers(filter)
+	if err != nil {
+		ah.Logger.Printf("ERROR: listing users: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.recordAction(r, "users.list", "user", 0, map[string]any{"q": filter.Query, "role": filter.Role, "page": page})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"users":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (ah *AdminHandler) HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ah.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	user, err := ah.UserStore.GetUserByID(int(userID))
+	if err != nil {
+		ah.Logger.Printf("ERROR: getting user by id: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	ah.recordAction(r, "users.view", "user", userID, nil)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (ah *AdminHandler) HandleDisableUser(w http.ResponseWriter, r *http.Request) {
+	ah.setUserDisabled(w, r, true)
+}
+
+func (ah *AdminHandler) HandleEnableUser(w http.ResponseWriter, r *http.Request) {
+	ah.setUserDisabled(w, r, false)
+}
+
+func (ah *AdminHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ah.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ah.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+	adminID := principal.UserID
+	if disabled && int(userID) == adminID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you cannot disable your own account"})
+		return
+	}
+
+	before, err := ah.UserStore.GetUserByID(int(userID))
+	if err != nil {
+		ah.Logger.Printf("ERROR: getting user by id: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if before == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	err = ah.UserStore.SetUserDisabled(int(userID), disabled)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		ah.Logger.Printf("ERROR: setting user disabled: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	action := "users.enable"
+	if disabled {
+		action = "users.disable"
+
+		// Log the user out everywhere so the change takes effect immediately
+		err = ah.SessionStore.RevokeUserSessions(int(userID), 0)
+		if err != nil {
+			ah.Logger.Printf("ERROR: revoking sessions: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	user, err := ah.UserStore.GetUserByID(int(userID))
+	if err != nil {
+		ah.Logger.Printf("ERROR: getting user by id: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.Auditor.Record(r, audit.Entry{
+		Action:     "admin." + action,
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     before,
+		After:      user,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (ah *AdminHandler) HandleGetWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ah.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	workout, err := ah.WorkoutStore.GetWorkoutByID(workoutID)
+	if err != nil {
+		ah.Logger.Printf("ERROR: getWorkoutByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
+
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ah.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+	system, ok := unitSystem(w, r, ah.UserStore, ah.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	ah.recordAction(r, "workouts.view", "workout", workoutID, map[string]any{"owner_id": workout.UserID})
+
+	presentWorkout(workout, system)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
+}
+
+func (ah *AdminHandler) HandleGetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := ah.AdminStore.GetSystemStats()
+	if err != nil {
+		ah.Logger.Printf("ERROR: getting system stats: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.recordAction(r, "stats.view", "system", 0, nil)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"stats": stats})
+}
+
+func (ah *AdminHandler) HandleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := utils.ReadPagination(r, 50, 200)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		Page:       page,
+		PageSize:   pageSize,
+	}
+
+	if v := query.Get("actor_id"); v != "" {
+		actorID, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid actor_id"})
+			return
+		}
+		filter.ActorID = &actorID
+	}
+
+	if v := query.Get("target_id"); v != "" {
+		targetID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid target_id"})
+			return
+		}
+		filter.TargetID = &targetID
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": bound.name + " must be an RFC 3339 timestamp"})
+			return
+		}
+		*bound.dst = &t
+	}
+
+	events, total, err := ah.AuditStore.ListAuditEvents(filter)
+	if err != nil {
+		ah.Logger.Printf("ERROR: listing audit events: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyHandler struct {
+	APIKeyStore store.APIKeyStore
+	Auditor     *audit.Auditor
+	Logger      *log.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, auditor *audit.Auditor, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		APIKeyStore: apiKeyStore,
+		Auditor:     auditor,
+		Logger:      logger,
+	}
+}
+
+func (kh *APIKeyHandler) validateCreateAPIKeyRequest(req *createAPIKeyRequest) error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(req.Name) > 100 {
+		return errors.New("name cannot be greater than 100 characters")
+	}
+
+	if len(req.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			return errors.New("invalid scope " + scope)
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+func (kh *APIKeyHandler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		kh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	keys, err := kh.APIKeyStore.ListAPIKeys(principal.UserID)
+	if err != nil {
+		kh.Logger.Printf("ERROR: listing API keys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": keys})
+}
+
+func (kh *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		kh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	var req createAPIKeyRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		kh.Logger.Printf("ERROR: decoding create API key: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = kh.validateCreateAPIKeyRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	key, err := store.NewAPIKey(principal.UserID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		kh.Logger.Printf("ERROR: generating API key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = kh.APIKeyStore.CreateAPIKey(key)
+	if err != nil {
+		kh.Logger.Printf("ERROR: creating API key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	kh.Auditor.Record(r, audit.Entry{
+		Action:     "api_key.create",
+		TargetType: "api_key",
+		TargetID:   key.ID,
+		Metadata:   map[string]any{"name": key.Name, "prefix": key.Prefix, "scopes": key.Scopes},
+	})
+
+	// This is the only response that ever contains the key itself
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": key})
+}
+
+func (kh *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		kh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	keyID, err := utils.ReadIDParam(r)
+	if err != nil {
+		kh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid API key id"})
+		return
+	}
+
+	err = kh.APIKeyStore.DeleteAPIKey(keyID, principal.UserID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		kh.Logger.Printf("ERROR: deleting API key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	kh.Auditor.Record(r, audit.Entry{
+		Action:     "api_key.delete",
+		TargetType: "api_key",
+		TargetID:   keyID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+type createCoachInvitationRequest struct {
+	CoachID     *int                    `json:"coach_id"`
+	AthleteID   *int                    `json:"athlete_id"`
+	Permissions *store.CoachPermissions `json:"permissions"`
+}
+
+type CoachHandler struct {
+	CoachStore   store.CoachStore
+	UserStore    store.UserStore
+	WorkoutStore store.WorkoutStore
+	Authorizer   *WorkoutAuthorizer
+	Auditor      *audit.Auditor
+	Logger       *log.Logger
+}
+
+func NewCoachHandler(coachStore store.CoachStore, userStore store.UserStore, workoutStore store.WorkoutStore, authorizer *WorkoutAuthorizer, auditor *audit.Auditor, logger *log.Logger) *CoachHandler {
+	return &CoachHandler{
+		CoachStore:   coachStore,
+		UserStore:    userStore,
+		WorkoutStore: workoutStore,
+		Authorizer:   authorizer,
+		Auditor:      auditor,
+		Logger:       logger,
+	}
+}
+
+// HandleCreateInvitation invites another user to be the caller's coach
+// (coach_id) or athlete (athlete_id). Permissions default to viewing history
+// only; when a coach invites, accepting the invitation agrees to them.
+func (ch *CoachHandler) HandleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	var req createCoachInvitationRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.Logger.Printf("ERROR: decoding coach invitation: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if (req.CoachID == nil) == (req.AthleteID == nil) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "either coach_id or athlete_id is required"})
+		return
+	}
+
+	link := &store.CoachLink{
+		CoachID:     principal.UserID,
+		InvitedBy:   principal.UserID,
+		Permissions: store.CoachPermissions{ViewHistory: true},
+	}
+	inviteeID := 0
+	if req.CoachID != nil {
+		link.CoachID, link.AthleteID = *req.CoachID, principal.UserID
+		inviteeID = *req.CoachID
+	} else {
+		link.AthleteID = *req.AthleteID
+		inviteeID = *req.AthleteID
+	}
+	if req.Permissions != nil {
+		link.Permissions = *req.Permissions
+	}
+
+	if inviteeID == principal.UserID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you cannot coach yourself"})
+		return
+	}
+
+	invitee, err := ch.UserStore.GetUserByID(inviteeID)
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting user by id: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if invitee == nil || !invitee.Activated || invitee.DisabledAt != nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	err = ch.CoachStore.CreateCoachLink(link)
+	if errors.Is(err, store.ErrDuplicateCoachLink) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ch.Logger.Printf("ERROR: creating coach link: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ch.Auditor.Record(r, audit.Entry{
+		Action:     "coach_link.invite",
+		TargetType: "coach_link",
+		TargetID:   link.ID,
+		After:      link,
+	})
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"link": link})
+}
+
+func (ch *CoachHandler) HandleListLinks(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	links, err := ch.CoachStore.ListCoachLinks(principal.UserID)
+	if err != nil {
+		ch.Logger.Printf("ERROR: listing coach links: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"links": links})
+}
+
+func (ch *CoachHandler) HandleAcceptLink(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	linkID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid link id"})
+		return
+	}
+
+	err = ch.CoachStore.AcceptCoachLink(linkID, principal.UserID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invitation not found"})
+		return
+	}
+	if err != nil {
+		ch.Logger.Printf("ERROR: accepting coach link: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	link, err := ch.CoachStore.GetCoachLink(linkID)
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting coach link: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ch.Auditor.Record(r, audit.Entry{
+		Action:     "coach_link.accept",
+		TargetType: "coach_link",
+		TargetID:   linkID,
+		After:      link,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"link": link})
+}
+
+func (ch *CoachHandler) HandleUpdatePermissions(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	linkID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid link id"})
+		return
+	}
+
+	var permissions store.CoachPermissions
+	err = json.NewDecoder(r.Body).Decode(&permissions)
+	if err != nil {
+		ch.Logger.Printf("ERROR: decoding coach permissions: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	before, err := ch.CoachStore.GetCoachLink(linkID)
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting coach link: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if before == nil || before.AthleteID != principal.UserID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "link not found"})
+		return
+	}
+
+	// Only the athlete decides what their coach may do
+	err = ch.CoachStore.UpdateCoachPermissions(linkID, principal.UserID, permissions)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "link not found"})
+		return
+	}
+	if err != nil {
+		ch.Logger.Printf("ERROR: updating coach permissions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	after := *before
+	after.Permissions = permissions
+
+	ch.Auditor.Record(r, audit.Entry{
+		Action:     "coach_link.update",
+		TargetType: "coach_link",
+		TargetID:   linkID,
+		Before:     before.Permissions,
+		After:      after.Permissions,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"link": after})
+}
+
+func (ch *CoachHandler) HandleDeleteLink(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	linkID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid link id"})
+		return
+	}
+
+	err = ch.CoachStore.DeleteCoachLink(linkID, principal.UserID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "link not found"})
+		return
+	}
+	if err != nil {
+		ch.Logger.Printf("ERROR: deleting coach link: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ch.Auditor.Record(r, audit.Entry{
+		Action:     "coach_link.delete",
+		TargetType: "coach_link",
+		TargetID:   linkID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListAthleteWorkouts lists an athlete's workouts for a coach allowed
+// to view their history.
+func (ch *CoachHandler) HandleListAthleteWorkouts(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		ch.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	athleteID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid athlete id"})
+		return
+	}
+
+	page, pageSize, err := utils.ReadPagination(r, 20, 100)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	allowed, err := ch.Authorizer.CanViewHistory(principal.UserID, int(athleteID))
+	if err != nil {
+		ch.Logger.Printf("ERROR: checking coach permissions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !allowed {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "athlete not found"})
+		return
+	}
+
+	system, ok := unitSystem(w, r, ch.UserStore, ch.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	workouts, total, err := ch.WorkoutStore.ListWorkoutsByUserID(int(athleteID), page, pageSize)
+	if err != nil {
+		ch.Logger.Printf("ERROR: listing athlete workouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for _, workout := range workouts {
+		// Estimated calories are only for coaches who may edit the workout,
+		// as on GET /workouts/{id}
+		access, err := ch.Authorizer.Access(principal.UserID, workout)
+		if err != nil {
+			ch.Logger.Printf("ERROR: checking workout access: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		hideEstimatedCalories(workout, access.Write)
+		presentWorkout(workout, system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"workouts":  workouts,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListAthleteWorkoutsHidesEstimatedCalories(t *testing.T) {
+	assignedByCoach := coachID
+	tests := []struct {
+		name        string
+		permissions store.CoachPermissions
+		assignedBy  *int
+		estimate    bool
+	}{
+		{
+			name:        "coach who may only view history",
+			permissions: store.CoachPermissions{ViewHistory: true},
+		},
+		{
+			name:        "coach on a workout they didn't assign",
+			permissions: store.CoachPermissions{ViewHistory: true, AssignWorkouts: true},
+		},
+		{
+			name:        "coach on a workout they assigned",
+			permissions: store.CoachPermissions{ViewHistory: true, AssignWorkouts: true},
+			assignedBy:  &assignedByCoach,
+			estimate:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calories := 420
+			workouts := &fakeWorkoutStore{workouts: map[int64]*store.Workout{
+				10: {ID: 10, UserID: athleteID, Visibility: store.VisibilityPrivate, AssignedBy: tt.assignedBy, CaloriesBurned: &calories, CaloriesEstimated: true},
+			}}
+			auditor, _ := newTestAuditor()
+			ch := NewCoachHandler(nil, &fakeUserStore{}, workouts, newTestAuthorizer(tt.permissions), auditor, discardLogger)
+
+			r := chi.NewRouter()
+			r.Get("/coaching/athletes/{id}/workouts", ch.HandleListAthleteWorkouts)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/coaching/athletes/"+strconv.Itoa(athleteID)+"/workouts", nil), coachID))
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			var body struct {
+				Workouts []map[string]any `json:"workouts"`
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			require.Len(t, body.Workouts, 1)
+			if tt.estimate {
+				assert.EqualValues(t, 420, body.Workouts[0]["calories_burned"])
+			} else {
+				assert.NotContains(t, body.Workouts[0], "calories_burned")
+			}
+		})
+	}
+}
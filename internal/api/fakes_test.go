@@ -0,0 +1,292 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// The fakes embed the store interfaces so that each only has to implement
+// the methods a test reaches; anything else panics.
+
+var discardLogger = log.New(io.Discard, "", 0)
+
+// asUser returns r as sent from a login session of userID.
+func asUser(r *http.Request, userID int) *http.Request {
+	return r.WithContext(middleware.WithPrincipal(r.Context(), &auth.Principal{UserID: userID, SessionID: 1}))
+}
+
+type fakeAuditStore struct {
+	store.AuditStore
+	mu     sync.Mutex
+	events []*store.AuditEvent
+}
+
+func (f *fakeAuditStore) RecordAuditEvent(event *store.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeAuditStore) actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	actions := make([]string, len(f.events))
+	for i, event := range f.events {
+		actions[i] = event.Action
+	}
+	return actions
+}
+
+func newTestAuditor() (*audit.Auditor, *fakeAuditStore) {
+	auditStore := &fakeAuditStore{}
+	return audit.NewAuditor(auditStore, discardLogger), auditStore
+}
+
+type fakeUserStore struct {
+	store.UserStore
+	users map[int]*store.User
+	// tokens, when set, is looked up by GetUserForToken.
+	tokens *fakeTokenStore
+}
+
+func (f *fakeUserStore) GetUserForToken(scope, plaintextToken string) (*store.User, error) {
+	for _, token := range f.tokens.tokens {
+		if token.Scope == scope && token.Plaintext == plaintextToken {
+			return f.users[token.UserID], nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserStore) GetUserByID(id int) (*store.User, error) {
+	return f.users[id], nil
+}
+
+func (f *fakeUserStore) GetUserByUsername(username string) (*store.User, error) {
+	for _, user := range f.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserStore) GetUserByEmail(email string) (*store.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+type fakeSessionStore struct {
+	store.SessionStore
+	sessions []*store.Session
+}
+
+func (f *fakeSessionStore) CreateSession(session *store.Session) error {
+	f.sessions = append(f.sessions, session)
+	session.ID = int64(len(f.sessions))
+	return nil
+}
+
+type fakeTokenStore struct {
+	store.TokenStore
+	tokens []*store.Token
+}
+
+func (f *fakeTokenStore) CreateToken(userID int, ttl time.Duration, scope string) (*store.Token, error) {
+	token := &store.Token{
+		Plaintext: "token-" + scope,
+		UserID:    userID,
+		Expiry:    time.Now().Add(ttl),
+		Scope:     scope,
+	}
+	f.tokens = append(f.tokens, token)
+	return token, nil
+}
+
+type fakeTwoFactorStore struct {
+	store.TwoFactorStore
+	enrollments map[int]*store.TwoFactor
+}
+
+func (f *fakeTwoFactorStore) GetTwoFactor(userID int) (*store.TwoFactor, error) {
+	return f.enrollments[userID], nil
+}
+
+type fakeNotificationStore struct {
+	store.NotificationStore
+	mu            sync.Mutex
+	notifications []*store.Notification
+}
+
+func (f *fakeNotificationStore) GetPreferences(userID int) (map[string]bool, error) {
+	return nil, nil
+}
+
+func (f *fakeNotificationStore) CreateNotification(notification *store.Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notifications = append(f.notifications, notification)
+	return nil
+}
+
+// fakeFollowStore keeps follows keyed by [follower, followee], true once
+// approved.
+type fakeFollowStore struct {
+	store.FollowStore
+	follows map[[2]int]bool
+}
+
+func newFakeFollowStore() *fakeFollowStore {
+	return &fakeFollowStore{follows: map[[2]int]bool{}}
+}
+
+func (f *fakeFollowStore) Follow(followerID, followeeID int) (bool, error) {
+	key := [2]int{followerID, followeeID}
+	if _, ok := f.follows[key]; !ok {
+		f.follows[key] = false
+	}
+	return f.follows[key], nil
+}
+
+func (f *fakeFollowStore) ApproveFollowRequest(followeeID, followerID int) error {
+	key := [2]int{followerID, followeeID}
+	if approved, ok := f.follows[key]; !ok || approved {
+		return sql.ErrNoRows
+	}
+	f.follows[key] = true
+	return nil
+}
+
+func (f *fakeFollowStore) DeclineFollowRequest(followeeID, followerID int) error {
+	key := [2]int{followerID, followeeID}
+	if approved, ok := f.follows[key]; !ok || approved {
+		return sql.ErrNoRows
+	}
+	delete(f.follows, key)
+	return nil
+}
+
+func (f *fakeFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	return f.follows[[2]int{followerID, followeeID}], nil
+}
+
+// fakeCoachStore holds active coach links keyed by [coach, athlete].
+type fakeCoachStore struct {
+	store.CoachStore
+	links map[[2]int]*store.CoachPermissions
+}
+
+func (f *fakeCoachStore) GetCoachPermissions(coachID, athleteID int) (*store.CoachPermissions, error) {
+	return f.links[[2]int{coachID, athleteID}], nil
+}
+
+// fakeGrantStore holds grants keyed by [workout, user].
+type fakeGrantStore struct {
+	store.GrantStore
+	grants map[[2]int64]bool
+}
+
+func (f *fakeGrantStore) HasAccess(workoutID int64, userID int) (bool, error) {
+	return f.grants[[2]int64{workoutID, int64(userID)}], nil
+}
+
+type fakeWorkoutStore struct {
+	store.WorkoutStore
+	workouts map[int64]*store.Workout
+}
+
+func (f *fakeWorkoutStore) GetWorkoutByID(id int64) (*store.Workout, error) {
+	return f.workouts[id], nil
+}
+
+func (f *fakeWorkoutStore) GetWorkoutByShareSlug(slug string) (*store.Workout, error) {
+	for _, workout := range f.workouts {
+		if workout.ShareSlug != nil && *workout.ShareSlug == slug {
+			return workout, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeWorkoutStore) CreateWorkout(workout *store.Workout) (*store.Workout, error) {
+	workout.ID = len(f.workouts) + 100
+	f.workouts[int64(workout.ID)] = workout
+	return workout, nil
+}
+
+func (f *fakeWorkoutStore) UpdateWorkout(workout *store.Workout) error {
+	f.workouts[int64(workout.ID)] = workout
+	return nil
+}
+
+func (f *fakeWorkoutStore) ListWorkoutsByUserID(userID int, page, pageSize int) ([]*store.Workout, int, error) {
+	workouts := []*store.Workout{}
+	for _, workout := range f.workouts {
+		if workout.UserID == userID {
+			workouts = append(workouts, workout)
+		}
+	}
+	return workouts, len(workouts), nil
+}
+
+// ListFeed returns every workout of other users that isn't private.
+func (f *fakeWorkoutStore) ListFeed(userID int, page, pageSize int) ([]*store.FeedWorkout, int, error) {
+	feed := []*store.FeedWorkout{}
+	for _, workout := range f.workouts {
+		if workout.UserID != userID && workout.Visibility != store.VisibilityPrivate {
+			feed = append(feed, &store.FeedWorkout{Workout: *workout})
+		}
+	}
+	return feed, len(feed), nil
+}
+
+type fakeMeasurementStore struct {
+	store.MeasurementStore
+	bodyweights map[int]float64
+	// asked records the times bodyweights were looked up at.
+	asked []time.Time
+}
+
+func (f *fakeMeasurementStore) GetBodyweightKg(userID int, at time.Time) (*float64, error) {
+	f.asked = append(f.asked, at)
+	kg, ok := f.bodyweights[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &kg, nil
+}
+
+type fakeCommentStore struct {
+	store.CommentStore
+	comments []*store.WorkoutComment
+}
+
+func (f *fakeCommentStore) CreateComment(comment *store.WorkoutComment) error {
+	f.comments = append(f.comments, comment)
+	comment.ID = int64(len(f.comments))
+	return nil
+}
+
+func (f *fakeCommentStore) ListComments(workoutID int64) ([]*store.WorkoutComment, error) {
+	var comments []*store.WorkoutComment
+	for _, comment := range f.comments {
+		if comment.WorkoutID == workoutID {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
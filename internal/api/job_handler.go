@@ -0,0 +1,96 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+var validJobStatuses = map[string]bool{
+	store.JobPending:   true,
+	store.JobRunning:   true,
+	store.JobSucceeded: true,
+	store.JobDead:      true,
+}
+
+// JobHandler lets admins inspect the background job queue and retry
+// dead-lettered jobs.
+type JobHandler struct {
+	JobStore store.JobStore
+	Auditor  *audit.Auditor
+	Logger   *log.Logger
+}
+
+func NewJobHandler(jobStore store.JobStore, auditor *audit.Auditor, logger *log.Logger) *JobHandler {
+	return &JobHandler{
+		JobStore: jobStore,
+		Auditor:  auditor,
+		Logger:   logger,
+	}
+}
+
+func (jh *JobHandler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := utils.ReadPagination(r, 50, 200)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter := store.JobFilter{
+		Status:   r.URL.Query().Get("status"),
+		Type:     r.URL.Query().Get("type"),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if filter.Status != "" && !validJobStatuses[filter.Status] {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be pending, running, succeeded or dead"})
+		return
+	}
+
+	jobs, total, err := jh.JobStore.ListJobs(filter)
+	if err != nil {
+		jh.Logger.Printf("ERROR: listing jobs: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"jobs":      jobs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (jh *JobHandler) HandleRetryJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := utils.ReadIDParam(r)
+	if err != nil {
+		jh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid job id"})
+		return
+	}
+
+	err = jh.JobStore.RequeueJob(jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no dead job with that id"})
+		return
+	}
+	if err != nil {
+		jh.Logger.Printf("ERROR: retrying job: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	jh.Auditor.Record(r, audit.Entry{
+		Action:     "job.retry",
+		TargetType: "job",
+		TargetID:   jobID,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+type KeysHandler struct {
+	Keyring *auth.Keyring
+	Logger  *log.Logger
+}
+
+// NewKeysHandler creates the handler publishing the token verification
+// keys. keyring may be nil when tokens are signed with a shared secret.
+func NewKeysHandler(keyring *auth.Keyring, logger *log.Logger) *KeysHandler {
+	return &KeysHandler{
+		Keyring: keyring,
+		Logger:  logger,
+	}
+}
+
+func (kh *KeysHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := []auth.JWK{}
+	if kh.Keyring != nil {
+		keys = kh.Keyring.JWKS()
+	}
+
+	// Verifiers poll this; a short cache keeps rotations visible quickly
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"keys": keys})
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/training"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+const (
+	defaultTrendWindowDays = 7
+	maxTrendWindowDays     = 90
+)
+
+type createMeasurementRequest struct {
+	Metric     string     `json:"metric"`
+	Value      float64    `json:"value"`
+	Unit       string     `json:"unit"`
+	MeasuredAt *time.Time `json:"measured_at"`
+	Notes      *string    `json:"notes"`
+}
+
+type updateMeasurementRequest struct {
+	Metric     *string    `json:"metric"`
+	Value      *float64   `json:"value"`
+	Unit       *string    `json:"unit"`
+	MeasuredAt *time.Time `json:"measured_at"`
+	Notes      *string    `json:"notes"`
+}
+
+func validateMeasurement(measurement *store.Measurement) error {
+	if !store.ValidMetric(measurement.Metric) {
+		return errors.New("unknown metric " + measurement.Metric)
+	}
+	if !store.ValidMeasurementUnit(measurement.Metric, measurement.Unit) {
+		return errors.New(measurement.Metric + " can't be recorded in " + measurement.Unit)
+	}
+	if measurement.Value <= 0 || measurement.Value >= 1000000 {
+		return errors.New("value must be a positive number below 1000000")
+	}
+	if measurement.MeasuredAt.After(time.Now().Add(time.Hour)) {
+		return errors.New("measured_at can't be in the future")
+	}
+	return nil
+}
+
+// preferredUnit returns the unit a metric is shown in for the unit system.
+func preferredUnit(metric, system string) string {
+	switch metric {
+	case store.MetricBodyweight:
+		return units.WeightUnit(system)
+	case store.MetricBodyFat:
+		return store.MeasurementUnits[metric][0]
+	}
+	return units.LengthUnit(system)
+}
+
+type MeasurementHandler struct {
+	MeasurementStore store.MeasurementStore
+	UserStore        store.UserStore
+	Auditor          *audit.Auditor
+	Logger           *log.Logger
+}
+
+func NewMeasurementHandler(measurementStore store.MeasurementStore, userStore store.UserStore, auditor *audit.Auditor, logger *log.Logger) *MeasurementHandler {
+	return &MeasurementHandler{
+		MeasurementStore: measurementStore,
+		UserStore:        userStore,
+		Auditor:          auditor,
+		Logger:           logger,
+	}
+}
+
+// loadMeasurement fetches the caller's measurement named in the URL.
+// Other users' measurements are reported as not found.
+func (mh *MeasurementHandler) loadMeasurement(w http.ResponseWriter, r *http.Request) *store.Measurement {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		mh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return nil
+	}
+
+	measurementID, err := utils.ReadIDParam(r)
+	if err != nil {
+		mh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid measurement id"})
+		return nil
+	}
+
+	measurement, err := mh.MeasurementStore.GetMeasurement(measurementID)
+	if err != nil {
+		mh.Logger.Printf("ERROR: getting measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if measurement == nil || measurement.UserID != principal.UserID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement not found"})
+		return nil
+	}
+
+	return measurement
+}
+
+// readMeasurementFilter parses the metric, from and to query parameters.
+func readMeasurementFilter(r *http.Request) (store.MeasurementFilter, error) {
+	query := r.URL.Query()
+	filter := store.MeasurementFilter{Metric: query.Get("metric")}
+	if filter.Metric != "" && !store.ValidMetric(filter.Metric) {
+		return filter, errors.New("unknown metric " + filter.Metric)
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, errors.New(bound.name + " must be an RFC 3339 timestamp")
+		}
+		*bound.dst = &t
+	}
+
+	return filter, nil
+}
+
+func (mh *MeasurementHandler) HandleListMeasurements(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		mh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	filter, err := readMeasurementFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurements, err := mh.MeasurementStore.ListMeasurements(principal.UserID, filter)
+	if err != nil {
+		mh.Logger.Printf("ERROR: listing measurements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurements": measurements})
+}
+
+func (mh *MeasurementHandler) HandleCreateMeasurement(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		mh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	var req createMeasurementRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		mh.Logger.Printf("ERROR: decoding measurement: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	measurement := &store.Measurement{
+		UserID:     principal.UserID,
+		Metric:     req.Metric,
+		Value:      req.Value,
+		Unit:       req.Unit,
+		MeasuredAt: time.Now(),
+		Notes:      req.Notes,
+	}
+	if req.MeasuredAt != nil {
+		measurement.MeasuredAt = *req.MeasuredAt
+	}
+	if measurement.Unit == "" && store.ValidMetric(measurement.Metric) {
+		system, ok := unitSystem(w, r, mh.UserStore, mh.Logger, principal.UserID)
+		if !ok {
+			return
+		}
+		measurement.Unit = preferredUnit(measurement.Metric, system)
+	}
+
+	if err = validateMeasurement(measurement); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = mh.MeasurementStore.CreateMeasurement(measurement)
+	if err != nil {
+		mh.Logger.Printf("ERROR: creating measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	mh.Auditor.Record(r, audit.Entry{
+		Action:     "measurement.create",
+		TargetType: "measurement",
+		TargetID:   measurement.ID,
+		After:      measurement,
+	})
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"measurement": measurement})
+}
+
+func (mh *MeasurementHandler) HandleGetMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement := mh.loadMeasurement(w, r)
+	if measurement == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurement": measurement})
+}
+
+func (mh *MeasurementHandler) HandleUpdateMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement := mh.loadMeasurement(w, r)
+	if measurement == nil {
+		return
+	}
+	before := *measurement
+
+	var req updateMeasurementRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		mh.Logger.Printf("ERROR: decoding measurement: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Metric != nil {
+		measurement.Metric = *req.Metric
+	}
+	if req.Value != nil {
+		measurement.Value = *req.Value
+	}
+	if req.Unit != nil {
+		measurement.Unit = *req.Unit
+	}
+	if req.MeasuredAt != nil {
+		measurement.MeasuredAt = *req.MeasuredAt
+	}
+	if req.Notes != nil {
+		measurement.Notes = req.Notes
+	}
+
+	if err = validateMeasurement(measurement); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = mh.MeasurementStore.UpdateMeasurement(measurement)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement not found"})
+		return
+	}
+	if err != nil {
+		mh.Logger.Printf("ERROR: updating measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	mh.Auditor.Record(r, audit.Entry{
+		Action:     "measurement.update",
+		TargetType: "measurement",
+		TargetID:   measurement.ID,
+		Before:     &before,
+		After:      measurement,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurement": measurement})
+}
+
+func (mh *MeasurementHandler) HandleDeleteMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement := mh.loadMeasurement(w, r)
+	if measurement == nil {
+		return
+	}
+
+	err := mh.MeasurementStore.DeleteMeasurement(measurement.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement not found"})
+		return
+	}
+	if err != nil {
+		mh.Logger.Printf("ERROR: deleting measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	mh.Auditor.Record(r, audit.Entry{
+		Action:     "measurement.delete",
+		TargetType: "measurement",
+		TargetID:   measurement.ID,
+		Before:     measurement,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetTrend returns a metric's measurements with their moving average
+// over window_days, all converted to one unit.
+func (mh *MeasurementHandler) HandleGetTrend(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		mh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	filter, err := readMeasurementFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if filter.Metric == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "metric is required"})
+		return
+	}
+
+	unit := r.URL.Query().Get("unit")
+	if unit == "" {
+		system, ok := unitSystem(w, r, mh.UserStore, mh.Logger, principal.UserID)
+		if !ok {
+			return
+		}
+		unit = preferredUnit(filter.Metric, system)
+	} else if !store.ValidMeasurementUnit(filter.Metric, unit) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": filter.Metric + " can't be recorded in " + unit})
+		return
+	}
+
+	windowDays := defaultTrendWindowDays
+	if v := r.URL.Query().Get("window_days"); v != "" {
+		windowDays, err = strconv.Atoi(v)
+		if err != nil || windowDays < 1 || windowDays > maxTrendWindowDays {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "window_days must be between 1 and 90"})
+			return
+		}
+	}
+
+	measurements, err := mh.MeasurementStore.ListMeasurements(principal.UserID, filter)
+	if err != nil {
+		mh.Logger.Printf("ERROR: listing measurements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	for _, measurement := range measurements {
+		measurement.Value = measurement.ValueIn(unit)
+	}
+	points := training.MovingAverage(measurements, time.Duration(windowDays)*24*time.Hour)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"metric":      filter.Metric,
+		"unit":        unit,
+		"window_days": windowDays,
+		"points":      points,
+	})
+}
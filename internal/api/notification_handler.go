@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/notify"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+type NotificationHandler struct {
+	NotificationStore store.NotificationStore
+	Notifier          *notify.Notifier
+	Logger            *log.Logger
+}
+
+func NewNotificationHandler(notificationStore store.NotificationStore, notifier *notify.Notifier, logger *log.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		NotificationStore: notificationStore,
+		Notifier:          notifier,
+		Logger:            logger,
+	}
+}
+
+func (nh *NotificationHandler) HandleListNotifications(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		nh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	page, pageSize, err := utils.ReadPagination(r, 20, 100)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter := store.NotificationFilter{Page: page, PageSize: pageSize}
+	if v := r.URL.Query().Get("unread"); v != "" {
+		filter.UnreadOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unread must be true or false"})
+			return
+		}
+	}
+
+	notifications, total, err := nh.NotificationStore.ListNotifications(principal.UserID, filter)
+	if err != nil {
+		nh.Logger.Printf("ERROR: listing notifications: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	unread, err := nh.NotificationStore.CountUnread(principal.UserID)
+	if err != nil {
+		nh.Logger.Printf("ERROR: counting unread notifications: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"notifications": notifications,
+		"unread_count":  unread,
+		"total":         total,
+		"page":          page,
+		"page_size":     pageSize,
+	})
+}
+
+func (nh *NotificationHandler) HandleMarkRead(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		nh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	notificationID, err := utils.ReadIDParam(r)
+	if err != nil {
+		nh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid notification id"})
+		return
+	}
+
+	err = nh.NotificationStore.MarkRead(notificationID, principal.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "notification not found"})
+		return
+	}
+	if err != nil {
+		nh.Logger.Printf("ERROR: marking notification read: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (nh *NotificationHandler) HandleMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		nh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	marked, err := nh.NotificationStore.MarkAllRead(principal.UserID)
+	if err != nil {
+		nh.Logger.Printf("ERROR: marking notifications read: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"marked": marked})
+}
+
+func (nh *NotificationHandler) HandleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		nh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	preferences, err := nh.Notifier.Preferences(principal.UserID)
+	if err != nil {
+		nh.Logger.Printf("ERROR: reading notification preferences: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"preferences": preferences})
+}
+
+func (nh *NotificationHandler) HandleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		nh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	var req map[string]bool
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		nh.Logger.Printf("ERROR: decoding notification preferences: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	for notificationType, enabled := range req {
+		if !notify.ValidType(notificationType) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown notification type " + strconv.Quote(notificationType)})
+			return
+		}
+		if notify.Mandatory(notificationType) && !enabled {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": notificationType + " notifications cannot be turned off"})
+			return
+		}
+	}
+
+	for notificationType, enabled := range req {
+		err = nh.NotificationStore.SetPreference(principal.UserID, notificationType, enabled)
+		if err != nil {
+			nh.Logger.Printf("ERROR: saving notification preference: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	preferences, err := nh.Notifier.Preferences(principal.UserID)
+	if err != nil {
+		nh.Logger.Printf("ERROR: reading notification preferences: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"preferences": preferences})
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/oidc"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	oidcCookieName = "oidc_login"
+	oidcLoginTTL   = 10 * time.Minute
+)
+
+var usernameDisallowedRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// oidcLoginState is kept in a short-lived cookie between the redirect to the
+// provider and the callback.
+type oidcLoginState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type OIDCHandler struct {
+	Providers     map[string]*oidc.Provider
+	UserStore     store.UserStore
+	IdentityStore store.IdentityStore
+	UserHandler   *UserHandler
+	Auditor       *audit.Auditor
+	Logger        *log.Logger
+}
+
+func NewOIDCHandler(providers []*oidc.Provider, userStore store.UserStore, identityStore store.IdentityStore, userHandler *UserHandler, auditor *audit.Auditor, logger *log.Logger) *OIDCHandler {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &OIDCHandler{
+		Providers:     byName,
+		UserStore:     userStore,
+		IdentityStore: identityStore,
+		UserHandler:   userHandler,
+		Auditor:       auditor,
+		Logger:        logger,
+	}
+}
+
+func (oh *OIDCHandler) provider(w http.ResponseWriter, r *http.Request) *oidc.Provider {
+	provider, ok := oh.Providers[chi.URLParam(r, "provider")]
+	if !ok {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": oidc.ErrUnknownProvider.Error()})
+		return nil
+	}
+	return provider
+}
+
+func (oh *OIDCHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	provider := oh.provider(w, r)
+	if provider == nil {
+		return
+	}
+
+	login := oidcLoginState{Provider: provider.Name()}
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		random, err := oidc.RandomString()
+		if err != nil {
+			oh.Logger.Printf("ERROR: generating OIDC login state: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		*value = random
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		oh.Logger.Printf("ERROR: building %s authorization URL: %v", provider.Name(), err)
+		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{"error": "identity provider unavailable"})
+		return
+	}
+
+	value, err := json.Marshal(login)
+	if err != nil {
+		oh.Logger.Printf("ERROR: encoding OIDC login state: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/auth/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (oh *OIDCHandler) readLoginState(r *http.Request) (*oidcLoginState, error) {
+	cookie, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var login oidcLoginState
+	err = json.Unmarshal(value, &login)
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (oh *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	provider := oh.provider(w, r)
+	if provider == nil {
+		return
+	}
+
+	// The state is single use whatever the outcome
+	http.SetCookie(w, &http.Cookie{Name: oidcCookieName, Path: "/auth/", MaxAge: -1, HttpOnly: true})
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		oh.Logger.Printf("WARN: %s login returned error %q", provider.Name(), errorCode)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "login was cancelled or denied by the identity provider"})
+		return
+	}
+
+	login, err := oh.readLoginState(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "login session expired, please start again"})
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	if login.Provider != provider.Name() || subtle.ConstantTimeCompare([]byte(state), []byte(login.State)) != 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "login session expired, please start again"})
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		oh.Logger.Printf("ERROR: completing %s login: %v", provider.Name(), err)
+		oh.Auditor.Record(r, audit.Entry{
+			Action:     "user.login_failed",
+			TargetType: "user",
+			Metadata:   map[string]any{"provider": provider.Name()},
+		})
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "could not verify the identity provider response"})
+		return
+	}
+
+	user, err := oh.resolveUser(w, r, provider.Name(), identity)
+	if err != nil {
+		oh.Logger.Printf("ERROR: resolving %s identity: %v", provider.Name(), err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		return
+	}
+
+	if !user.Activated || user.DisabledAt != nil {
+		reason, message := "not_activated", "your account must be activated before logging in"
+		if user.DisabledAt != nil {
+			reason, message = "disabled", "your account has been disabled"
+		}
+
+		oh.Auditor.Record(r, audit.Entry{
+			ActorID:    &user.ID,
+			Action:     "user.login_denied",
+			TargetType: "user",
+			TargetID:   int64(user.ID),
+			Metadata:   map[string]any{"reason": reason, "provider": provider.Name()},
+		})
+
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": message})
+		return
+	}
+
+	// An identity provider only stands in for the password, so a second
+	// factor is still required where the user has one
+	oh.UserHandler.completeLogin(w, r, user, map[string]any{"provider": provider.Name()})
+}
+
+// resolveUser finds the local user for an external identity, linking it to an
+// existing account with the same verified email or provisioning a new account
+// on first login. It writes the response itself and returns a nil user when
+// the login can't proceed.
+func (oh *OIDCHandler) resolveUser(w http.ResponseWriter, r *http.Request, providerName string, identity *oidc.Identity) (*store.User, error) {
+	user, err := oh.IdentityStore.GetUserByIdentity(providerName, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, oh.IdentityStore.TouchIdentity(providerName, identity.Subject, identity.Email)
+	}
+
+	// Emails are only trusted for linking once the provider has verified them,
+	// otherwise anyone could claim an existing account at their IdP
+	if !emailRegex.MatchString(identity.Email) || !identity.EmailVerified {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "the identity provider did not share a verified email address"})
+		return nil, nil
+	}
+
+	link := &store.Identity{
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, err = oh.UserStore.GetUserByEmail(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		link.UserID = user.ID
+		err = oh.IdentityStore.LinkIdentity(link)
+		if err != nil {
+			return nil, err
+		}
+
+		oh.Auditor.Record(r, audit.Entry{
+			ActorID:    &user.ID,
+			Action:     "user.identity_link",
+			TargetType: "user",
+			TargetID:   int64(user.ID),
+			Metadata:   map[string]any{"provider": providerName},
+		})
+		return user, nil
+	}
+
+	user, err = oh.provisionUser(link, identity)
+	if errors.Is(err, store.ErrDuplicateEmail) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	oh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.register",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		After:      user,
+		Metadata:   map[string]any{"provider": providerName},
+	})
+	return user, nil
+}
+
+// provisionUser creates an account for a first-time external login. The
+// account gets a random password nobody knows; the user can set one through
+// a password reset if they ever want to log in locally.
+func (oh *OIDCHandler) provisionUser(link *store.Identity, identity *oidc.Identity) (*store.User, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameDisallowedRegex.ReplaceAllString(base, "")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	secret, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	user := &store.User{
+		Username:  base,
+		Email:     identity.Email,
+		Activated: true,
+	}
+	err = user.PasswordHash.Set(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		if attempt > 0 {
+			user.Username = fmt.Sprintf("%s%d", base, 1000+rand.IntN(9000))
+		}
+
+		err = oh.IdentityStore.CreateUserWithIdentity(user, link)
+		if !errors.Is(err, store.ErrDuplicateUsername) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/oidc"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider is a minimal OpenID provider that signs in "00u123" with a
+// verified john@example.com for every authorization code it hands out.
+type stubProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	nonces map[string]string
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	sp := &stubProvider{t: t, key: key, nonces: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 sp.server.URL,
+			"authorization_endpoint": sp.server.URL + "/authorize",
+			"token_endpoint":         sp.server.URL + "/token",
+			"jwks_uri":               sp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		nonce, ok := sp.nonces[r.PostForm.Get("code")]
+		if !ok {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     sp.idToken(nonce),
+		})
+	})
+	sp.server = httptest.NewServer(mux)
+	t.Cleanup(sp.server.Close)
+
+	return sp
+}
+
+func (sp *stubProvider) idToken(nonce string) string {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            sp.server.URL,
+		"sub":            "00u123",
+		"aud":            "client-id",
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "john@example.com",
+		"email_verified": true,
+	})
+	token.Header["kid"] = "stub-key"
+
+	signed, err := token.SignedString(sp.key)
+	require.NoError(sp.t, err)
+	return signed
+}
+
+func (sp *stubProvider) provider() *oidc.Provider {
+	return oidc.NewProvider(oidc.ProviderConfig{
+		Name:         "stub",
+		IssuerURL:    sp.server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8080/auth/stub/callback",
+	}, sp.server.Client())
+}
+
+type fakeIdentityStore struct {
+	store.IdentityStore
+	users map[string]*store.User
+}
+
+func (f *fakeIdentityStore) GetUserByIdentity(provider, subject string) (*store.User, error) {
+	return f.users[provider+":"+subject], nil
+}
+
+func (f *fakeIdentityStore) TouchIdentity(provider, subject, email string) error {
+	return nil
+}
+
+type oidcLoginTest struct {
+	handler    http.Handler
+	provider   *stubProvider
+	sessions   *fakeSessionStore
+	tokens     *fakeTokenStore
+	twoFactor  *fakeTwoFactorStore
+	auditStore *fakeAuditStore
+}
+
+func newOIDCLoginTest(t *testing.T) *oidcLoginTest {
+	user := &store.User{ID: 7, Username: "john", Email: "john@example.com", Activated: true, Role: auth.RoleUser}
+	users := &fakeUserStore{users: map[int]*store.User{user.ID: user}}
+
+	lt := &oidcLoginTest{
+		provider:  newStubProvider(t),
+		sessions:  &fakeSessionStore{},
+		tokens:    &fakeTokenStore{},
+		twoFactor: &fakeTwoFactorStore{enrollments: map[int]*store.TwoFactor{}},
+	}
+	auditor, auditStore := newTestAuditor()
+	lt.auditStore = auditStore
+
+	authenticator := auth.NewJWTAuthenticator("test-secret", auth.Audience, auth.Issuer)
+	userHandler := NewUserHandler(users, lt.sessions, lt.tokens, lt.twoFactor, authenticator, auth.NewPasswordPolicy(8), nil, nil, auditor, discardLogger)
+	identities := &fakeIdentityStore{users: map[string]*store.User{"stub:00u123": user}}
+	oidcHandler := NewOIDCHandler([]*oidc.Provider{lt.provider.provider()}, users, identities, userHandler, auditor, discardLogger)
+
+	r := chi.NewRouter()
+	r.Get("/auth/{provider}/login", oidcHandler.HandleLogin)
+	r.Get("/auth/{provider}/callback", oidcHandler.HandleCallback)
+	lt.handler = r
+	return lt
+}
+
+// login goes through the redirect to the provider and back, returning the
+// callback's response.
+func (lt *oidcLoginTest) login(t *testing.T) (int, map[string]any) {
+	rec := httptest.NewRecorder()
+	lt.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/stub/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	authURL, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	state := authURL.Query().Get("state")
+	lt.provider.nonces["code-1"] = authURL.Query().Get("nonce")
+
+	callback := httptest.NewRequest(http.MethodGet, "/auth/stub/callback?code=code-1&state="+url.QueryEscape(state), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	lt.handler.ServeHTTP(rec, callback)
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return rec.Code, body
+}
+
+func TestOIDCCallbackIssuesSession(t *testing.T) {
+	lt := newOIDCLoginTest(t)
+
+	status, body := lt.login(t)
+
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, body["token"])
+	assert.Nil(t, body["mfa_required"])
+	assert.Len(t, lt.sessions.sessions, 1)
+	assert.Contains(t, lt.auditStore.actions(), "user.login")
+}
+
+func TestOIDCCallbackRequiresSecondFactor(t *testing.T) {
+	lt := newOIDCLoginTest(t)
+	confirmed := time.Now()
+	lt.twoFactor.enrollments[7] = &store.TwoFactor{UserID: 7, Secret: "SECRET", ConfirmedAt: &confirmed}
+
+	status, body := lt.login(t)
+
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, body["mfa_required"])
+	assert.Equal(t, "token-"+store.ScopeMFA, body["mfa_token"])
+	assert.Nil(t, body["token"])
+	assert.Empty(t, lt.sessions.sessions, "no session before the second factor")
+	assert.Contains(t, lt.auditStore.actions(), "user.login_mfa_required")
+	assert.NotContains(t, lt.auditStore.actions(), "user.login")
+}
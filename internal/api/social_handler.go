@@ -0,0 +1,280 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+type SocialHandler struct {
+	FollowStore  store.FollowStore
+	UserStore    store.UserStore
+	WorkoutStore store.WorkoutStore
+	Auditor      *audit.Auditor
+	Logger       *log.Logger
+}
+
+func NewSocialHandler(followStore store.FollowStore, userStore store.UserStore, workoutStore store.WorkoutStore, auditor *audit.Auditor, logger *log.Logger) *SocialHandler {
+	return &SocialHandler{
+		FollowStore:  followStore,
+		UserStore:    userStore,
+		WorkoutStore: workoutStore,
+		Auditor:      auditor,
+		Logger:       logger,
+	}
+}
+
+func (sh *SocialHandler) HandleFollowUser(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	followeeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	if int(followeeID) == principal.UserID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you cannot follow yourself"})
+		return
+	}
+
+	followee, err := sh.UserStore.GetUserByID(int(followeeID))
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting user by id: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if followee == nil || !followee.Activated || followee.DisabledAt != nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	approved, err := sh.FollowStore.Follow(principal.UserID, followee.ID)
+	if err != nil {
+		sh.Logger.Printf("ERROR: following user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if approved {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sh.Auditor.Record(r, audit.Entry{
+		Action:     "user.follow_request",
+		TargetType: "user",
+		TargetID:   int64(followee.ID),
+	})
+
+	// Following only takes effect once the followee approves
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"status": "pending"})
+}
+
+func (sh *SocialHandler) HandleListFollowRequests(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	requests, err := sh.FollowStore.ListFollowRequests(principal.UserID)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing follow requests: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"follow_requests": requests})
+}
+
+func (sh *SocialHandler) HandleApproveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	followerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	err = sh.FollowStore.ApproveFollowRequest(principal.UserID, int(followerID))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follow request not found"})
+		return
+	}
+	if err != nil {
+		sh.Logger.Printf("ERROR: approving follow request: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	sh.Auditor.Record(r, audit.Entry{
+		Action:     "user.follow_approve",
+		TargetType: "user",
+		TargetID:   followerID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SocialHandler) HandleDeclineFollowRequest(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	followerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	err = sh.FollowStore.DeclineFollowRequest(principal.UserID, int(followerID))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follow request not found"})
+		return
+	}
+	if err != nil {
+		sh.Logger.Printf("ERROR: declining follow request: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	sh.Auditor.Record(r, audit.Entry{
+		Action:     "user.follow_decline",
+		TargetType: "user",
+		TargetID:   followerID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SocialHandler) HandleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	followeeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	err = sh.FollowStore.Unfollow(principal.UserID, int(followeeID))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you are not following this user"})
+		return
+	}
+	if err != nil {
+		sh.Logger.Printf("ERROR: unfollowing user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	sh.Auditor.Record(r, audit.Entry{
+		Action:     "user.unfollow",
+		TargetType: "user",
+		TargetID:   followeeID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SocialHandler) HandleListFollowers(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	followers, err := sh.FollowStore.ListFollowers(principal.UserID)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing followers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"followers": followers})
+}
+
+func (sh *SocialHandler) HandleListFollowing(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	following, err := sh.FollowStore.ListFollowing(principal.UserID)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing following: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"following": following})
+}
+
+func (sh *SocialHandler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	page, pageSize, err := utils.ReadPagination(r, 20, 50)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	system, ok := unitSystem(w, r, sh.UserStore, sh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	workouts, total, err := sh.WorkoutStore.ListFeed(principal.UserID, page, pageSize)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing feed: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	// The feed only has other people's workouts
+	for _, workout := range workouts {
+		hideEstimatedCalories(&workout.Workout, false)
+		presentWorkout(&workout.Workout, system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"workouts":  workouts,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
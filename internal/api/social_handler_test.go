@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type followTest struct {
+	router     chi.Router
+	follows    *fakeFollowStore
+	authorizer *WorkoutAuthorizer
+}
+
+func newFollowTest() *followTest {
+	users := &fakeUserStore{users: map[int]*store.User{
+		1: {ID: 1, Username: "alice", Activated: true},
+		2: {ID: 2, Username: "bob", Activated: true},
+	}}
+	follows := newFakeFollowStore()
+	auditor, _ := newTestAuditor()
+	sh := NewSocialHandler(follows, users, nil, auditor, discardLogger)
+
+	r := chi.NewRouter()
+	r.Post("/users/{id}/follow", sh.HandleFollowUser)
+	r.Post("/me/follow-requests/{id}/approve", sh.HandleApproveFollowRequest)
+	r.Delete("/me/follow-requests/{id}", sh.HandleDeclineFollowRequest)
+
+	return &followTest{
+		router:     r,
+		follows:    follows,
+		authorizer: NewWorkoutAuthorizer(&fakeCoachStore{}, follows, &fakeGrantStore{}),
+	}
+}
+
+func (ft *followTest) send(method, path string, userID int) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ft.router.ServeHTTP(rec, asUser(httptest.NewRequest(method, path, nil), userID))
+	return rec
+}
+
+// canRead reports whether bob may read alice's followers-only workout.
+func (ft *followTest) canRead(t *testing.T) bool {
+	workout := &store.Workout{ID: 10, UserID: 1, Visibility: store.VisibilityFollowers}
+	access, err := ft.authorizer.Access(2, workout)
+	require.NoError(t, err)
+	return access.Read
+}
+
+func TestFollowNeedsApproval(t *testing.T) {
+	ft := newFollowTest()
+
+	rec := ft.send(http.MethodPost, "/users/1/follow", 2)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"status": "pending"}`, rec.Body.String())
+	assert.False(t, ft.canRead(t), "a pending request must not reveal followers-only workouts")
+
+	// Only the followee can approve
+	assert.Equal(t, http.StatusNotFound, ft.send(http.MethodPost, "/me/follow-requests/1/approve", 2).Code)
+	assert.False(t, ft.canRead(t))
+
+	assert.Equal(t, http.StatusNoContent, ft.send(http.MethodPost, "/me/follow-requests/2/approve", 1).Code)
+	assert.True(t, ft.canRead(t))
+
+	// Asking again once approved is a no-op
+	assert.Equal(t, http.StatusNoContent, ft.send(http.MethodPost, "/users/1/follow", 2).Code)
+	assert.Equal(t, http.StatusNotFound, ft.send(http.MethodPost, "/me/follow-requests/2/approve", 1).Code)
+}
+
+func TestDeclineFollowRequest(t *testing.T) {
+	ft := newFollowTest()
+
+	assert.Equal(t, http.StatusNotFound, ft.send(http.MethodDelete, "/me/follow-requests/2", 1).Code)
+
+	assert.Equal(t, http.StatusAccepted, ft.send(http.MethodPost, "/users/1/follow", 2).Code)
+	assert.Equal(t, http.StatusNoContent, ft.send(http.MethodDelete, "/me/follow-requests/2", 1).Code)
+	assert.Empty(t, ft.follows.follows)
+	assert.False(t, ft.canRead(t))
+
+	// A declined user can ask again, but still needs approval
+	assert.Equal(t, http.StatusAccepted, ft.send(http.MethodPost, "/users/1/follow", 2).Code)
+	assert.False(t, ft.canRead(t))
+}
+
+func TestFollowYourself(t *testing.T) {
+	ft := newFollowTest()
+
+	assert.Equal(t, http.StatusBadRequest, ft.send(http.MethodPost, "/users/1/follow", 1).Code)
+	assert.Equal(t, http.StatusNotFound, ft.send(http.MethodPost, "/users/3/follow", 1).Code)
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/training"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+const (
+	defaultCardioWeeks = 12
+	maxCardioWeeks     = 104
+	defaultLoadDays    = 90
+	maxLoadDays        = 730
+)
+
+type weeklyDistance struct {
+	WeekStart string  `json:"week_start"`
+	Distance  float64 `json:"distance"`
+}
+
+type bestEffort struct {
+	training.Effort
+	Pace float64 `json:"pace"`
+}
+
+type loadDay struct {
+	Date    string   `json:"date"`
+	Load    float64  `json:"load"`
+	ACWR    *float64 `json:"acwr"`
+	Fitness float64  `json:"fitness"`
+	Fatigue float64  `json:"fatigue"`
+	Form    float64  `json:"form"`
+}
+
+type StatsHandler struct {
+	WorkoutStore store.WorkoutStore
+	UserStore    store.UserStore
+	LoadStore    store.LoadStore
+	Logger       *log.Logger
+}
+
+func NewStatsHandler(workoutStore store.WorkoutStore, userStore store.UserStore, loadStore store.LoadStore, logger *log.Logger) *StatsHandler {
+	return &StatsHandler{
+		WorkoutStore: workoutStore,
+		UserStore:    userStore,
+		LoadStore:    loadStore,
+		Logger:       logger,
+	}
+}
+
+// HandleGetCardioStats reports the caller's weekly distance and best
+// efforts for one activity, in their units.
+func (sh *StatsHandler) HandleGetCardioStats(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	activity := r.URL.Query().Get("activity")
+	if activity == "" {
+		activity = store.ActivityRun
+	}
+	if !store.ValidActivity(activity) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "activity must be run, ride, row, swim, walk or hike"})
+		return
+	}
+
+	weeks := defaultCardioWeeks
+	if v := r.URL.Query().Get("weeks"); v != "" {
+		weeks, err = strconv.Atoi(v)
+		if err != nil || weeks < 1 || weeks > maxCardioWeeks {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "weeks must be between 1 and 104"})
+			return
+		}
+	}
+
+	system, ok := unitSystem(w, r, sh.UserStore, sh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	// The current week counts as one of them
+	since := time.Now().AddDate(0, 0, -7*(weeks-1))
+	totals, err := sh.WorkoutStore.ListWeeklyDistance(principal.UserID, activity, since)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing weekly distance: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	weekly := make([]weeklyDistance, len(totals))
+	for i, total := range totals {
+		weekly[i] = weeklyDistance{
+			WeekStart: total.WeekStart.Format(time.DateOnly),
+			Distance:  roundTo(units.FromKilometers(total.DistanceKm, system), 2),
+		}
+	}
+
+	entries, err := sh.WorkoutStore.ListCardioEntries(principal.UserID, activity, training.BestEffortDistances[0].Km)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing cardio entries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	efforts := []bestEffort{}
+	for _, distance := range training.BestEffortDistances {
+		effort := training.BestEffort(entries, distance.Km)
+		if effort == nil {
+			continue
+		}
+		effort.Distance = distance.Name
+		efforts = append(efforts, bestEffort{
+			Effort: *effort,
+			Pace:   training.Pace(units.FromKilometers(distance.Km, system), effort.DurationSeconds),
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"activity":        activity,
+		"distance_unit":   units.DistanceUnit(system),
+		"weekly_distance": weekly,
+		"best_efforts":    efforts,
+	})
+}
+
+// HandleGetLoadStats reports the caller's daily training load, acute:chronic
+// workload ratio, fitness, fatigue and form between two days.
+func (sh *StatsHandler) HandleGetLoadStats(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		sh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	// Days to come have no load yet
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to := today
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = time.Parse(time.DateOnly, v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "to must be a date like 2024-01-31"})
+			return
+		}
+		if to.After(today) {
+			to = today
+		}
+	}
+	from := to.AddDate(0, 0, -(defaultLoadDays - 1))
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = time.Parse(time.DateOnly, v)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be a date like 2024-01-01"})
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) >= maxLoadDays*24*time.Hour {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be before to, and at most 730 days before it"})
+		return
+	}
+
+	computed, err := sh.updateLoadDays(principal.UserID, from, to)
+	if err != nil {
+		sh.Logger.Printf("ERROR: updating training load: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	cached, err := sh.LoadStore.ListLoadDays(principal.UserID, from, to)
+	if err != nil {
+		sh.Logger.Printf("ERROR: listing training load: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	byDay := make(map[time.Time]*store.LoadDay, len(cached)+len(computed))
+	for _, day := range append(cached, computed...) {
+		byDay[day.Day.UTC()] = day
+	}
+
+	// Days missing from both came before any training
+	days := []loadDay{}
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		day, ok := byDay[date]
+		if !ok {
+			day = &store.LoadDay{Day: date}
+		}
+		days = append(days, loadDay{
+			Date:    date.Format(time.DateOnly),
+			Load:    roundTo(day.Load, 1),
+			ACWR:    training.ACWR(day),
+			Fitness: roundTo(day.Fitness, 1),
+			Fatigue: roundTo(day.Fatigue, 1),
+			Form:    roundTo(training.Form(day), 1),
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"days": days})
+}
+
+// updateLoadDays brings the cached load model up to the end of the day to,
+// computing only the days after the last one cached. A user's first days
+// start at their first workout, or at from if that's earlier. The days it
+// computes are returned, as they aren't cached when a workout changed in
+// the meantime.
+func (sh *StatsHandler) updateLoadDays(userID int, from, to time.Time) ([]*store.LoadDay, error) {
+	latest, version, err := sh.LoadStore.GetLatestLoadDay(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := from
+	if latest != nil {
+		if !latest.Day.Before(to) {
+			return nil, nil
+		}
+		start = latest.Day.UTC().AddDate(0, 0, 1)
+	} else {
+		first, err := sh.WorkoutStore.GetFirstWorkoutTime(userID)
+		if err != nil {
+			return nil, err
+		}
+		if first != nil && first.Before(start) {
+			start = first.UTC().Truncate(24 * time.Hour)
+		}
+	}
+
+	workouts, err := sh.WorkoutStore.ListWorkoutsBetween(userID, start, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	loads := make(map[time.Time]float64)
+	for _, workout := range workouts {
+		loggedAt := workout.CreatedAt
+		if workout.StartedAt != nil {
+			loggedAt = *workout.StartedAt
+		}
+		loads[loggedAt.UTC().Truncate(24*time.Hour)] += training.WorkoutLoad(workout)
+	}
+
+	days := []*store.LoadDay{}
+	previous := latest
+	for date := start; !date.After(to); date = date.AddDate(0, 0, 1) {
+		previous = training.NextLoadDay(previous, date, loads[date])
+		days = append(days, previous)
+	}
+
+	_, err = sh.LoadStore.SaveLoadDays(userID, version, days)
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
@@ -0,0 +1,426 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+const totpIssuer = "Workout Tracker"
+
+// secondFactor is the part of a request proving possession of the second
+// factor: an authenticator code or, failing that, a recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type loginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	secondFactor
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type disableTwoFactorRequest struct {
+	Password string `json:"password"`
+	secondFactor
+}
+
+func (sf secondFactor) validate() error {
+	if (sf.Code == "") == (sf.RecoveryCode == "") {
+		return errors.New("either code or recovery_code is required")
+	}
+	return nil
+}
+
+// verifySecondFactor checks and consumes a TOTP or recovery code, returning
+// which one was used.
+func (uh *UserHandler) verifySecondFactor(twoFactor *store.TwoFactor, sf secondFactor) (string, bool, error) {
+	if sf.RecoveryCode != "" {
+		ok, err := uh.TwoFactorStore.UseRecoveryCode(twoFactor.UserID, sf.RecoveryCode)
+		return "recovery_code", ok, err
+	}
+
+	step, ok := auth.ValidateTOTP(twoFactor.Secret, sf.Code, time.Now())
+	if !ok {
+		return "totp", false, nil
+	}
+
+	ok, err := uh.TwoFactorStore.UseTOTPStep(twoFactor.UserID, step)
+	return "totp", ok, err
+}
+
+// userLockoutKeys returns the lockout keys for a request proving something
+// about a known account. The account has a single lockout, shared by the
+// password and second factor steps of logging in and by the checks of a
+// signed in user's password or code.
+func userLockoutKeys(r *http.Request, userID int) (string, string) {
+	return "user:" + strconv.Itoa(userID), "ip:" + utils.ClientIP(r)
+}
+
+// lockedOut writes a 429 response and returns true when the account or IP is
+// locked out.
+func (uh *UserHandler) lockedOut(w http.ResponseWriter, accountKey, ipKey string) bool {
+	lockedFor := max(uh.AccountGuard.LockedFor(accountKey), uh.IPGuard.LockedFor(ipKey))
+	if lockedFor <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(lockedFor.Round(time.Second).Seconds())))
+	utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many failed attempts, try again later"})
+	return true
+}
+
+// recordVerificationFailure counts a wrong password or code, given by an
+// already signed in user, towards the lockouts.
+func (uh *UserHandler) recordVerificationFailure(r *http.Request, user *store.User, accountKey, ipKey, action string) {
+	uh.AccountGuard.Fail(accountKey)
+	uh.IPGuard.Fail(ipKey)
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+	})
+
+	if uh.AccountGuard.LockedFor(accountKey) > 0 {
+		uh.Notifier.SecurityEvent(r, user.ID, "account_locked")
+	}
+}
+
+func (uh *UserHandler) HandleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req loginMFARequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding login MFA: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.MFAToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mfa_token is required"})
+		return
+	}
+	err = req.validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user, err := uh.UserStore.GetUserForToken(store.ScopeMFA, req.MFAToken)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting user for MFA token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	accountKey, ipKey := userLockoutKeys(r, user.ID)
+	if uh.lockedOut(w, accountKey, ipKey) {
+		return
+	}
+
+	twoFactor, err := uh.TwoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting two-factor enrollment %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !twoFactor.Enabled() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	method, ok, err := uh.verifySecondFactor(twoFactor, req.secondFactor)
+	if err != nil {
+		uh.Logger.Printf("ERROR: verifying second factor %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		uh.recordLoginFailure(r, user, user.Username, accountKey, ipKey)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	uh.AccountGuard.Succeed(accountKey)
+
+	// Only one request gets to spend the challenge
+	userID, err := uh.TokenStore.ConsumeToken(store.ScopeMFA, req.MFAToken)
+	if err != nil {
+		uh.Logger.Printf("ERROR: consuming MFA token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if userID != user.ID {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	err = uh.TokenStore.DeleteAllForUser(store.ScopeMFA, user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: deleting MFA tokens %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user.DisabledAt != nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your account has been disabled"})
+		return
+	}
+
+	tokenString, err := uh.issueToken(r, user)
+	if err != nil {
+		uh.Logger.Printf("ERROR: generating token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.login",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		Metadata:   map[string]any{"mfa": method},
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user, "token": tokenString})
+}
+
+func (uh *UserHandler) HandleGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	twoFactor, err := uh.TwoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting two-factor enrollment %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	remaining := 0
+	if twoFactor.Enabled() {
+		remaining, err = uh.TwoFactorStore.CountRecoveryCodes(user.ID)
+		if err != nil {
+			uh.Logger.Printf("ERROR: counting recovery codes %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"enabled": twoFactor.Enabled(), "recovery_codes_remaining": remaining})
+}
+
+func (uh *UserHandler) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		uh.Logger.Printf("ERROR: generating TOTP secret %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.TwoFactorStore.SetPendingSecret(user.ID, secret)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		uh.Logger.Printf("ERROR: saving TOTP secret %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (uh *UserHandler) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req confirmTOTPRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding confirm TOTP: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return
+	}
+
+	twoFactor, err := uh.TwoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting two-factor enrollment %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if twoFactor == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "start enrollment with POST /me/2fa/totp first"})
+		return
+	}
+	if twoFactor.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	// A stolen session mustn't be able to guess codes without limit
+	accountKey, ipKey := userLockoutKeys(r, user.ID)
+	if uh.lockedOut(w, accountKey, ipKey) {
+		return
+	}
+
+	_, ok, err := uh.verifySecondFactor(twoFactor, secondFactor{Code: req.Code})
+	if err != nil {
+		uh.Logger.Printf("ERROR: verifying TOTP code %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		uh.recordVerificationFailure(r, user, accountKey, ipKey, "user.2fa_enable_failed")
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	uh.AccountGuard.Succeed(accountKey)
+
+	codes, hashes, err := store.GenerateRecoveryCodes()
+	if err != nil {
+		uh.Logger.Printf("ERROR: generating recovery codes %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.TwoFactorStore.EnableTwoFactor(user.ID, hashes)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		uh.Logger.Printf("ERROR: enabling two-factor authentication %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     "user.2fa_enable",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+	})
+	uh.Notifier.SecurityEvent(r, user.ID, "two_factor_enabled")
+
+	// Recovery codes are only ever shown here
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": codes})
+}
+
+func (uh *UserHandler) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req disableTwoFactorRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding disable two-factor: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password is required"})
+		return
+	}
+	err = req.validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	twoFactor, err := uh.TwoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting two-factor enrollment %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !twoFactor.Enabled() {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "two-factor authentication is not enabled"})
+		return
+	}
+
+	// Wrong passwords and codes count towards the login lockouts, so a
+	// stolen session can't be used to guess them
+	accountKey, ipKey := userLockoutKeys(r, user.ID)
+	if uh.lockedOut(w, accountKey, ipKey) {
+		return
+	}
+
+	matches, err := user.PasswordHash.Matches(req.Password)
+	if err != nil {
+		uh.Logger.Printf("ERROR: matching password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !matches {
+		uh.recordVerificationFailure(r, user, accountKey, ipKey, "user.2fa_disable_failed")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
+	_, ok, err := uh.verifySecondFactor(twoFactor, req.secondFactor)
+	if err != nil {
+		uh.Logger.Printf("ERROR: verifying second factor %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		uh.recordVerificationFailure(r, user, accountKey, ipKey, "user.2fa_disable_failed")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	uh.AccountGuard.Succeed(accountKey)
+
+	err = uh.TwoFactorStore.DisableTwoFactor(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: disabling two-factor authentication %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     "user.2fa_disable",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+	})
+	uh.Notifier.SecurityEvent(r, user.ID, "two_factor_disabled")
+
+	w.WriteHeader(http.StatusNoContent)
+}
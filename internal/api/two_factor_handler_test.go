@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/notify"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorChangesCountTowardsLockout(t *testing.T) {
+	confirmed := time.Now()
+	tests := []struct {
+		name      string
+		enrolled  *store.TwoFactor
+		handle    func(*UserHandler) http.HandlerFunc
+		body      string
+		wantWrong int
+	}{
+		{
+			name:      "disable with a wrong password",
+			enrolled:  &store.TwoFactor{UserID: 7, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &confirmed},
+			handle:    func(uh *UserHandler) http.HandlerFunc { return uh.HandleDisableTwoFactor },
+			body:      `{"password": "not-my-password", "code": "000000"}`,
+			wantWrong: http.StatusUnauthorized,
+		},
+		{
+			name:      "confirm with a wrong code",
+			enrolled:  &store.TwoFactor{UserID: 7, Secret: "JBSWY3DPEHPK3PXP"},
+			handle:    func(uh *UserHandler) http.HandlerFunc { return uh.HandleConfirmTOTP },
+			body:      `{"code": "not-a-code"}`,
+			wantWrong: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &store.User{ID: 7, Username: "john", Email: "john@example.com", Activated: true}
+			require.NoError(t, user.PasswordHash.Set("correct horse battery"))
+
+			auditor, auditStore := newTestAuditor()
+			notifications := &fakeNotificationStore{}
+			uh := NewUserHandler(
+				&fakeUserStore{users: map[int]*store.User{user.ID: user}},
+				&fakeSessionStore{}, &fakeTokenStore{},
+				&fakeTwoFactorStore{enrollments: map[int]*store.TwoFactor{user.ID: tt.enrolled}},
+				nil, auth.NewPasswordPolicy(8), nil,
+				notify.NewNotifier(notifications, nil, discardLogger),
+				auditor, discardLogger,
+			)
+
+			send := func() *httptest.ResponseRecorder {
+				r := asUser(httptest.NewRequest(http.MethodPost, "/me/2fa", strings.NewReader(tt.body)), user.ID)
+				rec := httptest.NewRecorder()
+				tt.handle(uh)(rec, r)
+				return rec
+			}
+
+			for i := 0; i < 5; i++ {
+				assert.Equal(t, tt.wantWrong, send().Code, "attempt %d", i+1)
+			}
+
+			rec := send()
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+			assert.Len(t, notifications.notifications, 1, "the owner hears about the lockout once")
+			assert.Len(t, auditStore.actions(), 5)
+		})
+	}
+}
+
+func TestPasswordsAndCodesShareOneLockout(t *testing.T) {
+	confirmed := time.Now()
+	user := &store.User{ID: 7, Username: "john", Email: "john@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("correct horse battery"))
+
+	tokens := &fakeTokenStore{}
+	auditor, _ := newTestAuditor()
+	uh := NewUserHandler(
+		&fakeUserStore{users: map[int]*store.User{user.ID: user}, tokens: tokens},
+		&fakeSessionStore{}, tokens,
+		&fakeTwoFactorStore{enrollments: map[int]*store.TwoFactor{user.ID: {UserID: 7, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &confirmed}}},
+		nil, auth.NewPasswordPolicy(8), nil,
+		notify.NewNotifier(&fakeNotificationStore{}, nil, discardLogger),
+		auditor, discardLogger,
+	)
+	send := func(handler http.HandlerFunc, body string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, send(uh.HandleLoginUser, `{"username": "john", "password": "wrong password"}`))
+	}
+
+	// The right password alone doesn't clear the earlier failures
+	assert.Equal(t, http.StatusOK, send(uh.HandleLoginUser, `{"username": "john", "password": "correct horse battery"}`))
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusUnauthorized, send(uh.HandleLoginMFA, `{"mfa_token": "token-mfa", "code": "000000"}`))
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, send(uh.HandleLoginUser, `{"username": "john", "password": "correct horse battery"}`))
+	assert.Equal(t, http.StatusTooManyRequests, send(uh.HandleLoginMFA, `{"mfa_token": "token-mfa", "code": "000000"}`))
+}
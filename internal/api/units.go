@@ -0,0 +1,277 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/training"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+// unitsHeader lets a client pick the units of a single request, like the
+// units query parameter.
+const unitsHeader = "X-Units"
+
+// Largest values an entry can store.
+const (
+	maxWeightKg       = 99999.999
+	maxDistanceKm     = 999999.999
+	maxElevationGainM = 999999.9
+	minHeartRate      = 20
+	maxHeartRate      = 250
+	minRPE            = 1
+	maxRPE            = 10
+)
+
+// unitSystem returns the unit system the request reads and writes: the
+// units query parameter or X-Units header when given, otherwise the
+// preference of the user, or metric with no user. It writes the response
+// itself and returns false when the request can't proceed.
+func unitSystem(w http.ResponseWriter, r *http.Request, userStore store.UserStore, logger *log.Logger, userID int) (string, bool) {
+	system := r.URL.Query().Get("units")
+	if system == "" {
+		system = r.Header.Get(unitsHeader)
+	}
+	if system != "" {
+		if !units.ValidSystem(system) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "units must be metric or imperial"})
+			return "", false
+		}
+		return system, true
+	}
+
+	if userID == 0 {
+		return units.Metric, true
+	}
+
+	user, err := userStore.GetUserByID(userID)
+	if err != nil {
+		logger.Printf("ERROR: getting user for units: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return "", false
+	}
+	if user == nil || user.UnitSystem == "" {
+		return units.Metric, true
+	}
+	return user.UnitSystem, true
+}
+
+// entriesFromUnits validates entries and converts them to the units they're
+// stored in. Weights, distances and elevation are in the system's units
+// unless their entry names a weight_unit, distance_unit or elevation_unit;
+// splits share the units of their entry.
+func entriesFromUnits(entries []store.WorkoutEntry, system string) error {
+	for i := range entries {
+		entry := &entries[i]
+		if err := weightFromUnits(entry, system); err != nil {
+			return err
+		}
+		if err := distanceFromUnits(entry, system); err != nil {
+			return err
+		}
+		// Half points, like "8.5", are as fine as RPE gets
+		if entry.RPE != nil && (*entry.RPE < minRPE || *entry.RPE > maxRPE || math.Trunc(*entry.RPE*2) != *entry.RPE*2) {
+			return fmt.Errorf("rpe of %s must be between %d and %d, in steps of 0.5", entry.ExerciseName, minRPE, maxRPE)
+		}
+	}
+	return nil
+}
+
+func weightFromUnits(entry *store.WorkoutEntry, system string) error {
+	unit := entry.WeightUnit
+	entry.WeightUnit = ""
+	if entry.Weight == nil {
+		return nil
+	}
+
+	var kg float64
+	switch unit {
+	case "":
+		kg = units.ToKilograms(*entry.Weight, system)
+	case units.Kilograms:
+		kg = *entry.Weight
+	case units.Pounds:
+		kg = *entry.Weight * units.KilogramsPerPound
+	default:
+		return fmt.Errorf("weight_unit of %s must be kg or lb", entry.ExerciseName)
+	}
+
+	if kg < 0 || kg > maxWeightKg {
+		return fmt.Errorf("weight of %s must be between 0 and %.0f kg", entry.ExerciseName, maxWeightKg)
+	}
+	entry.Weight = &kg
+	return nil
+}
+
+// distanceFromUnits validates the cardio fields of an entry and converts
+// its distance and elevation, and those of its splits, to kilometres and
+// metres.
+func distanceFromUnits(entry *store.WorkoutEntry, system string) error {
+	distanceUnit, elevationUnit := entry.DistanceUnit, entry.ElevationUnit
+	entry.DistanceUnit, entry.ElevationUnit = "", ""
+	// Derived when the entry is presented
+	entry.Pace, entry.Speed = nil, nil
+
+	if entry.Activity != nil && !store.ValidActivity(*entry.Activity) {
+		return fmt.Errorf("activity of %s must be run, ride, row, swim, walk or hike", entry.ExerciseName)
+	}
+	if !validHeartRate(entry.AvgHeartRate) || !validHeartRate(entry.MaxHeartRate) {
+		return fmt.Errorf("heart rates of %s must be between %d and %d bpm", entry.ExerciseName, minHeartRate, maxHeartRate)
+	}
+
+	if entry.Distance == nil {
+		if entry.ElevationGain != nil || len(entry.Splits) > 0 {
+			return fmt.Errorf("%s needs a distance for elevation gain and splits", entry.ExerciseName)
+		}
+		return nil
+	}
+	if entry.DurationSeconds == nil || *entry.DurationSeconds <= 0 || entry.Reps != nil {
+		return fmt.Errorf("%s needs duration_seconds instead of reps to record a distance", entry.ExerciseName)
+	}
+
+	toKm, ok := distanceConverter(distanceUnit, system)
+	if !ok {
+		return fmt.Errorf("distance_unit of %s must be km or mi", entry.ExerciseName)
+	}
+	toM, ok := elevationConverter(elevationUnit, system)
+	if !ok {
+		return fmt.Errorf("elevation_unit of %s must be m or ft", entry.ExerciseName)
+	}
+
+	km := toKm(*entry.Distance)
+	if km <= 0 || km > maxDistanceKm {
+		return fmt.Errorf("distance of %s must be greater than 0 and at most %.0f km", entry.ExerciseName, maxDistanceKm)
+	}
+	entry.Distance = &km
+
+	if entry.ElevationGain != nil {
+		m := toM(*entry.ElevationGain)
+		if m < 0 || m > maxElevationGainM {
+			return fmt.Errorf("elevation_gain of %s must be between 0 and %.0f m", entry.ExerciseName, maxElevationGainM)
+		}
+		entry.ElevationGain = &m
+	}
+
+	for i := range entry.Splits {
+		split := &entry.Splits[i]
+		split.Pace = nil
+		split.Distance = toKm(split.Distance)
+		if split.Distance <= 0 || split.Distance > maxDistanceKm || split.DurationSeconds <= 0 {
+			return fmt.Errorf("splits of %s need a positive distance and duration_seconds", entry.ExerciseName)
+		}
+		if !validHeartRate(split.AvgHeartRate) {
+			return fmt.Errorf("heart rates of %s must be between %d and %d bpm", entry.ExerciseName, minHeartRate, maxHeartRate)
+		}
+		if split.ElevationGain != nil {
+			m := toM(*split.ElevationGain)
+			if m < 0 || m > maxElevationGainM {
+				return fmt.Errorf("elevation_gain of %s must be between 0 and %.0f m", entry.ExerciseName, maxElevationGainM)
+			}
+			split.ElevationGain = &m
+		}
+	}
+	return nil
+}
+
+// distanceConverter returns the conversion to kilometres from the named
+// unit, or from the system's unit when none is named.
+func distanceConverter(unit, system string) (func(float64) float64, bool) {
+	switch unit {
+	case "":
+		return func(distance float64) float64 { return units.ToKilometers(distance, system) }, true
+	case units.Kilometers:
+		return func(distance float64) float64 { return units.ToKilometers(distance, units.Metric) }, true
+	case units.Miles:
+		return func(distance float64) float64 { return units.ToKilometers(distance, units.Imperial) }, true
+	}
+	return nil, false
+}
+
+// elevationConverter returns the conversion to metres from the named unit,
+// or from the system's unit when none is named.
+func elevationConverter(unit, system string) (func(float64) float64, bool) {
+	switch unit {
+	case "":
+		return func(elevation float64) float64 { return units.ToMeters(elevation, system) }, true
+	case units.Meters:
+		return func(elevation float64) float64 { return units.ToMeters(elevation, units.Metric) }, true
+	case units.Feet:
+		return func(elevation float64) float64 { return units.ToMeters(elevation, units.Imperial) }, true
+	}
+	return nil, false
+}
+
+func validHeartRate(bpm *int) bool {
+	return bpm == nil || (*bpm >= minHeartRate && *bpm <= maxHeartRate)
+}
+
+// presentWorkout converts a stored workout to the system's units. The
+// workout must not be saved afterwards.
+func presentWorkout(workout *store.Workout, system string) {
+	// Entries may share their backing array with a copy kept for auditing
+	entries := make([]store.WorkoutEntry, len(workout.Entries))
+	copy(entries, workout.Entries)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Weight != nil {
+			weight := roundTo(units.FromKilograms(*entry.Weight, system), 2)
+			entry.Weight = &weight
+			entry.WeightUnit = units.WeightUnit(system)
+		}
+		if entry.Distance != nil {
+			presentDistance(entry, system)
+		}
+	}
+	if len(workout.Entries) > 0 {
+		workout.Entries = entries
+	}
+
+	if workout.Volume != nil {
+		volume := roundTo(units.FromKilograms(*workout.Volume, system), 2)
+		workout.Volume = &volume
+	}
+}
+
+// presentDistance converts the distance and elevation of a cardio entry and
+// its splits to the system's units and derives their pace and speed.
+func presentDistance(entry *store.WorkoutEntry, system string) {
+	distance := units.FromKilometers(*entry.Distance, system)
+	entry.DistanceUnit = units.DistanceUnit(system)
+	if entry.DurationSeconds != nil && *entry.DurationSeconds > 0 {
+		pace := training.Pace(distance, *entry.DurationSeconds)
+		speed := training.Speed(distance, *entry.DurationSeconds)
+		entry.Pace, entry.Speed = &pace, &speed
+	}
+	distance = roundTo(distance, 3)
+	entry.Distance = &distance
+
+	if entry.ElevationGain != nil {
+		elevation := roundTo(units.FromMeters(*entry.ElevationGain, system), 1)
+		entry.ElevationGain = &elevation
+		entry.ElevationUnit = units.ElevationUnit(system)
+	}
+
+	splits := make([]store.Split, len(entry.Splits))
+	for i, split := range entry.Splits {
+		distance := units.FromKilometers(split.Distance, system)
+		pace := training.Pace(distance, split.DurationSeconds)
+		split.Distance, split.Pace = roundTo(distance, 3), &pace
+		if split.ElevationGain != nil {
+			elevation := roundTo(units.FromMeters(*split.ElevationGain, system), 1)
+			split.ElevationGain = &elevation
+		}
+		splits[i] = split
+	}
+	if len(entry.Splits) > 0 {
+		entry.Splits = splits
+	}
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
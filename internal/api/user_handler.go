@@ -1,15 +1,23 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
 	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/jobs"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/notify"
 	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
 	"github.com/LikhithMar14/workout-tracker/internal/utils"
 )
 
@@ -26,15 +34,142 @@ type loginUserRequest struct {
 	Password string `json:"password"`
 }
 
+type updateMeRequest struct {
+	Username   *string `json:"username"`
+	Email      *string `json:"email"`
+	Bio        *string `json:"bio"`
+	UnitSystem *string `json:"unit_system"`
+	// Zero clears a heart rate
+	MaxHeartRate     *int `json:"max_heart_rate"`
+	RestingHeartRate *int `json:"resting_heart_rate"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type deleteMeRequest struct {
+	Password string `json:"password"`
+}
+
+type activateUserRequest struct {
+	Token string `json:"token"`
+}
+
+type confirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+const mfaTokenTTL = 5 * time.Minute
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
 type UserHandler struct {
-	UserStore store.UserStore
-	Logger    *log.Logger
+	UserStore      store.UserStore
+	SessionStore   store.SessionStore
+	TokenStore     store.TokenStore
+	TwoFactorStore store.TwoFactorStore
+	Authenticator  auth.Authenticator
+	PasswordPolicy *auth.PasswordPolicy
+	JobStore       store.JobStore
+	AccountGuard   *auth.LoginGuard
+	IPGuard        *auth.LoginGuard
+	Notifier       *notify.Notifier
+	Auditor        *audit.Auditor
+	Logger         *log.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, sessionStore store.SessionStore, tokenStore store.TokenStore, twoFactorStore store.TwoFactorStore, authenticator auth.Authenticator, passwordPolicy *auth.PasswordPolicy, jobStore store.JobStore, notifier *notify.Notifier, auditor *audit.Auditor, logger *log.Logger) *UserHandler {
 	return &UserHandler{
-		UserStore: userStore,
-		Logger:    logger,
+		UserStore:      userStore,
+		SessionStore:   sessionStore,
+		TokenStore:     tokenStore,
+		TwoFactorStore: twoFactorStore,
+		Authenticator:  authenticator,
+		PasswordPolicy: passwordPolicy,
+		JobStore:       jobStore,
+		// 5 wrong passwords lock an account for a minute, doubling up to an hour.
+		// An IP gets more leeway since many users can share one address.
+		AccountGuard: auth.NewLoginGuard(5, time.Minute, time.Hour),
+		IPGuard:      auth.NewLoginGuard(20, time.Minute, time.Hour),
+		Notifier:     notifier,
+		Auditor:      auditor,
+		Logger:       logger,
+	}
+}
+
+// sendTokenEmail queues an email with a new token of the scope for the job
+// runner, so slow SMTP servers don't hold up the response and failed sends
+// are retried. The runner creates the token when it sends the email.
+func (uh *UserHandler) sendTokenEmail(userID int, scope string) {
+	job, err := store.NewJob(store.JobSendEmail, jobs.EmailPayload{UserID: userID, Scope: scope})
+	if err == nil {
+		err = uh.JobStore.EnqueueJob(job)
+	}
+	if err != nil {
+		uh.Logger.Printf("ERROR: queueing %s email: %v", scope, err)
+	}
+}
+
+// issueToken starts a new session for the user and returns a signed token bound to it.
+func (uh *UserHandler) issueToken(r *http.Request, user *store.User) (string, error) {
+	session := &store.Session{
+		UserID:    user.ID,
+		UserAgent: r.UserAgent(),
+		IP:        utils.ClientIP(r),
+		ExpiresAt: time.Now().Add(auth.TokenTTL),
+	}
+	err := uh.SessionStore.CreateSession(session)
+	if err != nil {
+		return "", err
+	}
+
+	return uh.signToken(user, session.ID)
+}
+
+func (uh *UserHandler) signToken(user *store.User, sessionID int64) (string, error) {
+	claims := auth.NewCustomClaims(user.ID, sessionID, user.Email, user.Role, auth.Issuer, auth.Audience, auth.TokenTTL)
+	return uh.Authenticator.GenerateToken(claims)
+}
+
+// redeemToken consumes a token with the given scope and returns its owner,
+// or nil when the token is invalid, expired or already used.
+func (uh *UserHandler) redeemToken(scope, plaintextToken string) (*store.User, error) {
+	userID, err := uh.TokenStore.ConsumeToken(scope, plaintextToken)
+	if err != nil || userID == 0 {
+		return nil, err
+	}
+	return uh.UserStore.GetUserByID(userID)
+}
+
+// recordLoginFailure counts a failed login towards the lockouts and audits it.
+func (uh *UserHandler) recordLoginFailure(r *http.Request, user *store.User, identifier, accountKey, ipKey string) {
+	uh.AccountGuard.Fail(accountKey)
+	uh.IPGuard.Fail(ipKey)
+
+	entry := audit.Entry{
+		Action:     "user.login_failed",
+		TargetType: "user",
+		Metadata:   map[string]any{"identifier": identifier},
+	}
+	if user != nil {
+		entry.TargetID = int64(user.ID)
+	}
+	uh.Auditor.Record(r, entry)
+
+	// Tell the owner the moment their account gets locked, not on every retry
+	if user != nil && uh.AccountGuard.LockedFor(accountKey) > 0 {
+		uh.Notifier.SecurityEvent(r, user.ID, "account_locked")
 	}
 }
 
@@ -51,32 +186,22 @@ func (uh *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
 		return errors.New("email is required")
 	}
 
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	if !emailRegex.MatchString(req.Email) {
 		return errors.New("invalid email format")
 	}
 
-	if req.Password == "" {
-		return errors.New("password is required")
-	}
-
-	return nil
+	return uh.PasswordPolicy.Validate(req.Password, req.Username, req.Email)
 }
 func (uh *UserHandler) validateLoginRequest(req *loginUserRequest) error {
-	if req.Username == "" {
-		return errors.New("username is required")
+	if req.Username == "" && req.Email == "" {
+		return errors.New("username or email is required")
 	}
 
 	if len(req.Username) > 50 {
 		return errors.New("username cannot be greater than 50 characters")
 	}
 
-	if req.Email == "" {
-		return errors.New("email is required")
-	}
-
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(req.Email) {
+	if req.Username == "" && !emailRegex.MatchString(req.Email) {
 		return errors.New("invalid email format")
 	}
 
@@ -120,28 +245,87 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 	}
 
 	err = uh.UserStore.CreateUser(user)
+	if errors.Is(err, store.ErrDuplicateUsername) || errors.Is(err, store.ErrDuplicateEmail) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		uh.Logger.Printf("ERROR: creating user %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	// Create JWT claims using the new function
-	claims := auth.NewCustomClaims(user.ID, user.Email, "workout-tracker-app", "workout-tracker-users", 24*time.Hour)
+	uh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.register",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		After:      user,
+	})
+
+	uh.sendTokenEmail(user.ID, store.ScopeActivation)
+
+	// The account can't log in until the emailed activation token is redeemed
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"user": user})
+}
+
+// completeLogin finishes a login once the first factor has checked out,
+// whether that was a password or an identity provider. Users with two-factor
+// authentication only get a short-lived challenge; the session is issued by
+// HandleLoginMFA once the second factor checks out. metadata is added to the
+// audit events.
+func (uh *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User, metadata map[string]any) {
+	twoFactor, err := uh.TwoFactorStore.GetTwoFactor(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting two-factor enrollment %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if twoFactor.Enabled() {
+		challenge, err := uh.TokenStore.CreateToken(user.ID, mfaTokenTTL, store.ScopeMFA)
+		if err != nil {
+			uh.Logger.Printf("ERROR: creating MFA token %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
 
-	authenticator := auth.NewJWTAuthenticator("mysecret", "workout-tracker-users", "workout-tracker-app")
-	tokenString, err := authenticator.GenerateToken(claims)
+		uh.Auditor.Record(r, audit.Entry{
+			ActorID:    &user.ID,
+			Action:     "user.login_mfa_required",
+			TargetType: "user",
+			TargetID:   int64(user.ID),
+			Metadata:   metadata,
+		})
+
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"mfa_required": true, "mfa_token": challenge.Plaintext, "expiry": challenge.Expiry})
+		return
+	}
+
+	// Failed attempts are only cleared once the login is complete. Clearing
+	// them after the password would let wrong codes be spread between right
+	// passwords without ever locking the account.
+	accountKey, _ := userLockoutKeys(r, user.ID)
+	uh.AccountGuard.Succeed(accountKey)
+
+	tokenString, err := uh.issueToken(r, user)
 	if err != nil {
 		uh.Logger.Printf("ERROR: generating token %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
-		"user":  user,
-		"token": tokenString,
+	uh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.login",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		Metadata:   metadata,
 	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user, "token": tokenString})
 }
+
 func (uh *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) {
 	var req loginUserRequest
 
@@ -157,16 +341,50 @@ func (uh *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
-	user, err := uh.UserStore.GetUserByUsername(req.Username)
 
+	// Either identifier works; the username wins if both are sent
+	var user *store.User
+	identifier := req.Username
+	if identifier != "" {
+		user, err = uh.UserStore.GetUserByUsername(identifier)
+	} else {
+		identifier = req.Email
+		user, err = uh.UserStore.GetUserByEmail(identifier)
+	}
 	if err != nil {
-		uh.Logger.Printf("ERROR: getting user by username %v", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		uh.Logger.Printf("ERROR: getting user for login %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// A known account has one lockout whichever identifier was typed, so
+	// guessing by username and by email doesn't double the attempts. Only
+	// unknown identifiers are keyed by what was typed.
+	accountKey, ipKey := "login:"+strings.ToLower(identifier), "ip:"+utils.ClientIP(r)
+	if user != nil {
+		accountKey, ipKey = userLockoutKeys(r, user.ID)
+	}
+
+	lockedFor := max(uh.AccountGuard.LockedFor(accountKey), uh.IPGuard.LockedFor(ipKey))
+	if lockedFor > 0 {
+		entry := audit.Entry{
+			Action:     "user.login_locked",
+			TargetType: "user",
+			Metadata:   map[string]any{"identifier": identifier, "locked_for_seconds": int(lockedFor.Seconds())},
+		}
+		if user != nil {
+			entry.TargetID = int64(user.ID)
+		}
+		uh.Auditor.Record(r, entry)
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockedFor.Round(time.Second).Seconds())))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many failed login attempts, try again later"})
 		return
 	}
 
 	if user == nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		store.CompareDummyPassword(req.Password)
+		uh.recordLoginFailure(r, nil, identifier, accountKey, ipKey)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
 		return
 	}
 
@@ -177,19 +395,630 @@ func (uh *UserHandler) HandleLoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !matches {
+		uh.recordLoginFailure(r, user, identifier, accountKey, ipKey)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
 		return
 	}
 
-	// Create JWT claims using the new function
-	claims := auth.NewCustomClaims(user.ID, user.Email, "workout-tracker-app", "workout-tracker-users", 24*time.Hour)
+	if user.PasswordHash.Rehashed() {
+		err = uh.UserStore.UpdatePassword(user)
+		if err != nil {
+			uh.Logger.Printf("ERROR: saving rehashed password %v", err)
+		}
+	}
+
+	if !user.Activated || user.DisabledAt != nil {
+		reason, message := "not_activated", "your account must be activated before logging in"
+		if user.DisabledAt != nil {
+			reason, message = "disabled", "your account has been disabled"
+		}
+
+		uh.Auditor.Record(r, audit.Entry{
+			ActorID:    &user.ID,
+			Action:     "user.login_denied",
+			TargetType: "user",
+			TargetID:   int64(user.ID),
+			Metadata:   map[string]any{"reason": reason},
+		})
+
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": message})
+		return
+	}
+
+	uh.completeLogin(w, r, user, nil)
+}
+
+func (uh *UserHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+	sessionID := principal.SessionID
+
+	err = uh.SessionStore.ExtendSession(sessionID, time.Now().Add(auth.TokenTTL))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		uh.Logger.Printf("ERROR: extending session %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
 
-	authenticator := auth.NewJWTAuthenticator("mysecret", "workout-tracker-users", "workout-tracker-app")
-	tokenString, err := authenticator.GenerateToken(claims)
+	tokenString, err := uh.signToken(user, sessionID)
 	if err != nil {
 		uh.Logger.Printf("ERROR: generating token %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user, "token": tokenString})
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     "session.refresh",
+		TargetType: "session",
+		TargetID:   sessionID,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"token": tokenString})
+}
+
+func (uh *UserHandler) validateUpdateMeRequest(req *updateMeRequest) error {
+	if req.Username != nil {
+		if *req.Username == "" {
+			return errors.New("username cannot be empty")
+		}
+		if len(*req.Username) > 50 {
+			return errors.New("username cannot be greater than 50 characters")
+		}
+	}
+
+	if req.Email != nil && !emailRegex.MatchString(*req.Email) {
+		return errors.New("invalid email format")
+	}
+
+	if req.UnitSystem != nil && !units.ValidSystem(*req.UnitSystem) {
+		return errors.New("unit_system must be metric or imperial")
+	}
+
+	if req.MaxHeartRate != nil && *req.MaxHeartRate != 0 && (*req.MaxHeartRate < 100 || *req.MaxHeartRate > 250) {
+		return errors.New("max_heart_rate must be between 100 and 250")
+	}
+
+	if req.RestingHeartRate != nil && *req.RestingHeartRate != 0 && (*req.RestingHeartRate < 20 || *req.RestingHeartRate > 120) {
+		return errors.New("resting_heart_rate must be between 20 and 120")
+	}
+
+	return nil
+}
+
+// currentUser loads the authenticated user, writing an error response and
+// returning nil when it cannot.
+func (uh *UserHandler) currentUser(w http.ResponseWriter, r *http.Request) *store.User {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return nil
+	}
+
+	user, err := uh.UserStore.GetUserByID(principal.UserID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting user by id %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return nil
+	}
+
+	return user
+}
+
+func (uh *UserHandler) HandleGetMe(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (uh *UserHandler) HandleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	before := *user
+
+	var req updateMeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding update user: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = uh.validateUpdateMeRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if req.Username != nil && *req.Username != user.Username {
+		existing, err := uh.UserStore.GetUserByUsername(*req.Username)
+		if err != nil {
+			uh.Logger.Printf("ERROR: getting user by username %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if existing != nil {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrDuplicateUsername.Error()})
+			return
+		}
+		user.Username = *req.Username
+	}
+
+	// A new email only takes effect once a token sent to it is confirmed, so
+	// an account can't claim an address it doesn't own. Asking for the
+	// current email back cancels a pending change.
+	emailChanged := false
+	if req.Email != nil && *req.Email == user.Email {
+		user.PendingEmail = nil
+	} else if req.Email != nil && (user.PendingEmail == nil || *req.Email != *user.PendingEmail) {
+		existing, err := uh.UserStore.GetUserByEmail(*req.Email)
+		if err != nil {
+			uh.Logger.Printf("ERROR: getting user by email %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if existing != nil {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrDuplicateEmail.Error()})
+			return
+		}
+		user.PendingEmail = req.Email
+		emailChanged = true
+	}
+
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+
+	if req.UnitSystem != nil {
+		user.UnitSystem = *req.UnitSystem
+	}
+
+	if req.MaxHeartRate != nil {
+		user.MaxHeartRate = req.MaxHeartRate
+		if *req.MaxHeartRate == 0 {
+			user.MaxHeartRate = nil
+		}
+	}
+
+	if req.RestingHeartRate != nil {
+		user.RestingHeartRate = req.RestingHeartRate
+		if *req.RestingHeartRate == 0 {
+			user.RestingHeartRate = nil
+		}
+	}
+
+	if user.MaxHeartRate != nil && user.RestingHeartRate != nil && *user.RestingHeartRate >= *user.MaxHeartRate {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "resting_heart_rate must be below max_heart_rate"})
+		return
+	}
+
+	// The lookups above can race with a concurrent signup, so the unique
+	// constraints still have the final say.
+	err = uh.UserStore.UpdateUser(user)
+	if errors.Is(err, store.ErrDuplicateUsername) || errors.Is(err, store.ErrDuplicateEmail) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		uh.Logger.Printf("ERROR: updating user %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     "user.update",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		Before:     &before,
+		After:      user,
+	})
+
+	// Only the latest requested address can be confirmed
+	if user.PendingEmail == nil || emailChanged {
+		err = uh.TokenStore.DeleteAllForUser(store.ScopeEmailChange, user.ID)
+		if err != nil {
+			uh.Logger.Printf("ERROR: deleting email change tokens %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	if emailChanged {
+		uh.sendTokenEmail(user.ID, store.ScopeEmailChange)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (uh *UserHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req changePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding change password: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "current_password and new_password are required"})
+		return
+	}
+
+	// A stolen session mustn't be able to guess the password without limit
+	accountKey, ipKey := userLockoutKeys(r, user.ID)
+	if uh.lockedOut(w, accountKey, ipKey) {
+		return
+	}
+
+	matches, err := user.PasswordHash.Matches(req.CurrentPassword)
+	if err != nil {
+		uh.Logger.Printf("ERROR: matching password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !matches {
+		uh.recordVerificationFailure(r, user, accountKey, ipKey, "user.password_change_failed")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
+	uh.AccountGuard.Succeed(accountKey)
+
+	err = uh.PasswordPolicy.Validate(req.NewPassword, user.Username, user.Email)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = user.PasswordHash.Set(req.NewPassword)
+	if err != nil {
+		uh.Logger.Printf("ERROR: hashing password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.UserStore.UpdatePassword(user)
+	if err != nil {
+		uh.Logger.Printf("ERROR: updating password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// Keep the caller signed in but log out every other device
+	var sessionID int64
+	if principal, err := middleware.GetPrincipalFromContext(r.Context()); err == nil {
+		sessionID = principal.SessionID
+	}
+	err = uh.SessionStore.RevokeUserSessions(user.ID, sessionID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: revoking sessions %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     "user.password_change",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+	})
+	uh.Notifier.SecurityEvent(r, user.ID, "password_changed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *UserHandler) HandleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	user := uh.currentUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req deleteMeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding delete user: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password is required"})
+		return
+	}
+
+	// A stolen session mustn't be able to guess the password without limit
+	accountKey, ipKey := userLockoutKeys(r, user.ID)
+	if uh.lockedOut(w, accountKey, ipKey) {
+		return
+	}
+
+	matches, err := user.PasswordHash.Matches(req.Password)
+	if err != nil {
+		uh.Logger.Printf("ERROR: matching password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !matches {
+		uh.recordVerificationFailure(r, user, accountKey, ipKey, "user.delete_failed")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
+	uh.AccountGuard.Succeed(accountKey)
+
+	err = uh.UserStore.DeleteUser(user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: deleting user %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		Action:     "user.delete",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		Before:     user,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req activateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding activate user: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	user, err := uh.redeemToken(store.ScopeActivation, req.Token)
+	if err != nil {
+		uh.Logger.Printf("ERROR: redeeming activation token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired activation token"})
+		return
+	}
+
+	user.Activated = true
+	err = uh.UserStore.UpdateUser(user)
+	if err != nil {
+		uh.Logger.Printf("ERROR: activating user %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.TokenStore.DeleteAllForUser(store.ScopeActivation, user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: deleting activation tokens %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.activate",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleConfirmEmailChange redeems an email change token, moving the account
+// to the address the token was sent to.
+func (uh *UserHandler) HandleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req confirmEmailChangeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding confirm email change: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	user, err := uh.redeemToken(store.ScopeEmailChange, req.Token)
+	if err != nil {
+		uh.Logger.Printf("ERROR: redeeming email change token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil || user.PendingEmail == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired email change token"})
+		return
+	}
+
+	before := *user
+	user.Email = *user.PendingEmail
+	user.PendingEmail = nil
+
+	// Someone may have signed up with the address since it was requested
+	err = uh.UserStore.UpdateUser(user)
+	if errors.Is(err, store.ErrDuplicateEmail) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		uh.Logger.Printf("ERROR: changing email %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.TokenStore.DeleteAllForUser(store.ScopeEmailChange, user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: deleting email change tokens %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.email_change",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+		Before:     &before,
+		After:      user,
+	})
+	uh.Notifier.SecurityEvent(r, user.ID, "email_changed")
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (uh *UserHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding password reset: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !emailRegex.MatchString(req.Email) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email format"})
+		return
+	}
+
+	user, err := uh.UserStore.GetUserByEmail(req.Email)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting user by email %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// Respond the same way whether or not the account exists so the endpoint
+	// can't be used to discover registered emails.
+	if user != nil && user.Activated {
+		uh.Auditor.Record(r, audit.Entry{
+			Action:     "user.password_reset_request",
+			TargetType: "user",
+			TargetID:   int64(user.ID),
+		})
+
+		uh.sendTokenEmail(user.ID, store.ScopePasswordReset)
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"message": "if that email belongs to an account, you will receive password reset instructions"})
+}
+
+func (uh *UserHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirmRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.Logger.Printf("ERROR: decoding reset password: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token and password are required"})
+		return
+	}
+
+	user, err := uh.UserStore.GetUserForToken(store.ScopePasswordReset, req.Token)
+	if err != nil {
+		uh.Logger.Printf("ERROR: getting user for token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired password reset token"})
+		return
+	}
+
+	err = uh.PasswordPolicy.Validate(req.Password, user.Username, user.Email)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// The token is only used up once the new password is acceptable, so a
+	// weak password doesn't cost the user their reset
+	userID, err := uh.TokenStore.ConsumeToken(store.ScopePasswordReset, req.Token)
+	if err != nil {
+		uh.Logger.Printf("ERROR: consuming password reset token %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if userID != user.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired password reset token"})
+		return
+	}
+
+	err = user.PasswordHash.Set(req.Password)
+	if err != nil {
+		uh.Logger.Printf("ERROR: hashing password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.UserStore.UpdatePassword(user)
+	if err != nil {
+		uh.Logger.Printf("ERROR: updating password %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.TokenStore.DeleteAllForUser(store.ScopePasswordReset, user.ID)
+	if err != nil {
+		uh.Logger.Printf("ERROR: deleting password reset tokens %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in
+	err = uh.SessionStore.RevokeUserSessions(user.ID, 0)
+	if err != nil {
+		uh.Logger.Printf("ERROR: revoking sessions %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	uh.Auditor.Record(r, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     "user.password_reset",
+		TargetType: "user",
+		TargetID:   int64(user.ID),
+	})
+	uh.Notifier.SecurityEvent(r, user.ID, "password_reset")
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "your password was successfully reset"})
 }
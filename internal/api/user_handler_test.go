@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/notify"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLoginTest returns a handler for john, whose password is
+// "correct horse battery".
+func newLoginTest(t *testing.T) (*UserHandler, *fakeNotificationStore) {
+	user := &store.User{ID: 7, Username: "john", Email: "john@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("correct horse battery"))
+
+	auditor, _ := newTestAuditor()
+	notifications := &fakeNotificationStore{}
+	uh := NewUserHandler(
+		&fakeUserStore{users: map[int]*store.User{user.ID: user}},
+		&fakeSessionStore{}, &fakeTokenStore{},
+		&fakeTwoFactorStore{enrollments: map[int]*store.TwoFactor{}},
+		auth.NewJWTAuthenticator("test-secret", auth.Audience, auth.Issuer), auth.NewPasswordPolicy(8), nil,
+		notify.NewNotifier(notifications, nil, discardLogger),
+		auditor, discardLogger,
+	)
+	return uh, notifications
+}
+
+func login(uh *UserHandler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	uh.HandleLoginUser(rec, httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(body)))
+	return rec
+}
+
+func TestLoginLockoutCoversEveryIdentifier(t *testing.T) {
+	uh, notifications := newLoginTest(t)
+
+	for i := 0; i < 5; i++ {
+		body := `{"username": "john", "password": "wrong password"}`
+		if i%2 == 1 {
+			body = `{"email": "john@example.com", "password": "wrong password"}`
+		}
+		assert.Equal(t, http.StatusUnauthorized, login(uh, body).Code, "attempt %d", i+1)
+	}
+
+	for _, identifier := range []string{`"username": "john"`, `"email": "john@example.com"`} {
+		rec := login(uh, fmt.Sprintf(`{%s, "password": "correct horse battery"}`, identifier))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, identifier)
+	}
+	assert.Len(t, notifications.notifications, 1)
+}
+
+func TestLoginLockoutForUnknownIdentifier(t *testing.T) {
+	uh, _ := newLoginTest(t)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login(uh, `{"username": "nobody", "password": "wrong password"}`).Code)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, login(uh, `{"username": "nobody", "password": "wrong password"}`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, login(uh, `{"username": "NOBODY", "password": "wrong password"}`).Code)
+}
+
+func TestPasswordChecksCountTowardsLockout(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(*UserHandler) http.HandlerFunc
+		body   string
+	}{
+		{
+			name:   "change password",
+			handle: func(uh *UserHandler) http.HandlerFunc { return uh.HandleChangePassword },
+			body:   `{"current_password": "wrong password", "new_password": "a brand new password"}`,
+		},
+		{
+			name:   "delete account",
+			handle: func(uh *UserHandler) http.HandlerFunc { return uh.HandleDeleteMe },
+			body:   `{"password": "wrong password"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uh, notifications := newLoginTest(t)
+			send := func() *httptest.ResponseRecorder {
+				r := asUser(httptest.NewRequest(http.MethodPost, "/me", strings.NewReader(tt.body)), 7)
+				rec := httptest.NewRecorder()
+				tt.handle(uh)(rec, r)
+				return rec
+			}
+
+			for i := 0; i < 5; i++ {
+				assert.Equal(t, http.StatusUnauthorized, send().Code, "attempt %d", i+1)
+			}
+
+			rec := send()
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+			assert.Len(t, notifications.notifications, 1)
+
+			// The same account can't log in either
+			assert.Equal(t, http.StatusTooManyRequests, login(uh, `{"username": "john", "password": "correct horse battery"}`).Code)
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+	"github.com/LikhithMar14/workout-tracker/internal/webhook"
+)
+
+// minWebhookSecretLength applies to secrets the caller picks themselves.
+const minWebhookSecretLength = 16
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+	Active     *bool    `json:"active"`
+}
+
+type updateWebhookRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func validateWebhook(url string, eventTypes []string) error {
+	if !webhook.ValidURL(url) {
+		return errors.New("url must be an absolute https URL")
+	}
+	if len(eventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, eventType := range eventTypes {
+		if !store.ValidWebhookEvent(eventType) {
+			return errors.New("unknown event type " + eventType)
+		}
+	}
+	return nil
+}
+
+// WebhookHandler manages webhooks. Users manage their own; the handler for
+// the admin routes is Global and manages the ones receiving every user's events.
+type WebhookHandler struct {
+	WebhookStore store.WebhookStore
+	Global       bool
+	Auditor      *audit.Auditor
+	Logger       *log.Logger
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore, global bool, auditor *audit.Auditor, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		WebhookStore: webhookStore,
+		Global:       global,
+		Auditor:      auditor,
+		Logger:       logger,
+	}
+}
+
+// owner returns whose webhooks the request manages: the caller's, or nil
+// for the global ones.
+func (wh *WebhookHandler) owner(w http.ResponseWriter, r *http.Request) (*int, bool) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return nil, false
+	}
+
+	if wh.Global {
+		return nil, true
+	}
+	return &principal.UserID, true
+}
+
+// loadWebhook fetches the webhook named in the URL, reporting webhooks the
+// caller doesn't manage as not found.
+func (wh *WebhookHandler) loadWebhook(w http.ResponseWriter, r *http.Request) *store.Webhook {
+	owner, ok := wh.owner(w, r)
+	if !ok {
+		return nil
+	}
+
+	webhookID, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.Logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid webhook id"})
+		return nil
+	}
+
+	hook, err := wh.WebhookStore.GetWebhook(webhookID)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	managed := hook != nil && ((owner == nil && hook.UserID == nil) ||
+		(owner != nil && hook.UserID != nil && *owner == *hook.UserID))
+	if !managed {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook not found"})
+		return nil
+	}
+
+	return hook
+}
+
+// loadDelivery fetches the delivery named in the URL, making sure it
+// belongs to the webhook.
+func (wh *WebhookHandler) loadDelivery(w http.ResponseWriter, r *http.Request) *store.WebhookDelivery {
+	hook := wh.loadWebhook(w, r)
+	if hook == nil {
+		return nil
+	}
+
+	deliveryID, err := utils.ReadInt64Param(r, "deliveryID")
+	if err != nil {
+		wh.Logger.Printf("ERROR: readInt64Param: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid delivery id"})
+		return nil
+	}
+
+	delivery, err := wh.WebhookStore.GetDelivery(deliveryID)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting webhook delivery: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if delivery == nil || delivery.WebhookID != hook.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "delivery not found"})
+		return nil
+	}
+
+	return delivery
+}
+
+func (wh *WebhookHandler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	owner, ok := wh.owner(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := wh.WebhookStore.ListWebhooks(owner)
+	if err != nil {
+		wh.Logger.Printf("ERROR: listing webhooks: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhooks": hooks})
+}
+
+func (wh *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := wh.owner(w, r)
+	if !ok {
+		return
+	}
+
+	var req createWebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.Logger.Printf("ERROR: decoding webhook: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err = validateWebhook(req.URL, req.EventTypes); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		secret, err = webhook.GenerateSecret()
+		if err != nil {
+			wh.Logger.Printf("ERROR: generating webhook secret: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	} else if len(secret) < minWebhookSecretLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "secret must be at least 16 characters"})
+		return
+	}
+
+	hook := &store.Webhook{
+		UserID:     owner,
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+		Active:     req.Active == nil || *req.Active,
+	}
+	err = wh.WebhookStore.CreateWebhook(hook)
+	if err != nil {
+		wh.Logger.Printf("ERROR: creating webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "webhook.create",
+		TargetType: "webhook",
+		TargetID:   hook.ID,
+		After:      hook,
+	})
+
+	// The secret is only ever shown here
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"webhook": hook, "secret": secret})
+}
+
+func (wh *WebhookHandler) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := wh.loadWebhook(w, r)
+	if hook == nil {
+		return
+	}
+	before := *hook
+
+	var req updateWebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.Logger.Printf("ERROR: decoding webhook: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.URL != nil {
+		hook.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		hook.EventTypes = req.EventTypes
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+
+	if err = validateWebhook(hook.URL, hook.EventTypes); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = wh.WebhookStore.UpdateWebhook(hook)
+	if err != nil {
+		wh.Logger.Printf("ERROR: updating webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "webhook.update",
+		TargetType: "webhook",
+		TargetID:   hook.ID,
+		Before:     &before,
+		After:      hook,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhook": hook})
+}
+
+func (wh *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := wh.loadWebhook(w, r)
+	if hook == nil {
+		return
+	}
+
+	err := wh.WebhookStore.DeleteWebhook(hook.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook not found"})
+		return
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: deleting webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "webhook.delete",
+		TargetType: "webhook",
+		TargetID:   hook.ID,
+		Before:     hook,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WebhookHandler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook := wh.loadWebhook(w, r)
+	if hook == nil {
+		return
+	}
+
+	page, pageSize, err := utils.ReadPagination(r, 20, 100)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	deliveries, total, err := wh.WebhookStore.ListDeliveries(hook.ID, page, pageSize)
+	if err != nil {
+		wh.Logger.Printf("ERROR: listing webhook deliveries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+	})
+}
+
+func (wh *WebhookHandler) HandleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery := wh.loadDelivery(w, r)
+	if delivery == nil {
+		return
+	}
+
+	// Response bodies are only kept for admin webhooks, but older attempts
+	// on users' webhooks may still have them
+	if !wh.Global {
+		for _, attempt := range delivery.AttemptLog {
+			attempt.ResponseBody = nil
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"delivery": delivery})
+}
+
+func (wh *WebhookHandler) HandleRedeliver(w http.ResponseWriter, r *http.Request) {
+	delivery := wh.loadDelivery(w, r)
+	if delivery == nil {
+		return
+	}
+
+	err := wh.WebhookStore.Redeliver(delivery.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "delivery not found"})
+		return
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: redelivering webhook: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "webhook.redeliver",
+		TargetType: "webhook",
+		TargetID:   delivery.WebhookID,
+		Metadata:   map[string]any{"delivery_id": delivery.ID},
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// WorkoutAccess is what a user may do with a particular workout.
+type WorkoutAccess struct {
+	Read    bool
+	Write   bool
+	Comment bool
+}
+
+// WorkoutAuthorizer decides access to workouts through the relationships
+// between users rather than ownership alone.
+type WorkoutAuthorizer struct {
+	CoachStore  store.CoachStore
+	FollowStore store.FollowStore
+	GrantStore  store.GrantStore
+}
+
+func NewWorkoutAuthorizer(coachStore store.CoachStore, followStore store.FollowStore, grantStore store.GrantStore) *WorkoutAuthorizer {
+	return &WorkoutAuthorizer{
+		CoachStore:  coachStore,
+		FollowStore: followStore,
+		GrantStore:  grantStore,
+	}
+}
+
+// Access works out what userID may do with workout:
+//   - the owner can do anything
+//   - a coach can read the history of athletes who allow it, and manage the
+//     workouts they assigned while they may still assign
+//   - users the owner granted access to can read and comment
+//   - approved followers can read workouts shared with followers or made
+//     public. Anyone else reads a public workout through its share link,
+//     never by ID, so public workouts can't be found by counting IDs
+func (wa *WorkoutAuthorizer) Access(userID int, workout *store.Workout) (WorkoutAccess, error) {
+	if workout.UserID == userID {
+		return WorkoutAccess{Read: true, Write: true, Comment: true}, nil
+	}
+
+	var access WorkoutAccess
+
+	permissions, err := wa.CoachStore.GetCoachPermissions(userID, workout.UserID)
+	if err != nil {
+		return access, err
+	}
+	if permissions != nil {
+		assignedByCaller := workout.AssignedBy != nil && *workout.AssignedBy == userID
+		access.Write = permissions.AssignWorkouts && assignedByCaller
+		access.Read = permissions.ViewHistory || access.Write
+		access.Comment = permissions.Comment && access.Read
+	}
+
+	granted, err := wa.GrantStore.HasAccess(int64(workout.ID), userID)
+	if err != nil {
+		return access, err
+	}
+	if granted {
+		access.Read = true
+		access.Comment = true
+	}
+
+	switch workout.Visibility {
+	case store.VisibilityFollowers, store.VisibilityPublic:
+		if !access.Read {
+			following, err := wa.FollowStore.IsFollowing(userID, workout.UserID)
+			if err != nil {
+				return access, err
+			}
+			access.Read = following
+		}
+	}
+
+	return access, nil
+}
+
+// CanAssign reports whether coachID may plan workouts for athleteID.
+func (wa *WorkoutAuthorizer) CanAssign(coachID, athleteID int) (bool, error) {
+	permissions, err := wa.CoachStore.GetCoachPermissions(coachID, athleteID)
+	if err != nil {
+		return false, err
+	}
+	return permissions != nil && permissions.AssignWorkouts, nil
+}
+
+// CanViewHistory reports whether userID may list athleteID's workouts.
+func (wa *WorkoutAuthorizer) CanViewHistory(userID, athleteID int) (bool, error) {
+	if userID == athleteID {
+		return true, nil
+	}
+
+	permissions, err := wa.CoachStore.GetCoachPermissions(userID, athleteID)
+	if err != nil {
+		return false, err
+	}
+	return permissions != nil && permissions.ViewHistory, nil
+}
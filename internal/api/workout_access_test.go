@@ -0,0 +1,216 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Users in the access tests. The athlete owns every workout.
+const (
+	athleteID  = 1
+	coachID    = 2
+	granteeID  = 3
+	followerID = 4
+	strangerID = 5
+	pendingID  = 6
+)
+
+func newTestAuthorizer(permissions store.CoachPermissions) *WorkoutAuthorizer {
+	follows := newFakeFollowStore()
+	follows.follows[[2]int{followerID, athleteID}] = true
+	follows.follows[[2]int{pendingID, athleteID}] = false
+
+	return NewWorkoutAuthorizer(
+		&fakeCoachStore{links: map[[2]int]*store.CoachPermissions{{coachID, athleteID}: &permissions}},
+		follows,
+		&fakeGrantStore{grants: map[[2]int64]bool{{10, granteeID}: true}},
+	)
+}
+
+func TestWorkoutAccess(t *testing.T) {
+	assignedByCoach := coachID
+	allPermissions := store.CoachPermissions{ViewHistory: true, AssignWorkouts: true, Comment: true}
+
+	tests := []struct {
+		name        string
+		userID      int
+		permissions store.CoachPermissions
+		visibility  string
+		assignedBy  *int
+		want        WorkoutAccess
+	}{
+		{
+			name:       "owner",
+			userID:     athleteID,
+			visibility: store.VisibilityPrivate,
+			want:       WorkoutAccess{Read: true, Write: true, Comment: true},
+		},
+		{
+			name:        "coach on a workout they assigned",
+			userID:      coachID,
+			permissions: allPermissions,
+			visibility:  store.VisibilityPrivate,
+			assignedBy:  &assignedByCoach,
+			want:        WorkoutAccess{Read: true, Write: true, Comment: true},
+		},
+		{
+			name:        "coach who may assign but not view history, on their own assignment",
+			userID:      coachID,
+			permissions: store.CoachPermissions{AssignWorkouts: true},
+			visibility:  store.VisibilityPrivate,
+			assignedBy:  &assignedByCoach,
+			want:        WorkoutAccess{Read: true, Write: true},
+		},
+		{
+			name:        "coach who can no longer assign, on their old assignment",
+			userID:      coachID,
+			permissions: store.CoachPermissions{ViewHistory: true, Comment: true},
+			visibility:  store.VisibilityPrivate,
+			assignedBy:  &assignedByCoach,
+			want:        WorkoutAccess{Read: true, Comment: true},
+		},
+		{
+			name:        "coach on a workout they didn't assign",
+			userID:      coachID,
+			permissions: allPermissions,
+			visibility:  store.VisibilityPrivate,
+			want:        WorkoutAccess{Read: true, Comment: true},
+		},
+		{
+			name:        "coach without history access on a workout they didn't assign",
+			userID:      coachID,
+			permissions: store.CoachPermissions{AssignWorkouts: true, Comment: true},
+			visibility:  store.VisibilityPrivate,
+			want:        WorkoutAccess{},
+		},
+		{
+			name:       "grantee",
+			userID:     granteeID,
+			visibility: store.VisibilityPrivate,
+			want:       WorkoutAccess{Read: true, Comment: true},
+		},
+		{
+			name:       "follower on a followers workout",
+			userID:     followerID,
+			visibility: store.VisibilityFollowers,
+			want:       WorkoutAccess{Read: true},
+		},
+		{
+			name:       "follower on a private workout",
+			userID:     followerID,
+			visibility: store.VisibilityPrivate,
+			want:       WorkoutAccess{},
+		},
+		{
+			name:       "pending follow request on a followers workout",
+			userID:     pendingID,
+			visibility: store.VisibilityFollowers,
+			want:       WorkoutAccess{},
+		},
+		{
+			name:       "follower on a public workout",
+			userID:     followerID,
+			visibility: store.VisibilityPublic,
+			want:       WorkoutAccess{Read: true},
+		},
+		{
+			name:       "pending follow request on a public workout",
+			userID:     pendingID,
+			visibility: store.VisibilityPublic,
+			want:       WorkoutAccess{},
+		},
+		{
+			name:       "stranger on a public workout, which is only readable by its share link",
+			userID:     strangerID,
+			visibility: store.VisibilityPublic,
+			want:       WorkoutAccess{},
+		},
+		{
+			name:       "stranger on a followers workout",
+			userID:     strangerID,
+			visibility: store.VisibilityFollowers,
+			want:       WorkoutAccess{},
+		},
+		{
+			name:       "stranger on a private workout",
+			userID:     strangerID,
+			visibility: store.VisibilityPrivate,
+			want:       WorkoutAccess{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wa := newTestAuthorizer(tt.permissions)
+			workout := &store.Workout{ID: 10, UserID: athleteID, Visibility: tt.visibility, AssignedBy: tt.assignedBy}
+
+			access, err := wa.Access(tt.userID, workout)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, access)
+		})
+	}
+}
+
+func TestCanAssignAndViewHistory(t *testing.T) {
+	tests := []struct {
+		name            string
+		userID          int
+		permissions     store.CoachPermissions
+		wantAssign      bool
+		wantViewHistory bool
+	}{
+		{
+			name:            "owner",
+			userID:          athleteID,
+			wantViewHistory: true,
+		},
+		{
+			name:            "coach with every permission",
+			userID:          coachID,
+			permissions:     store.CoachPermissions{ViewHistory: true, AssignWorkouts: true, Comment: true},
+			wantAssign:      true,
+			wantViewHistory: true,
+		},
+		{
+			name:        "coach who may only assign",
+			userID:      coachID,
+			permissions: store.CoachPermissions{AssignWorkouts: true},
+			wantAssign:  true,
+		},
+		{
+			name:            "coach who may only view history",
+			userID:          coachID,
+			permissions:     store.CoachPermissions{ViewHistory: true},
+			wantViewHistory: true,
+		},
+		{
+			name:   "grantee",
+			userID: granteeID,
+		},
+		{
+			name:   "follower",
+			userID: followerID,
+		},
+		{
+			name:   "stranger",
+			userID: strangerID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wa := newTestAuthorizer(tt.permissions)
+
+			canAssign, err := wa.CanAssign(tt.userID, athleteID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAssign, canAssign)
+
+			canViewHistory, err := wa.CanViewHistory(tt.userID, athleteID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantViewHistory, canViewHistory)
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+const maxCommentLength = 2000
+
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+func (req *commentRequest) validate() error {
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		return errors.New("body is required")
+	}
+	if utf8.RuneCountInString(req.Body) > maxCommentLength {
+		return errors.New("body must be at most 2000 characters")
+	}
+	return nil
+}
+
+// loadOwnWorkout is loadWorkout for actions reserved to the workout's owner.
+func (wh *WorkoutHandler) loadOwnWorkout(w http.ResponseWriter, r *http.Request) *store.Workout {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return nil
+	}
+
+	workout, _ := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return nil
+	}
+
+	if workout.UserID != principal.UserID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can manage access to this workout"})
+		return nil
+	}
+
+	return workout
+}
+
+func (wh *WorkoutHandler) HandleListGrants(w http.ResponseWriter, r *http.Request) {
+	workout := wh.loadOwnWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	grants, err := wh.GrantStore.ListGrants(int64(workout.ID))
+	if err != nil {
+		wh.Logger.Printf("ERROR: listing grants: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"grants": grants})
+}
+
+func (wh *WorkoutHandler) HandleCreateGrant(w http.ResponseWriter, r *http.Request) {
+	workout := wh.loadOwnWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.Logger.Printf("ERROR: decoding grant request: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.UserID == workout.UserID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you already have access to your own workout"})
+		return
+	}
+
+	user, err := wh.UserStore.GetUserByID(req.UserID)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting user by id: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil || !user.Activated || user.DisabledAt != nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	err = wh.GrantStore.GrantAccess(int64(workout.ID), user.ID)
+	if err != nil {
+		wh.Logger.Printf("ERROR: granting workout access: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.grant",
+		TargetType: "workout",
+		TargetID:   int64(workout.ID),
+		Metadata:   map[string]any{"user_id": user.ID},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WorkoutHandler) HandleDeleteGrant(w http.ResponseWriter, r *http.Request) {
+	workout := wh.loadOwnWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	userID, err := utils.ReadInt64Param(r, "userID")
+	if err != nil {
+		wh.Logger.Printf("ERROR: readInt64Param: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	err = wh.GrantStore.RevokeAccess(int64(workout.ID), int(userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "grant not found"})
+		return
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: revoking workout access: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.revoke",
+		TargetType: "workout",
+		TargetID:   int64(workout.ID),
+		Metadata:   map[string]any{"user_id": userID},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WorkoutHandler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	workout, access := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return
+	}
+
+	// Reading a public or followers-only workout doesn't open up its
+	// comments; they stay between the owner and the people given access.
+	if !access.Comment {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to see the comments on this workout"})
+		return
+	}
+
+	comments, err := wh.CommentStore.ListComments(int64(workout.ID))
+	if err != nil {
+		wh.Logger.Printf("ERROR: listing comments: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comments": comments})
+}
+
+func (wh *WorkoutHandler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	workout, access := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return
+	}
+
+	if !access.Comment {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to comment on this workout"})
+		return
+	}
+
+	var req commentRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.Logger.Printf("ERROR: decoding comment: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err = req.validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	comment := &store.WorkoutComment{
+		WorkoutID: int64(workout.ID),
+		UserID:    principal.UserID,
+		Body:      req.Body,
+	}
+	err = wh.CommentStore.CreateComment(comment)
+	if err != nil {
+		wh.Logger.Printf("ERROR: creating comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "comment.create",
+		TargetType: "comment",
+		TargetID:   comment.ID,
+		After:      comment,
+	})
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"comment": comment})
+}
+
+// loadComment fetches the comment named in the URL, making sure it belongs
+// to the workout and that the caller can still comment on that workout.
+func (wh *WorkoutHandler) loadComment(w http.ResponseWriter, r *http.Request, userID int) (*store.WorkoutComment, *store.Workout) {
+	workout, access := wh.loadWorkout(w, r, userID)
+	if workout == nil {
+		return nil, nil
+	}
+
+	if !access.Comment {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to see the comments on this workout"})
+		return nil, nil
+	}
+
+	commentID, err := utils.ReadInt64Param(r, "commentID")
+	if err != nil {
+		wh.Logger.Printf("ERROR: readInt64Param: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid comment id"})
+		return nil, nil
+	}
+
+	comment, err := wh.CommentStore.GetComment(commentID)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, nil
+	}
+
+	if comment == nil || comment.WorkoutID != int64(workout.ID) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return nil, nil
+	}
+
+	return comment, workout
+}
+
+func (wh *WorkoutHandler) HandleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	comment, _ := wh.loadComment(w, r, principal.UserID)
+	if comment == nil {
+		return
+	}
+
+	if comment.UserID != principal.UserID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the author can edit this comment"})
+		return
+	}
+
+	var req commentRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.Logger.Printf("ERROR: decoding comment: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if err = req.validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	before := *comment
+	comment.Body = req.Body
+	err = wh.CommentStore.UpdateComment(comment)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: updating comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "comment.update",
+		TargetType: "comment",
+		TargetID:   comment.ID,
+		Before:     &before,
+		After:      comment,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comment": comment})
+}
+
+func (wh *WorkoutHandler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	comment, workout := wh.loadComment(w, r, principal.UserID)
+	if comment == nil {
+		return
+	}
+
+	// Owners moderate the comments on their own workouts
+	if comment.UserID != principal.UserID && workout.UserID != principal.UserID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to delete this comment"})
+		return
+	}
+
+	err = wh.CommentStore.DeleteComment(comment.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: deleting comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "comment.delete",
+		TargetType: "comment",
+		TargetID:   comment.ID,
+		Before:     comment,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WorkoutHandler) HandleToggleReaction(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	workout, access := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return
+	}
+
+	if !access.Comment {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to react to this workout"})
+		return
+	}
+
+	var req struct {
+		Reaction string `json:"reaction"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.Logger.Printf("ERROR: decoding reaction: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !store.ValidReaction(req.Reaction) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "reaction must be like, fire, strong or clap"})
+		return
+	}
+
+	active, err := wh.CommentStore.ToggleReaction(int64(workout.ID), principal.UserID, req.Reaction)
+	if err != nil {
+		wh.Logger.Printf("ERROR: toggling reaction: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reaction": req.Reaction, "active": active})
+}
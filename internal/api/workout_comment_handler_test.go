@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     int
+		visibility string
+		want       int
+	}{
+		{name: "owner", userID: athleteID, visibility: store.VisibilityPrivate, want: http.StatusOK},
+		{name: "coach", userID: coachID, visibility: store.VisibilityPrivate, want: http.StatusOK},
+		{name: "grantee", userID: granteeID, visibility: store.VisibilityPrivate, want: http.StatusOK},
+		{name: "follower on a followers workout", userID: followerID, visibility: store.VisibilityFollowers, want: http.StatusForbidden},
+		{name: "follower on a public workout", userID: followerID, visibility: store.VisibilityPublic, want: http.StatusForbidden},
+		{name: "stranger on a public workout", userID: strangerID, visibility: store.VisibilityPublic, want: http.StatusNotFound},
+		{name: "stranger on a private workout", userID: strangerID, visibility: store.VisibilityPrivate, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workouts := &fakeWorkoutStore{workouts: map[int64]*store.Workout{
+				10: {ID: 10, UserID: athleteID, Visibility: tt.visibility},
+			}}
+			comments := &fakeCommentStore{comments: []*store.WorkoutComment{
+				{ID: 1, WorkoutID: 10, UserID: athleteID, Body: "felt strong today"},
+			}}
+			authorizer := newTestAuthorizer(store.CoachPermissions{ViewHistory: true, Comment: true})
+			auditor, _ := newTestAuditor()
+			wh := NewWorkoutHandler(workouts, nil, comments, nil, nil, nil, nil, authorizer, auditor, discardLogger)
+
+			r := chi.NewRouter()
+			r.Get("/workouts/{id}/comments", wh.HandleListComments)
+			r.Post("/workouts/{id}/comments", wh.HandleCreateComment)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/workouts/10/comments", nil), tt.userID))
+			assert.Equal(t, tt.want, rec.Code, "listing")
+			if tt.want != http.StatusOK {
+				assert.NotContains(t, rec.Body.String(), "felt strong today")
+			}
+
+			wantCreate := tt.want
+			if wantCreate == http.StatusOK {
+				wantCreate = http.StatusCreated
+			}
+			rec = httptest.NewRecorder()
+			body := strings.NewReader(`{"body": "nice work"}`)
+			r.ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodPost, "/workouts/10/comments", body), tt.userID))
+			assert.Equal(t, wantCreate, rec.Code, "commenting")
+		})
+	}
+}
@@ -3,120 +3,328 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"time"
 
+	"github.com/LikhithMar14/workout-tracker/internal/activityfile"
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
 	"github.com/LikhithMar14/workout-tracker/internal/middleware"
 	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/training"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
 	"github.com/LikhithMar14/workout-tracker/internal/utils"
+	"github.com/go-chi/chi/v5"
 )
 
+// maxActivityFileBytes is the largest activity file that can be imported.
+const maxActivityFileBytes = 25 << 20
+
+type createWorkoutRequest struct {
+	store.Workout
+	// AthleteID lets a coach assign the workout to one of their athletes
+	AthleteID *int `json:"athlete_id"`
+	// Prefill completes strength entries from the recommended next session
+	Prefill bool `json:"prefill"`
+}
+
+// optionalInt is a field of a partial update, telling a field sent as null
+// apart from one left out.
+type optionalInt struct {
+	Set   bool
+	Value *int
+}
+
+func (o *optionalInt) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
 type WorkoutHandler struct {
-	WorkoutStore store.WorkoutStore
-	Logger       *log.Logger
+	WorkoutStore     store.WorkoutStore
+	GrantStore       store.GrantStore
+	CommentStore     store.CommentStore
+	UserStore        store.UserStore
+	MeasurementStore store.MeasurementStore
+	SampleStore      store.SampleStore
+	ProgressionStore store.ProgressionStore
+	Authorizer       *WorkoutAuthorizer
+	Auditor          *audit.Auditor
+	Logger           *log.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, grantStore store.GrantStore, commentStore store.CommentStore, userStore store.UserStore, measurementStore store.MeasurementStore, sampleStore store.SampleStore, progressionStore store.ProgressionStore, authorizer *WorkoutAuthorizer, auditor *audit.Auditor, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
-		WorkoutStore: workoutStore,
-		Logger:       logger,
+		WorkoutStore:     workoutStore,
+		GrantStore:       grantStore,
+		CommentStore:     commentStore,
+		UserStore:        userStore,
+		MeasurementStore: measurementStore,
+		SampleStore:      sampleStore,
+		ProgressionStore: progressionStore,
+		Authorizer:       authorizer,
+		Auditor:          auditor,
+		Logger:           logger,
 	}
 }
 
-func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := middleware.GetUserIDFromContext(r.Context())
+// bodyweight returns the owner's bodyweight in kg around when the workout
+// was done: when it started, or else when it was logged. It is nil if it
+// isn't known. Figures derived from it are optional, so errors are only
+// logged.
+func (wh *WorkoutHandler) bodyweight(workout *store.Workout) *float64 {
+	at := time.Now()
+	switch {
+	case workout.StartedAt != nil:
+		at = *workout.StartedAt
+	case !workout.CreatedAt.IsZero():
+		at = workout.CreatedAt
+	}
+
+	kg, err := wh.MeasurementStore.GetBodyweightKg(workout.UserID, at)
 	if err != nil {
-		wh.Logger.Printf("ERROR: getting user ID from context: %v", err)
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		wh.Logger.Printf("ERROR: getting bodyweight: %v", err)
+		return nil
+	}
+	return kg
+}
+
+// estimateCalories fills in the calories of a workout from its entries and
+// the owner's bodyweight when it was done, marking them as estimated. When
+// there's nothing to estimate from or the bodyweight isn't known, an earlier
+// estimate is dropped rather than left out of step with the workout.
+func (wh *WorkoutHandler) estimateCalories(workout *store.Workout) {
+	if workout.CaloriesEstimated {
+		workout.CaloriesBurned = nil
+		workout.CaloriesEstimated = false
+	}
+	if workout.DurationMinutes <= 0 && len(workout.Entries) == 0 {
 		return
 	}
 
+	if kg := wh.bodyweight(workout); kg != nil {
+		calories := training.EstimateWorkoutCalories(workout, *kg)
+		workout.CaloriesBurned = &calories
+		workout.CaloriesEstimated = true
+	}
+}
+
+// attachVolume fills in the workout's volume. Bodyweight exercises count
+// the owner's bodyweight at the time, as calorie estimates do, but only for
+// callers who may change the workout: anyone else could work the
+// bodyweight back out.
+func (wh *WorkoutHandler) attachVolume(workout *store.Workout, withBodyweight bool) {
+	var kg *float64
+	if withBodyweight {
+		kg = wh.bodyweight(workout)
+	}
+	volume := training.Volume(workout, kg)
+	workout.Volume = &volume
+}
+
+// hideEstimatedCalories drops calories estimated from the owner's bodyweight
+// for callers who may not change the workout, for the same reason.
+func hideEstimatedCalories(workout *store.Workout, withBodyweight bool) {
+	if workout.CaloriesEstimated && !withBodyweight {
+		workout.CaloriesBurned = nil
+	}
+}
+
+// loadWorkout fetches the workout named in the URL along with the caller's
+// access to it. Workouts the caller can't read are reported as not found so
+// their existence isn't revealed. It writes the response itself and returns
+// a nil workout when the request can't proceed.
+func (wh *WorkoutHandler) loadWorkout(w http.ResponseWriter, r *http.Request, userID int) (*store.Workout, WorkoutAccess) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
 		wh.Logger.Printf("ERROR: readIDParam: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
-		return
+		return nil, WorkoutAccess{}
 	}
 
-	workout, err := wh.WorkoutStore.GetWorkoutByIDAndUserID(workoutID, userID)
+	workout, err := wh.WorkoutStore.GetWorkoutByID(workoutID)
 	if err != nil {
-		wh.Logger.Printf("ERROR: getWorkoutByIDAndUserID: %v", err)
+		wh.Logger.Printf("ERROR: getWorkoutByID: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-		return
+		return nil, WorkoutAccess{}
 	}
 
 	if workout == nil {
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return nil, WorkoutAccess{}
+	}
+
+	access, err := wh.Authorizer.Access(userID, workout)
+	if err != nil {
+		wh.Logger.Printf("ERROR: checking workout access: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, WorkoutAccess{}
+	}
+
+	if !access.Read {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return nil, WorkoutAccess{}
+	}
+
+	return workout, access
+}
+
+func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user from context
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
 		return
 	}
 
+	workout, access := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return
+	}
+
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+	wh.attachVolume(workout, access.Write)
+	hideEstimatedCalories(workout, access.Write)
+	presentWorkout(workout, system)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := middleware.GetUserIDFromContext(r.Context())
+	// Get the authenticated user from context
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
 	if err != nil {
-		wh.Logger.Printf("ERROR: getting user ID from context: %v", err)
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
 		return
 	}
+	userID := principal.UserID
 
-	var workout store.Workout
-	err = json.NewDecoder(r.Body).Decode(&workout)
+	var req createWorkoutRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		wh.Logger.Printf("ERROR: decoding workout: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
 		return
 	}
+	workout := req.Workout
+
+	// Weights are sent in the caller's units, even when assigning to an athlete
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, userID)
+	if !ok {
+		return
+	}
+	if err = entriesFromUnits(workout.Entries, system); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
 	// Set the user ID for the workout
 	workout.UserID = userID
+	workout.AssignedBy = nil
+
+	if req.AthleteID != nil && *req.AthleteID != userID {
+		allowed, err := wh.Authorizer.CanAssign(userID, *req.AthleteID)
+		if err != nil {
+			wh.Logger.Printf("ERROR: checking coach permissions: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if !allowed {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to assign workouts to this athlete"})
+			return
+		}
+
+		workout.UserID = *req.AthleteID
+		workout.AssignedBy = &userID
+	}
+
+	// Recommendations follow the history of whoever the workout is for
+	if req.Prefill {
+		if err = wh.prefillEntries(&workout); err != nil {
+			wh.Logger.Printf("ERROR: prefilling entries: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	// Share links, heart rate figures, volume and social counts are always
+	// worked out by the server
+	workout.ShareSlug = nil
+	workout.HeartRateMetrics = store.HeartRateMetrics{}
+	workout.Volume = nil
+	workout.CommentCount = 0
+	workout.ReactionCounts = map[string]int{}
+	if workout.Visibility != "" && !store.ValidVisibility(workout.Visibility) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "visibility must be private, followers or public"})
+		return
+	}
+
+	// Estimate calories the client didn't send
+	workout.CaloriesEstimated = false
+	if workout.CaloriesBurned == nil {
+		wh.estimateCalories(&workout)
+	}
 
 	createdWorkout, err := wh.WorkoutStore.CreateWorkout(&workout)
+	if errors.Is(err, store.ErrDuplicateWorkout) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.Logger.Printf("ERROR: creating workout: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.create",
+		TargetType: "workout",
+		TargetID:   int64(createdWorkout.ID),
+		After:      createdWorkout,
+	})
+
+	wh.attachVolume(createdWorkout, true)
+	presentWorkout(createdWorkout, system)
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
 }
 
 func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := middleware.GetUserIDFromContext(r.Context())
+	// Get the authenticated user from context
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
 	if err != nil {
-		wh.Logger.Printf("ERROR: getting user ID from context: %v", err)
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
 		return
 	}
 
-	workoutID, err := utils.ReadIDParam(r)
-	if err != nil {
-		wh.Logger.Printf("ERROR: readIDParam: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+	existingWorkout, access := wh.loadWorkout(w, r, principal.UserID)
+	if existingWorkout == nil {
 		return
 	}
 
-	existingWorkout, err := wh.WorkoutStore.GetWorkoutByIDAndUserID(workoutID, userID)
-	if err != nil {
-		wh.Logger.Printf("ERROR: getWorkoutByIDAndUserID: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	if !access.Write {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to change this workout"})
 		return
 	}
 
-	if existingWorkout == nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
-		return
-	}
+	workoutID := int64(existingWorkout.ID)
+	before := *existingWorkout
 
 	var updateWorkoutRequest struct {
 		Title           *string              `json:"title,omitempty"`
 		Description     *string              `json:"description,omitempty"`
 		DurationMinutes *int                 `json:"duration_minutes"`
-		CaloriesBurned  *int                 `json:"calories_burned,omitempty"`
+		CaloriesBurned  optionalInt          `json:"calories_burned"`
+		Visibility      *string              `json:"visibility,omitempty"`
+		StartedAt       *time.Time           `json:"started_at,omitempty"`
 		Entries         []store.WorkoutEntry `json:"entries"`
 	}
 
@@ -136,41 +344,89 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 	if updateWorkoutRequest.DurationMinutes != nil {
 		existingWorkout.DurationMinutes = *updateWorkoutRequest.DurationMinutes
 	}
-	if updateWorkoutRequest.CaloriesBurned != nil {
-		existingWorkout.CaloriesBurned = updateWorkoutRequest.CaloriesBurned
+	// Sending null drops entered calories to go back to an estimate
+	if updateWorkoutRequest.CaloriesBurned.Set {
+		existingWorkout.CaloriesBurned = updateWorkoutRequest.CaloriesBurned.Value
+		existingWorkout.CaloriesEstimated = false
+	}
+	if updateWorkoutRequest.StartedAt != nil {
+		existingWorkout.StartedAt = updateWorkoutRequest.StartedAt
+	}
+	if updateWorkoutRequest.Visibility != nil {
+		if existingWorkout.UserID != principal.UserID {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can change who sees this workout"})
+			return
+		}
+		if !store.ValidVisibility(*updateWorkoutRequest.Visibility) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "visibility must be private, followers or public"})
+			return
+		}
+		existingWorkout.Visibility = *updateWorkoutRequest.Visibility
 	}
 
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
 	if updateWorkoutRequest.Entries != nil {
+		if err = entriesFromUnits(updateWorkoutRequest.Entries, system); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
 		existingWorkout.Entries = updateWorkoutRequest.Entries
 	}
 
+	// Estimates follow the workout as it changes; entered calories are kept
+	if existingWorkout.CaloriesBurned == nil || existingWorkout.CaloriesEstimated {
+		wh.estimateCalories(existingWorkout)
+	}
+
 	err = wh.WorkoutStore.UpdateWorkout(existingWorkout)
+	if errors.Is(err, store.ErrDuplicateWorkout) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.Logger.Printf("ERROR: updatingWorkout: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.update",
+		TargetType: "workout",
+		TargetID:   workoutID,
+		Before:     &before,
+		After:      existingWorkout,
+	})
+
+	wh.attachVolume(existingWorkout, true)
+	presentWorkout(existingWorkout, system)
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
 }
 
 func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := middleware.GetUserIDFromContext(r.Context())
+	// Get the authenticated user from context
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
 	if err != nil {
-		wh.Logger.Printf("ERROR: getting user ID from context: %v", err)
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
 		return
 	}
 
-	paramsWorkoutID, err := utils.ReadIDParam(r)
-	if err != nil {
-		wh.Logger.Printf("ERROR: readIDParam: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+	// Load the workout first so the audit log keeps a copy of what was deleted
+	existingWorkout, access := wh.loadWorkout(w, r, principal.UserID)
+	if existingWorkout == nil {
 		return
 	}
 
-	err = wh.WorkoutStore.DeleteWorkoutByIDAndUserID(paramsWorkoutID, userID)
+	if !access.Write {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to delete this workout"})
+		return
+	}
+
+	paramsWorkoutID := int64(existingWorkout.ID)
+	err = wh.WorkoutStore.DeleteWorkoutByIDAndUserID(paramsWorkoutID, existingWorkout.UserID)
 	if err == sql.ErrNoRows {
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
 		return
@@ -182,5 +438,213 @@ func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http
 		return
 	}
 
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.delete",
+		TargetType: "workout",
+		TargetID:   paramsWorkoutID,
+		Before:     existingWorkout,
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// HandleGetPublicWorkout serves a workout shared by link. It is reachable
+// without logging in, so only public workouts are returned.
+func (wh *WorkoutHandler) HandleGetPublicWorkout(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if slug == "" {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
+
+	workout, err := wh.WorkoutStore.GetWorkoutByShareSlug(slug)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getWorkoutByShareSlug: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, 0)
+	if !ok {
+		return
+	}
+	wh.attachVolume(workout, false)
+	hideEstimatedCalories(workout, false)
+	presentWorkout(workout, system)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
+}
+
+// HandleImportFile creates a workout from a GPX, TCX or FIT file uploaded as
+// the file field of a multipart form. Optional title and visibility fields
+// override the defaults. A file is only imported once: another workout
+// starting at the same time is a conflict.
+func (wh *WorkoutHandler) HandleImportFile(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxActivityFileBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "activity files can be at most 25 MB"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "upload the activity file as the file field of a multipart form"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		wh.Logger.Printf("ERROR: reading activity file: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid activity file"})
+		return
+	}
+
+	activity, err := activityfile.Parse(data)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workout := workoutFromActivity(activity)
+	workout.UserID = principal.UserID
+	if title := r.FormValue("title"); title != "" {
+		workout.Title = title
+	}
+	workout.Visibility = r.FormValue("visibility")
+	if workout.Visibility != "" && !store.ValidVisibility(workout.Visibility) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "visibility must be private, followers or public"})
+		return
+	}
+	// The file is already in kilometres and metres; this only validates it
+	if err = entriesFromUnits(workout.Entries, units.Metric); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	// Calories recorded by the device are kept as if they were entered
+	if workout.CaloriesBurned == nil {
+		wh.estimateCalories(&workout)
+	}
+
+	createdWorkout, err := wh.WorkoutStore.CreateWorkout(&workout)
+	if errors.Is(err, store.ErrDuplicateWorkout) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "this activity has already been imported"})
+		return
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: importing workout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// The workout is kept even if its samples can't be, as they're optional
+	heartRate, err := wh.heartRateAccumulator(createdWorkout.UserID)
+	if err == nil && len(activity.HeartRate) > 0 {
+		series := newHeartRateSeries(activity, heartRate)
+		_, err = wh.SampleStore.ReplaceSamples(r.Context(), int64(createdWorkout.ID), series)
+		if err == nil {
+			createdWorkout.HeartRateMetrics = series.HeartRate()
+		}
+	}
+	if err != nil {
+		wh.Logger.Printf("ERROR: storing imported heart rate: %v", err)
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.import",
+		TargetType: "workout",
+		TargetID:   int64(createdWorkout.ID),
+		After:      createdWorkout,
+		Metadata:   map[string]any{"filename": header.Filename},
+	})
+
+	wh.attachVolume(createdWorkout, true)
+	presentWorkout(createdWorkout, system)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
+
+// activityNames are the titles of imported workouts whose file doesn't
+// name them.
+var activityNames = map[string]string{
+	store.ActivityRun:  "Run",
+	store.ActivityRide: "Ride",
+	store.ActivityRow:  "Row",
+	store.ActivitySwim: "Swim",
+	store.ActivityWalk: "Walk",
+	store.ActivityHike: "Hike",
+}
+
+// workoutFromActivity builds a private workout with a single entry for the
+// activity. Laps become splits when there is more than one.
+func workoutFromActivity(activity *activityfile.Activity) store.Workout {
+	name := activityNames[activity.Sport]
+	if name == "" {
+		name = "Activity"
+	}
+	title := activity.Name
+	if title == "" {
+		title = name
+	}
+
+	startedAt := activity.StartTime
+	duration := activity.DurationSeconds
+	entry := store.WorkoutEntry{
+		ExerciseName:    name,
+		Sets:            1,
+		DurationSeconds: &duration,
+		AvgHeartRate:    activity.AvgHeartRate,
+		MaxHeartRate:    activity.MaxHeartRate,
+		OrderIndex:      1,
+	}
+	if activity.Sport != "" {
+		sport := activity.Sport
+		entry.Activity = &sport
+	}
+
+	if activity.DistanceKm > 0 {
+		distance := roundTo(activity.DistanceKm, 3)
+		entry.Distance = &distance
+		entry.ElevationGain = activity.ElevationGainM
+
+		if len(activity.Laps) > 1 {
+			for _, lap := range activity.Laps {
+				if lap.DistanceKm <= 0 || lap.DurationSeconds <= 0 {
+					// Splits are all or nothing
+					entry.Splits = nil
+					break
+				}
+				entry.Splits = append(entry.Splits, store.Split{
+					Distance:        roundTo(lap.DistanceKm, 3),
+					DurationSeconds: lap.DurationSeconds,
+					ElevationGain:   lap.ElevationGainM,
+					AvgHeartRate:    lap.AvgHeartRate,
+				})
+			}
+		}
+	}
+
+	return store.Workout{
+		Title:           title,
+		DurationMinutes: max(1, int(math.Round(float64(duration)/60))),
+		CaloriesBurned:  activity.Calories,
+		StartedAt:       &startedAt,
+		Entries:         []store.WorkoutEntry{entry},
+	}
+}
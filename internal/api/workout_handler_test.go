@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type workoutTest struct {
+	router       chi.Router
+	workouts     *fakeWorkoutStore
+	measurements *fakeMeasurementStore
+	auditStore   *fakeAuditStore
+}
+
+func newWorkoutTest() *workoutTest {
+	slug := "abc123"
+	calories := 420
+	workouts := &fakeWorkoutStore{workouts: map[int64]*store.Workout{
+		10: {ID: 10, UserID: athleteID, Visibility: store.VisibilityPublic, ShareSlug: &slug, DurationMinutes: 45, CaloriesBurned: &calories, CaloriesEstimated: true},
+	}}
+	users := &fakeUserStore{users: map[int]*store.User{}}
+	measurements := &fakeMeasurementStore{bodyweights: map[int]float64{athleteID: 80}}
+	authorizer := newTestAuthorizer(store.CoachPermissions{ViewHistory: true})
+	auditor, auditStore := newTestAuditor()
+
+	wh := NewWorkoutHandler(workouts, nil, nil, users, measurements, nil, nil, authorizer, auditor, discardLogger)
+	sh := NewSocialHandler(newFakeFollowStore(), users, workouts, auditor, discardLogger)
+
+	r := chi.NewRouter()
+	r.Get("/workouts/{id}", wh.HandleGetWorkoutByID)
+	r.Post("/workouts", wh.HandleCreateWorkout)
+	r.Put("/workouts/{id}", wh.HandleUpdateWorkoutByID)
+	r.Get("/feed", sh.HandleGetFeed)
+	r.Get("/share/{slug}", wh.HandleGetPublicWorkout)
+	return &workoutTest{router: r, workouts: workouts, measurements: measurements, auditStore: auditStore}
+}
+
+// get returns the first workout in the response to path, as sent by userID.
+func (wt *workoutTest) get(t *testing.T, path string, userID int) map[string]any {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if userID != 0 {
+		r = asUser(r, userID)
+	}
+	rec := httptest.NewRecorder()
+	wt.router.ServeHTTP(rec, r)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Workout  map[string]any   `json:"workout"`
+		Workouts []map[string]any `json:"workouts"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	if body.Workout != nil {
+		return body.Workout
+	}
+	require.Len(t, body.Workouts, 1)
+	return body.Workouts[0]
+}
+
+func TestEstimatedCaloriesOnlyForEditors(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		userID   int
+		estimate bool
+	}{
+		{name: "owner", path: "/workouts/10", userID: athleteID, estimate: true},
+		{name: "coach", path: "/workouts/10", userID: coachID},
+		{name: "follower", path: "/workouts/10", userID: followerID},
+		{name: "feed", path: "/feed", userID: followerID},
+		{name: "shared link", path: "/share/abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workout := newWorkoutTest().get(t, tt.path, tt.userID)
+
+			assert.Equal(t, true, workout["calories_estimated"])
+			if tt.estimate {
+				assert.EqualValues(t, 420, workout["calories_burned"])
+			} else {
+				assert.NotContains(t, workout, "calories_burned")
+			}
+		})
+	}
+}
+
+func TestPublicWorkoutsAreNotReadableByID(t *testing.T) {
+	wt := newWorkoutTest()
+
+	rec := httptest.NewRecorder()
+	wt.router.ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/workouts/10", nil), strangerID))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	workout := wt.get(t, "/share/abc123", 0)
+	assert.EqualValues(t, 10, workout["id"])
+}
+
+func TestLoggedCaloriesAreShown(t *testing.T) {
+	wt := newWorkoutTest()
+	wt.workouts.workouts[10].CaloriesEstimated = false
+
+	for _, path := range []string{"/workouts/10", "/feed", "/share/abc123"} {
+		workout := wt.get(t, path, followerID)
+		assert.EqualValues(t, 420, workout["calories_burned"], path)
+	}
+}
+
+// update sends body as the owner's update of the workout and returns the
+// workout as stored.
+func (wt *workoutTest) update(t *testing.T, body string) *store.Workout {
+	rec := httptest.NewRecorder()
+	wt.router.ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodPut, "/workouts/10", strings.NewReader(body)), athleteID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	return wt.workouts.workouts[10]
+}
+
+func TestUpdateDropsEstimateWithoutBodyweight(t *testing.T) {
+	wt := newWorkoutTest()
+	delete(wt.measurements.bodyweights, athleteID)
+
+	workout := wt.update(t, `{"title": "Evening run"}`)
+
+	assert.Nil(t, workout.CaloriesBurned)
+	assert.False(t, workout.CaloriesEstimated)
+}
+
+func TestUpdateCaloriesBurned(t *testing.T) {
+	wt := newWorkoutTest()
+
+	workout := wt.update(t, `{"calories_burned": 500}`)
+	require.NotNil(t, workout.CaloriesBurned)
+	assert.Equal(t, 500, *workout.CaloriesBurned)
+	assert.False(t, workout.CaloriesEstimated)
+
+	workout = wt.update(t, `{"title": "Evening run"}`)
+	require.NotNil(t, workout.CaloriesBurned)
+	assert.Equal(t, 500, *workout.CaloriesBurned, "entered calories are kept")
+
+	workout = wt.update(t, `{"calories_burned": null}`)
+	require.NotNil(t, workout.CaloriesBurned)
+	assert.NotEqual(t, 500, *workout.CaloriesBurned)
+	assert.True(t, workout.CaloriesEstimated, "null goes back to an estimate")
+}
+
+func TestCreateIgnoresServerComputedFields(t *testing.T) {
+	wt := newWorkoutTest()
+
+	body := `{
+		"title": "Morning run",
+		"duration_minutes": 30,
+		"avg_heart_rate": 150,
+		"max_heart_rate": 190,
+		"hr_zone_seconds": [60, 120, 300, 600, 720],
+		"trimp": 99.5,
+		"volume": 12345,
+		"comment_count": 42,
+		"reaction_counts": {"fire": 1000}
+	}`
+	rec := httptest.NewRecorder()
+	wt.router.ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(body)), athleteID))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var response struct {
+		Workout map[string]any `json:"workout"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	for _, field := range []string{"avg_heart_rate", "max_heart_rate", "hr_zone_seconds", "trimp"} {
+		assert.NotContains(t, response.Workout, field)
+	}
+	assert.EqualValues(t, 0, response.Workout["volume"])
+	assert.EqualValues(t, 0, response.Workout["comment_count"])
+	assert.Empty(t, response.Workout["reaction_counts"])
+
+	require.Len(t, wt.auditStore.events, 1)
+	changes := string(wt.auditStore.events[0].Changes)
+	assert.Contains(t, changes, "Morning run")
+	assert.NotContains(t, changes, "trimp")
+	assert.NotContains(t, changes, "1000")
+}
+
+func TestBodyweightIsTakenWhenTheWorkoutStarted(t *testing.T) {
+	wt := newWorkoutTest()
+	startedAt := time.Date(2020, 3, 1, 7, 0, 0, 0, time.UTC)
+	workout := wt.workouts.workouts[10]
+	workout.StartedAt = &startedAt
+	workout.CreatedAt = time.Now()
+
+	wt.update(t, `{"title": "Backdated run"}`)
+
+	require.Len(t, wt.measurements.asked, 2, "once for calories, once for volume")
+	for _, at := range wt.measurements.asked {
+		assert.Equal(t, startedAt, at)
+	}
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/training"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// Sessions looked at for a recommendation: enough to spot a stall
+	progressionHistory = 2
+	maxExerciseName    = 255
+	maxIncrementKg     = 100
+	maxProgressionReps = 100
+)
+
+// lastSession is the session a recommendation follows from.
+type lastSession struct {
+	WorkoutID  int       `json:"workout_id"`
+	LoggedAt   time.Time `json:"logged_at"`
+	Sets       int       `json:"sets"`
+	Reps       int       `json:"reps"`
+	Weight     *float64  `json:"weight,omitempty"`
+	WeightUnit string    `json:"weight_unit,omitempty"`
+	RPE        *float64  `json:"rpe,omitempty"`
+}
+
+type progressionRequest struct {
+	Scheme        *string  `json:"scheme"`
+	Increment     *float64 `json:"increment"`
+	IncrementUnit string   `json:"increment_unit"`
+	MinReps       *int     `json:"min_reps"`
+	MaxReps       *int     `json:"max_reps"`
+	TargetRPE     *float64 `json:"target_rpe"`
+}
+
+// apply validates the request and sets its fields on settings, converting
+// the increment from the system's units unless it names its own.
+func (req *progressionRequest) apply(settings *store.ProgressionSettings, system string) error {
+	if req.Scheme != nil {
+		if !store.ValidProgressionScheme(*req.Scheme) {
+			return errors.New("scheme must be linear, double or rpe")
+		}
+		settings.Scheme = *req.Scheme
+	}
+
+	if req.Increment != nil {
+		var kg float64
+		switch req.IncrementUnit {
+		case "":
+			kg = units.ToKilograms(*req.Increment, system)
+		case units.Kilograms:
+			kg = *req.Increment
+		case units.Pounds:
+			kg = *req.Increment * units.KilogramsPerPound
+		default:
+			return errors.New("increment_unit must be kg or lb")
+		}
+		if kg <= 0 || kg > maxIncrementKg {
+			return errors.New("increment must be more than 0 and at most 100 kg")
+		}
+		settings.Increment = kg
+	}
+
+	if req.MinReps != nil {
+		settings.MinReps = *req.MinReps
+	}
+	if req.MaxReps != nil {
+		settings.MaxReps = *req.MaxReps
+	}
+	if settings.MinReps < 1 || settings.MaxReps < settings.MinReps || settings.MaxReps > maxProgressionReps {
+		return fmt.Errorf("min_reps and max_reps must be a range between 1 and %d", maxProgressionReps)
+	}
+
+	if req.TargetRPE != nil {
+		rpe := *req.TargetRPE
+		if rpe < minRPE || rpe > maxRPE || math.Trunc(rpe*2) != rpe*2 {
+			return fmt.Errorf("target_rpe must be between %d and %d, in steps of 0.5", minRPE, maxRPE)
+		}
+		settings.TargetRPE = rpe
+	}
+	return nil
+}
+
+// exerciseName returns the exercise named in the URL, writing a response
+// itself when it isn't valid.
+func exerciseName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	name = strings.TrimSpace(name)
+	if err != nil || name == "" || utf8.RuneCountInString(name) > maxExerciseName {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise name"})
+		return "", false
+	}
+	return name, true
+}
+
+// progression returns the user's settings for an exercise, or the defaults
+// when they haven't chosen any.
+func (wh *WorkoutHandler) progression(userID int, name string) (store.ProgressionSettings, error) {
+	settings, err := wh.ProgressionStore.GetProgressionSettings(userID, name)
+	if err != nil {
+		return store.ProgressionSettings{}, err
+	}
+	if settings == nil {
+		return training.DefaultProgression(strings.ToLower(name)), nil
+	}
+	return *settings, nil
+}
+
+// recommend suggests the user's next session of an exercise, using scheme
+// in place of their own when it's given. The recommendation is nil when the
+// exercise has never been done for reps; otherwise the session it follows
+// from is returned too.
+func (wh *WorkoutHandler) recommend(userID int, name, scheme string) (*training.Recommendation, *store.LoggedEntry, error) {
+	settings, err := wh.progression(userID, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if scheme != "" {
+		settings.Scheme = scheme
+	}
+
+	history, err := wh.WorkoutStore.ListExerciseHistory(userID, name, progressionHistory)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(history) == 0 {
+		return nil, nil, nil
+	}
+	return training.Recommend(settings, history), history[0], nil
+}
+
+// prefillEntries fills in the sets, reps and weight that strength entries
+// are missing with the recommendation for the workout's owner. Entries of
+// exercises they've never done are left alone.
+func (wh *WorkoutHandler) prefillEntries(workout *store.Workout) error {
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		if entry.Activity != nil || entry.DurationSeconds != nil {
+			continue
+		}
+		if entry.Sets > 0 && entry.Reps != nil && entry.Weight != nil {
+			continue
+		}
+
+		next, _, err := wh.recommend(workout.UserID, entry.ExerciseName, "")
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			continue
+		}
+
+		if entry.Sets == 0 {
+			entry.Sets = next.Sets
+		}
+		if entry.Reps == nil {
+			reps := next.Reps
+			entry.Reps = &reps
+		}
+		if entry.Weight == nil && next.Weight != nil {
+			weight := *next.Weight
+			entry.Weight = &weight
+		}
+	}
+	return nil
+}
+
+// presentProgression converts stored settings to the system's units.
+func presentProgression(settings *store.ProgressionSettings, system string) {
+	settings.Increment = roundTo(units.FromKilograms(settings.Increment, system), 3)
+	settings.IncrementUnit = units.WeightUnit(system)
+}
+
+// HandleGetNextSession recommends the sets, reps and weight for the
+// caller's next session of an exercise.
+func (wh *WorkoutHandler) HandleGetNextSession(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	name, ok := exerciseName(w, r)
+	if !ok {
+		return
+	}
+	scheme := r.URL.Query().Get("scheme")
+	if scheme != "" && !store.ValidProgressionScheme(scheme) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "scheme must be linear, double or rpe"})
+		return
+	}
+
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	next, last, err := wh.recommend(principal.UserID, name, scheme)
+	if err != nil {
+		wh.Logger.Printf("ERROR: recommending next session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if next == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "this exercise hasn't been logged with reps yet"})
+		return
+	}
+
+	session := lastSession{WorkoutID: last.WorkoutID, LoggedAt: last.LoggedAt, Sets: last.Sets, Reps: *last.Reps, RPE: last.RPE}
+	if next.Weight != nil {
+		weight := roundTo(units.FromKilograms(*next.Weight, system), 2)
+		next.Weight = &weight
+		next.WeightUnit = units.WeightUnit(system)
+	}
+	if last.Weight != nil {
+		weight := roundTo(units.FromKilograms(*last.Weight, system), 2)
+		session.Weight = &weight
+		session.WeightUnit = units.WeightUnit(system)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise_name": name, "next": next, "last_session": session})
+}
+
+// HandleGetProgression returns how the caller progresses on an exercise.
+func (wh *WorkoutHandler) HandleGetProgression(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	name, ok := exerciseName(w, r)
+	if !ok {
+		return
+	}
+
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	settings, err := wh.progression(principal.UserID, name)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting progression settings: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	presentProgression(&settings, system)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"progression": settings})
+}
+
+// HandleUpdateProgression changes how the caller progresses on an exercise.
+// Fields left out keep their current value, or the default.
+func (wh *WorkoutHandler) HandleUpdateProgression(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	name, ok := exerciseName(w, r)
+	if !ok {
+		return
+	}
+
+	var req progressionRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	system, ok := unitSystem(w, r, wh.UserStore, wh.Logger, principal.UserID)
+	if !ok {
+		return
+	}
+
+	settings, err := wh.progression(principal.UserID, name)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting progression settings: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	before := settings
+
+	if err = req.apply(&settings, system); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	settings.UserID = principal.UserID
+
+	err = wh.ProgressionStore.SaveProgressionSettings(&settings)
+	if err != nil {
+		wh.Logger.Printf("ERROR: saving progression settings: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "progression.update",
+		TargetType: "user",
+		TargetID:   int64(principal.UserID),
+		Before:     &before,
+		After:      &settings,
+		Metadata:   map[string]any{"exercise_name": settings.ExerciseName},
+	})
+
+	presentProgression(&settings, system)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"progression": settings})
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/LikhithMar14/workout-tracker/internal/activityfile"
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/training"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+// Limits on sample uploads and downloads.
+const (
+	maxSampleUploadBytes = 64 << 20
+	maxSamples           = 200000
+	maxPower             = 3000
+	maxCadence           = 300
+	// Downloads are downsampled to about this many points by default
+	defaultSamplePoints = 1000
+	maxSampleResolution = 3600
+)
+
+// sampleDecoder is the SampleSource of an upload: newline-delimited JSON
+// samples, validated and summarized as they stream to the database. The
+// first error is kept in err, as the database only sees that COPY failed.
+type sampleDecoder struct {
+	decoder   *json.Decoder
+	heartRate *training.HeartRateAccumulator
+	count     int
+	lastMs    int
+	err       error
+}
+
+func (d *sampleDecoder) Next() (*store.Sample, error) {
+	sample, err := d.next()
+	if err != nil && err != io.EOF {
+		d.err = err
+	}
+	return sample, err
+}
+
+func (d *sampleDecoder) next() (*store.Sample, error) {
+	var sample store.Sample
+	err := d.decoder.Decode(&sample)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sample %d is not valid JSON", d.count+1)
+	}
+
+	d.count++
+	switch {
+	case d.count > maxSamples:
+		return nil, fmt.Errorf("a workout can have at most %d samples", maxSamples)
+	case sample.OffsetMs < 0 || (d.count > 1 && sample.OffsetMs <= d.lastMs):
+		return nil, fmt.Errorf("sample %d: offset_ms must be positive and increasing", d.count)
+	case sample.HeartRate != nil && (*sample.HeartRate < minHeartRate || *sample.HeartRate > maxHeartRate):
+		return nil, fmt.Errorf("sample %d: heart_rate must be between %d and %d", d.count, minHeartRate, maxHeartRate)
+	case sample.Power != nil && (*sample.Power < 0 || *sample.Power > maxPower):
+		return nil, fmt.Errorf("sample %d: power must be between 0 and %d", d.count, maxPower)
+	case sample.Cadence != nil && (*sample.Cadence < 0 || *sample.Cadence > maxCadence):
+		return nil, fmt.Errorf("sample %d: cadence must be between 0 and %d", d.count, maxCadence)
+	}
+	d.lastMs = sample.OffsetMs
+
+	if sample.HeartRate != nil {
+		d.heartRate.Add(sample.OffsetMs, *sample.HeartRate)
+	}
+	return &sample, nil
+}
+
+func (d *sampleDecoder) HeartRate() store.HeartRateMetrics {
+	return d.heartRate.Metrics()
+}
+
+// heartRateSeries is the SampleSource of an imported activity's heart rate.
+type heartRateSeries struct {
+	samples   []store.Sample
+	heartRate *training.HeartRateAccumulator
+}
+
+// newHeartRateSeries keeps the readings of an activity that fall in order
+// after its start, at most one per millisecond.
+func newHeartRateSeries(activity *activityfile.Activity, heartRate *training.HeartRateAccumulator) *heartRateSeries {
+	series := &heartRateSeries{heartRate: heartRate}
+	lastMs := -1
+	for _, reading := range activity.HeartRate {
+		offsetMs := int(reading.Time.Sub(activity.StartTime).Milliseconds())
+		bpm := reading.BPM
+		if offsetMs <= lastMs || bpm < minHeartRate || bpm > maxHeartRate || len(series.samples) == maxSamples {
+			continue
+		}
+		lastMs = offsetMs
+		series.samples = append(series.samples, store.Sample{OffsetMs: offsetMs, HeartRate: &bpm})
+		heartRate.Add(offsetMs, bpm)
+	}
+	return series
+}
+
+func (s *heartRateSeries) Next() (*store.Sample, error) {
+	if len(s.samples) == 0 {
+		return nil, io.EOF
+	}
+	sample := &s.samples[0]
+	s.samples = s.samples[1:]
+	return sample, nil
+}
+
+func (s *heartRateSeries) HeartRate() store.HeartRateMetrics {
+	return s.heartRate.Metrics()
+}
+
+// heartRateAccumulator returns an accumulator using the heart rates the
+// workout's owner has set.
+func (wh *WorkoutHandler) heartRateAccumulator(userID int) (*training.HeartRateAccumulator, error) {
+	user, err := wh.UserStore.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	maxHeartRate, restingHeartRate := 0, 0
+	if user != nil && user.MaxHeartRate != nil {
+		maxHeartRate = *user.MaxHeartRate
+	}
+	if user != nil && user.RestingHeartRate != nil {
+		restingHeartRate = *user.RestingHeartRate
+	}
+	return training.NewHeartRateAccumulator(maxHeartRate, restingHeartRate), nil
+}
+
+// HandleUploadSamples replaces a workout's samples with those streamed in
+// the request body as newline-delimited JSON, and updates the heart rate
+// metrics derived from them.
+func (wh *WorkoutHandler) HandleUploadSamples(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	workout, access := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return
+	}
+
+	if !access.Write {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to change this workout"})
+		return
+	}
+
+	heartRate, err := wh.heartRateAccumulator(workout.UserID)
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting user for heart rate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSampleUploadBytes)
+	source := &sampleDecoder{decoder: json.NewDecoder(r.Body), heartRate: heartRate}
+	count, err := wh.SampleStore.ReplaceSamples(r.Context(), int64(workout.ID), source)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(source.err, &maxBytesErr):
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "samples can be at most 64 MB"})
+		case source.err != nil:
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": source.err.Error()})
+		default:
+			wh.Logger.Printf("ERROR: replacing samples: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		}
+		return
+	}
+
+	metrics := source.HeartRate()
+	wh.Auditor.Record(r, audit.Entry{
+		Action:     "workout.samples.replace",
+		TargetType: "workout",
+		TargetID:   int64(workout.ID),
+		Metadata:   map[string]any{"sample_count": count},
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sample_count": count, "heart_rate": metrics})
+}
+
+// HandleListSamples returns a workout's samples averaged over buckets of
+// resolution seconds. Without a resolution, buckets are sized to return
+// about defaultSamplePoints of them.
+func (wh *WorkoutHandler) HandleListSamples(w http.ResponseWriter, r *http.Request) {
+	principal, err := middleware.GetPrincipalFromContext(r.Context())
+	if err != nil {
+		wh.Logger.Printf("ERROR: getting principal from context: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	workout, _ := wh.loadWorkout(w, r, principal.UserID)
+	if workout == nil {
+		return
+	}
+
+	resolution := max(1, int(math.Ceil(float64(workout.DurationMinutes*60)/defaultSamplePoints)))
+	if v := r.URL.Query().Get("resolution"); v != "" {
+		resolution, err = strconv.Atoi(v)
+		if err != nil || resolution < 1 || resolution > maxSampleResolution {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "resolution must be between 1 and 3600 seconds"})
+			return
+		}
+	}
+
+	samples, err := wh.SampleStore.ListSamples(int64(workout.ID), resolution*1000)
+	if err != nil {
+		wh.Logger.Printf("ERROR: listing samples: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"resolution": resolution, "samples": samples})
+}
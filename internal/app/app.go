@@ -6,19 +6,46 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/LikhithMar14/workout-tracker/internal/api"
+	"github.com/LikhithMar14/workout-tracker/internal/audit"
+	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/jobs"
+	"github.com/LikhithMar14/workout-tracker/internal/mailer"
+	"github.com/LikhithMar14/workout-tracker/internal/notify"
+	"github.com/LikhithMar14/workout-tracker/internal/oidc"
 	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/webhook"
 	"github.com/LikhithMar14/workout-tracker/migrations"
 	"github.com/LikhithMar14/workout-tracker/pkg"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	Config         pkg.Config
-	DB             *sql.DB
+	Logger              *log.Logger
+	WorkoutHandler      *api.WorkoutHandler
+	UserHandler         *api.UserHandler
+	AdminHandler        *api.AdminHandler
+	APIKeyHandler       *api.APIKeyHandler
+	SocialHandler       *api.SocialHandler
+	CoachHandler        *api.CoachHandler
+	NotificationHandler *api.NotificationHandler
+	MeasurementHandler  *api.MeasurementHandler
+	StatsHandler        *api.StatsHandler
+	WebhookHandler      *api.WebhookHandler
+	AdminWebhookHandler *api.WebhookHandler
+	JobHandler          *api.JobHandler
+	OIDCHandler         *api.OIDCHandler
+	Authenticator       auth.Authenticator
+	Keyring             *auth.Keyring
+	KeysHandler         *api.KeysHandler
+	SessionStore        store.SessionStore
+	APIKeyStore         store.APIKeyStore
+	Notifier            *notify.Notifier
+	WebhookDeliverer    *webhook.Deliverer
+	JobRunner           *jobs.Runner
+	Config              pkg.Config
+	DB                  *sql.DB
 }
 
 func NewApplication(cfg pkg.Config) (*Application, error) {
@@ -26,23 +53,138 @@ func NewApplication(cfg pkg.Config) (*Application, error) {
 	if err != nil {
 		return nil, err
 	}
+	migrations.LegacyWeightUnit = cfg.LegacyWeightUnit
 	err = store.MigrateFS(pgDB, migrations.FS, ".")
 	if err != nil {
 		panic(err)
 	}
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile)
+
+	auditStore := store.NewPostgresAuditStore(pgDB)
+	auditor := audit.NewAuditor(auditStore, logger)
+
 	workoutStore := store.NewPostgressWorkoutStore(pgDB)
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	jobStore := store.NewPostgresJobStore(pgDB)
+	notificationStore := store.NewPostgresNotificationStore(pgDB)
+	notifier := notify.NewNotifier(notificationStore, workoutStore, logger)
+	notificationHandler := api.NewNotificationHandler(notificationStore, notifier, logger)
+
+	// Prefer asymmetric keys so other services can verify tokens through the
+	// JWKS endpoint; the shared HMAC secret remains for local development.
+	var authenticator auth.Authenticator
+	var keyring *auth.Keyring
+	if cfg.JWTKeysDir != "" {
+		keyring, err = auth.LoadKeyring(cfg.JWTKeysDir)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := keyring.Active(); err != nil {
+			return nil, fmt.Errorf("%w: run the keys command to create one", err)
+		}
+		authenticator = auth.NewKeyringAuthenticator(keyring, auth.Audience, auth.Issuer)
+	} else {
+		logger.Printf("No JWT keyring configured, signing tokens with HS256")
+		authenticator = auth.NewJWTAuthenticator(cfg.JWTSecret, auth.Audience, auth.Issuer)
+	}
+	keysHandler := api.NewKeysHandler(keyring, logger)
+
+	var mail mailer.Mailer
+	if cfg.SMTPHost != "" {
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPSender)
+	} else {
+		logger.Printf("No SMTP host configured, writing emails to %s", cfg.MailDir)
+		mail = mailer.NewFileMailer(cfg.MailDir, cfg.SMTPSender)
+	}
+
+	err = store.SetBcryptCost(cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	passwordPolicy := auth.NewPasswordPolicy(cfg.PasswordMinLength)
 
 	userStore := store.NewPostgresUserStore(pgDB)
-	userHandler := api.NewUserHandler(userStore, logger)
+	sessionStore := store.NewPostgresSessionStore(pgDB)
+	tokenStore := store.NewPostgresTokenStore(pgDB)
+	twoFactorStore := store.NewPostgresTwoFactorStore(pgDB)
+	userHandler := api.NewUserHandler(userStore, sessionStore, tokenStore, twoFactorStore, authenticator, passwordPolicy, jobStore, notifier, auditor, logger)
+
+	followStore := store.NewPostgresFollowStore(pgDB)
+	coachStore := store.NewPostgresCoachStore(pgDB)
+	grantStore := store.NewPostgresGrantStore(pgDB)
+	commentStore := store.NewPostgresCommentStore(pgDB)
+	workoutAuthorizer := api.NewWorkoutAuthorizer(coachStore, followStore, grantStore)
+	measurementStore := store.NewPostgresMeasurementStore(pgDB)
+	measurementHandler := api.NewMeasurementHandler(measurementStore, userStore, auditor, logger)
+	sampleStore := store.NewPostgresSampleStore(pgDB)
+	progressionStore := store.NewPostgresProgressionStore(pgDB)
+	workoutHandler := api.NewWorkoutHandler(workoutStore, grantStore, commentStore, userStore, measurementStore, sampleStore, progressionStore, workoutAuthorizer, auditor, logger)
+	loadStore := store.NewPostgresLoadStore(pgDB)
+	statsHandler := api.NewStatsHandler(workoutStore, userStore, loadStore, logger)
+
+	var providers []*oidc.Provider
+	if cfg.OIDCConfigFile != "" {
+		providerConfigs, err := oidc.LoadConfig(cfg.OIDCConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, providerConfig := range providerConfigs {
+			providers = append(providers, oidc.NewProvider(providerConfig, nil))
+		}
+	}
+	identityStore := store.NewPostgresIdentityStore(pgDB)
+	oidcHandler := api.NewOIDCHandler(providers, userStore, identityStore, userHandler, auditor, logger)
+
+	socialHandler := api.NewSocialHandler(followStore, userStore, workoutStore, auditor, logger)
+
+	coachHandler := api.NewCoachHandler(coachStore, userStore, workoutStore, workoutAuthorizer, auditor, logger)
+
+	webhookStore := store.NewPostgresWebhookStore(pgDB)
+	webhookHandler := api.NewWebhookHandler(webhookStore, false, auditor, logger)
+	adminWebhookHandler := api.NewWebhookHandler(webhookStore, true, auditor, logger)
+	webhookDeliverer := webhook.NewDeliverer(webhookStore, cfg.WebhookWorkers, logger)
+
+	jobHandler := api.NewJobHandler(jobStore, auditor, logger)
+	jobRunner := jobs.NewRunner(jobStore, cfg.JobWorkers, logger)
+	jobRunner.Register(store.JobSendEmail, jobs.SendEmail(userStore, tokenStore, mail))
+	jobRunner.Register(store.JobWorkoutSaved, jobs.WorkoutSaved(workoutStore, notifier))
+	jobRunner.Schedule(store.JobPurgeExpiredData, 24*time.Hour, jobs.PurgeExpiredData(store.NewPostgresMaintenanceStore(pgDB), logger))
+	// Remind users who stopped training, checking every hour
+	if cfg.TrainingGapDays > 0 {
+		gap := time.Duration(cfg.TrainingGapDays) * 24 * time.Hour
+		jobRunner.Schedule(store.JobTrainingGaps, time.Hour, jobs.CheckTrainingGaps(notifier, gap))
+	}
+
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, auditor, logger)
+
+	adminStore := store.NewPostgresAdminStore(pgDB)
+	adminHandler := api.NewAdminHandler(userStore, workoutStore, sessionStore, adminStore, auditStore, auditor, logger)
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		Config:         cfg,
-		DB:             pgDB,
+		Logger:              logger,
+		WorkoutHandler:      workoutHandler,
+		UserHandler:         userHandler,
+		AdminHandler:        adminHandler,
+		APIKeyHandler:       apiKeyHandler,
+		SocialHandler:       socialHandler,
+		CoachHandler:        coachHandler,
+		NotificationHandler: notificationHandler,
+		MeasurementHandler:  measurementHandler,
+		StatsHandler:        statsHandler,
+		Notifier:            notifier,
+		WebhookHandler:      webhookHandler,
+		AdminWebhookHandler: adminWebhookHandler,
+		WebhookDeliverer:    webhookDeliverer,
+		JobHandler:          jobHandler,
+		JobRunner:           jobRunner,
+		OIDCHandler:         oidcHandler,
+		Authenticator:       authenticator,
+		Keyring:             keyring,
+		KeysHandler:         keysHandler,
+		SessionStore:        sessionStore,
+		APIKeyStore:         apiKeyStore,
+		Config:              cfg,
+		DB:                  pgDB,
 	}
 	return app, nil
 }
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/middleware"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+// Entry describes one auditable action. ActorID defaults to the
+// authenticated user of the request; set it for unauthenticated actions
+// such as logins. Before and After are diffed into the recorded changes.
+type Entry struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   int64
+	Before     any
+	After      any
+	Metadata   map[string]any
+}
+
+// Auditor records audit events along with who made the request and from where.
+type Auditor struct {
+	AuditStore store.AuditStore
+	Logger     *log.Logger
+}
+
+func NewAuditor(auditStore store.AuditStore, logger *log.Logger) *Auditor {
+	return &Auditor{
+		AuditStore: auditStore,
+		Logger:     logger,
+	}
+}
+
+// Record stores the entry. It never fails the request: by the time an
+// action is audited it has already happened, so errors are only logged.
+func (a *Auditor) Record(r *http.Request, entry Entry) {
+	event := &store.AuditEvent{
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		IP:         utils.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+
+	if event.ActorID == nil {
+		if principal, err := middleware.GetPrincipalFromContext(r.Context()); err == nil {
+			event.ActorID = &principal.UserID
+		}
+	}
+	if entry.TargetID != 0 {
+		event.TargetID = &entry.TargetID
+	}
+	if requestID, err := middleware.GetRequestIDFromContext(r.Context()); err == nil {
+		event.RequestID = requestID
+	}
+
+	if entry.Before != nil || entry.After != nil {
+		changes, err := Diff(entry.Before, entry.After)
+		if err != nil {
+			a.Logger.Printf("ERROR: diffing audit event %s: %v", entry.Action, err)
+		} else if len(changes) > 0 {
+			event.Changes, _ = json.Marshal(changes)
+		}
+	}
+
+	if len(entry.Metadata) > 0 {
+		metadata, err := json.Marshal(entry.Metadata)
+		if err != nil {
+			a.Logger.Printf("ERROR: encoding audit metadata %s: %v", entry.Action, err)
+		}
+		event.Metadata = metadata
+	}
+
+	err := a.AuditStore.RecordAuditEvent(event)
+	if err != nil {
+		a.Logger.Printf("ERROR: recording audit event %s: %v", entry.Action, err)
+	}
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Change is the old and new value of one field.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff compares the JSON representations of before and after and returns
+// the top-level fields that differ. Either side may be nil, for creations
+// and deletions. Fields hidden from JSON (such as password hashes) never
+// show up.
+func Diff(before, after any) (map[string]Change, error) {
+	from, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for key, oldValue := range from {
+		newValue, ok := to[key]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = Change{From: oldValue, To: newValue}
+		}
+	}
+	for key, newValue := range to {
+		if _, ok := from[key]; !ok {
+			changes[key] = Change{From: nil, To: newValue}
+		}
+	}
+
+	return changes, nil
+}
+
+func toMap(v any) (map[string]any, error) {
+	m := map[string]any{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return m, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	calories := 300
+
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   map[string]Change
+	}{
+		{
+			name:   "unchanged",
+			before: &store.Workout{ID: 1, Title: "push day"},
+			after:  &store.Workout{ID: 1, Title: "push day"},
+			want:   map[string]Change{},
+		},
+		{
+			name:   "changed fields only",
+			before: &store.Workout{ID: 1, Title: "push day", DurationMinutes: 60},
+			after:  &store.Workout{ID: 1, Title: "pull day", DurationMinutes: 60},
+			want: map[string]Change{
+				"title": {From: "push day", To: "pull day"},
+			},
+		},
+		{
+			name:   "omitted field added",
+			before: &store.Workout{ID: 1},
+			after:  &store.Workout{ID: 1, CaloriesBurned: &calories},
+			want: map[string]Change{
+				"calories_burned": {From: nil, To: float64(300)},
+			},
+		},
+		{
+			name:   "creation",
+			before: nil,
+			after:  map[string]any{"title": "legs"},
+			want: map[string]Change{
+				"title": {From: nil, To: "legs"},
+			},
+		},
+		{
+			name:   "deletion from typed nil",
+			before: map[string]any{"title": "legs"},
+			after:  (*store.Workout)(nil),
+			want: map[string]Change{
+				"title": {From: "legs", To: nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.before, tt.after)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDiffHidesPasswordHash(t *testing.T) {
+	before := &store.User{ID: 1, Username: "johndoe"}
+	after := &store.User{ID: 1, Username: "johndoe"}
+	require.NoError(t, after.PasswordHash.Set("secret"))
+
+	got, err := Diff(before, after)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
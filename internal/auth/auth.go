@@ -4,5 +4,5 @@ import "github.com/golang-jwt/jwt/v5"
 
 type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
-	ValidateToken(token string) (*jwt.Token, error)
-}
\ No newline at end of file
+	ValidateToken(token string) (*CustomClaims, error)
+}
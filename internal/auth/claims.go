@@ -1,24 +1,38 @@
 package auth
 
 import (
+	"errors"
 	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// Issuer is the "iss" claim of every token this service issues.
+	Issuer = "workout-tracker-app"
+	// Audience is the "aud" claim of every token this service issues.
+	Audience = "workout-tracker-users"
+	// TokenTTL is how long an access token (and its session) stays valid.
+	TokenTTL = 24 * time.Hour
+)
+
 type CustomClaims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    int    `json:"user_id"`
+	SessionID int64  `json:"sid"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func NewCustomClaims(userID int, email string, issuer, audience string, expiration time.Duration) *CustomClaims {
+func NewCustomClaims(userID int, sessionID int64, email, role string, issuer, audience string, expiration time.Duration) *CustomClaims {
 	now := time.Now()
 
 	return &CustomClaims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		SessionID: sessionID,
+		Email:     email,
+		Role:      role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   strconv.Itoa(userID), // JWT standard: sub should be a string
 			Issuer:    issuer,
@@ -29,3 +43,25 @@ func NewCustomClaims(userID int, email string, issuer, audience string, expirati
 		},
 	}
 }
+
+// Principal converts validated claims into the caller identity. The "sub"
+// claim is authoritative; "user_id" is kept for older clients and must agree.
+func (c *CustomClaims) Principal() (*Principal, error) {
+	userID, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return nil, errors.New("invalid subject claim")
+	}
+	if c.UserID != 0 && c.UserID != userID {
+		return nil, errors.New("subject and user_id claims disagree")
+	}
+	if c.SessionID == 0 {
+		return nil, errors.New("missing session claim")
+	}
+
+	return &Principal{
+		UserID:    userID,
+		Email:     c.Email,
+		Role:      c.Role,
+		SessionID: c.SessionID,
+	}, nil
+}
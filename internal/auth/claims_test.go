@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsPrincipal(t *testing.T) {
+	authenticator := NewJWTAuthenticator("mysecret", Audience, Issuer)
+
+	// Above 2^53, where decoding into float64 would round the id
+	const bigID = 9007199254740993
+
+	token, err := authenticator.GenerateToken(NewCustomClaims(bigID, 12, "john@example.com", RoleAdmin, Issuer, Audience, time.Hour))
+	require.NoError(t, err)
+
+	claims, err := authenticator.ValidateToken(token)
+	require.NoError(t, err)
+
+	principal, err := claims.Principal()
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{
+		UserID:    bigID,
+		Email:     "john@example.com",
+		Role:      RoleAdmin,
+		SessionID: 12,
+	}, principal)
+	assert.True(t, principal.HasPermission(PermissionAuditRead))
+	assert.True(t, principal.HasScope("workouts:write"), "sessions are not scope limited")
+}
+
+func TestClaimsPrincipalRejectsInconsistentClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*CustomClaims)
+	}{
+		{name: "non-numeric subject", mutate: func(c *CustomClaims) { c.Subject = "john" }},
+		{name: "subject and user_id disagree", mutate: func(c *CustomClaims) { c.UserID = 2 }},
+		{name: "missing session", mutate: func(c *CustomClaims) { c.SessionID = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := NewCustomClaims(1, 1, "john@example.com", RoleUser, Issuer, Audience, time.Hour)
+			tt.mutate(claims)
+
+			_, err := claims.Principal()
+			assert.Error(t, err)
+		})
+	}
+}
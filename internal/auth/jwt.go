@@ -39,8 +39,10 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 }
 
 // ValidateToken verifies the token's signature and standard claims like exp, aud, iss, alg.
-func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
-	return jwt.Parse(token,
+// The claims are decoded into CustomClaims, so numeric ids keep full precision.
+func (a *JWTAuthenticator) ValidateToken(token string) (*CustomClaims, error) {
+	claims := &CustomClaims{}
+	_, err := jwt.ParseWithClaims(token, claims,
 		// Key function: provides the secret key after checking algorithm
 		func(t *jwt.Token) (any, error) {
 			// Validate that the signing method is HMAC (e.g. HS256)
@@ -66,4 +68,9 @@ func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 		// Accept only this specific signing method to avoid downgrade or substitution attacks
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
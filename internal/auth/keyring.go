@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key statuses. Exactly one key is active and signs new tokens. Passive
+// keys are published and still verify tokens: either the previous active
+// key whose tokens haven't expired yet, or the next key announced ahead of
+// a rotation so verifiers can cache it. Retired keys verify nothing.
+const (
+	KeyStatusActive  = "active"
+	KeyStatusPassive = "passive"
+	KeyStatusRetired = "retired"
+)
+
+const manifestFile = "keyring.json"
+
+var ErrNoActiveKey = errors.New("keyring has no active key")
+
+// SigningKey is one asymmetric key of the keyring.
+type SigningKey struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+
+	private crypto.Signer
+}
+
+// Public returns the public half of the key.
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// GenerateKey creates a passive key for the algorithm.
+func GenerateKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+
+	return &SigningKey{
+		ID:        base64.RawURLEncoding.EncodeToString(sum[:12]),
+		Algorithm: algorithm,
+		Status:    KeyStatusPassive,
+		CreatedAt: time.Now().UTC(),
+		private:   private,
+	}, nil
+}
+
+// Keyring is a set of signing keys persisted in a directory: a keyring.json
+// manifest plus one PKCS #8 PEM file per key, named after its kid.
+type Keyring struct {
+	mu   sync.RWMutex
+	dir  string
+	keys []*SigningKey
+}
+
+// NewKeyring returns an empty keyring stored in dir.
+func NewKeyring(dir string) *Keyring {
+	return &Keyring{dir: dir}
+}
+
+// LoadKeyring reads the keyring stored in dir.
+func LoadKeyring(dir string) (*Keyring, error) {
+	k := NewKeyring(dir)
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload re-reads the keyring from disk, picking up rotations made by the
+// keys command without restarting the server.
+func (k *Keyring) Reload() error {
+	data, err := os.ReadFile(filepath.Join(k.dir, manifestFile))
+	if err != nil {
+		return fmt.Errorf("keyring: read manifest: %w", err)
+	}
+
+	var manifest struct {
+		Keys []*SigningKey `json:"keys"`
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return fmt.Errorf("keyring: decode manifest: %w", err)
+	}
+
+	for _, key := range manifest.Keys {
+		if key.Status == KeyStatusRetired {
+			continue
+		}
+
+		pemData, err := os.ReadFile(filepath.Join(k.dir, key.ID+".pem"))
+		if err != nil {
+			return fmt.Errorf("keyring: read key %s: %w", key.ID, err)
+		}
+		block, _ := pem.Decode(pemData)
+		if block == nil {
+			return fmt.Errorf("keyring: key %s is not PEM encoded", key.ID)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("keyring: parse key %s: %w", key.ID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("keyring: key %s cannot sign", key.ID)
+		}
+		key.private = signer
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = manifest.Keys
+	return nil
+}
+
+// Save writes the manifest and any key files that don't exist yet.
+// Retired keys' private key files are deleted.
+func (k *Keyring) Save() error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	err := os.MkdirAll(k.dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range k.keys {
+		path := filepath.Join(k.dir, key.ID+".pem")
+
+		if key.Status == KeyStatusRetired {
+			err = os.Remove(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key.private)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"keys": k.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write the manifest last so it never references a missing key file
+	tmp := filepath.Join(k.dir, manifestFile+".tmp")
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(k.dir, manifestFile))
+}
+
+// Keys returns every key, newest first.
+func (k *Keyring) Keys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := append([]*SigningKey(nil), k.keys...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys
+}
+
+// Add puts a freshly generated key into the keyring as passive.
+func (k *Keyring) Add(key *SigningKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key.Status = KeyStatusPassive
+	k.keys = append(k.keys, key)
+}
+
+// Rotate makes the newest passive key active, or generates one with the
+// algorithm if there is none. The previously active key turns passive so
+// tokens it signed stay valid until they expire.
+func (k *Keyring) Rotate(algorithm string) (*SigningKey, error) {
+	var next *SigningKey
+	for _, key := range k.Keys() {
+		if key.Status == KeyStatusPassive && key.CreatedAt.After(k.activeCreatedAt()) {
+			next = key
+			break
+		}
+	}
+
+	if next == nil {
+		generated, err := GenerateKey(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		k.Add(generated)
+		next = generated
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range k.keys {
+		if key.Status == KeyStatusActive {
+			key.Status = KeyStatusPassive
+		}
+	}
+	next.Status = KeyStatusActive
+	return next, nil
+}
+
+// Retire stops a passive key from verifying tokens. The active key can't be
+// retired; rotate first.
+func (k *Keyring) Retire(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, key := range k.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.Status == KeyStatusActive {
+			return errors.New("cannot retire the active key")
+		}
+		key.Status = KeyStatusRetired
+		key.private = nil
+		return nil
+	}
+	return fmt.Errorf("key %q not found", kid)
+}
+
+func (k *Keyring) activeCreatedAt() time.Time {
+	active, err := k.Active()
+	if err != nil {
+		return time.Time{}
+	}
+	return active.CreatedAt
+}
+
+// Active returns the key new tokens are signed with.
+func (k *Keyring) Active() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.Status == KeyStatusActive {
+			return key, nil
+		}
+	}
+	return nil, ErrNoActiveKey
+}
+
+// Lookup returns the non-retired key with the kid, or nil.
+func (k *Keyring) Lookup(kid string) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == kid && key.Status != KeyStatusRetired {
+			return key
+		}
+	}
+	return nil
+}
+
+// JWK is the public JSON Web Key representation of a signing key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys verifiers should trust: every key that
+// isn't retired.
+func (k *Keyring) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, key := range k.Keys() {
+		if key.Status == KeyStatusRetired {
+			continue
+		}
+
+		jwk := JWK{Use: "sig", Algorithm: key.Algorithm, KeyID: key.ID}
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// KeyringAuthenticator signs tokens with the keyring's active key and
+// verifies them with whichever non-retired key the "kid" header names.
+type KeyringAuthenticator struct {
+	keyring *Keyring
+	aud     string
+	iss     string
+}
+
+func NewKeyringAuthenticator(keyring *Keyring, aud, iss string) *KeyringAuthenticator {
+	return &KeyringAuthenticator{
+		keyring: keyring,
+		aud:     aud,
+		iss:     iss,
+	}
+}
+
+// Keyring exposes the underlying keyring, e.g. to publish its JWKS.
+func (a *KeyringAuthenticator) Keyring() *Keyring {
+	return a.keyring
+}
+
+func (a *KeyringAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	key, err := a.keyring.Active()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+func (a *KeyringAuthenticator) ValidateToken(token string) (*CustomClaims, error) {
+	claims := &CustomClaims{}
+	_, err := jwt.ParseWithClaims(token, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			key := a.keyring.Lookup(kid)
+			if key == nil {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+
+			// A key only verifies tokens signed with its own algorithm
+			if t.Method.Alg() != key.Algorithm {
+				return nil, fmt.Errorf("unexpected signing method %v for key %s", t.Header["alg"], kid)
+			}
+			return key.Public(), nil
+		},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClaims() *CustomClaims {
+	return NewCustomClaims(42, 7, "john@example.com", RoleUser, Issuer, Audience, time.Hour)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	for _, alg := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			dir := t.TempDir()
+			keyring := NewKeyring(dir)
+			first, err := keyring.Rotate(alg)
+			require.NoError(t, err)
+			require.NoError(t, keyring.Save())
+
+			authenticator := NewKeyringAuthenticator(keyring, Audience, Issuer)
+			oldToken, err := authenticator.GenerateToken(newTestClaims())
+			require.NoError(t, err)
+
+			// Rotate on disk, as the keys command would, then reload
+			onDisk, err := LoadKeyring(dir)
+			require.NoError(t, err)
+			second, err := onDisk.Rotate(alg)
+			require.NoError(t, err)
+			require.NoError(t, onDisk.Save())
+			require.NoError(t, keyring.Reload())
+
+			newToken, err := authenticator.GenerateToken(newTestClaims())
+			require.NoError(t, err)
+
+			claims, err := authenticator.ValidateToken(newToken)
+			require.NoError(t, err)
+			assert.Equal(t, 42, claims.UserID)
+
+			unverified, _, err := jwt.NewParser().ParseUnverified(newToken, &CustomClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, second.ID, unverified.Header["kid"])
+
+			_, err = authenticator.ValidateToken(oldToken)
+			assert.NoError(t, err, "tokens signed by the previous key stay valid")
+
+			assert.Len(t, keyring.JWKS(), 2)
+
+			require.NoError(t, onDisk.Retire(first.ID))
+			require.NoError(t, onDisk.Save())
+			require.NoError(t, keyring.Reload())
+
+			_, err = authenticator.ValidateToken(oldToken)
+			assert.Error(t, err, "retired keys no longer verify")
+			assert.Len(t, keyring.JWKS(), 1)
+		})
+	}
+}
+
+func TestKeyringRotatePromotesAnnouncedKey(t *testing.T) {
+	keyring := NewKeyring(t.TempDir())
+	_, err := keyring.Rotate(AlgorithmEdDSA)
+	require.NoError(t, err)
+
+	announced, err := GenerateKey(AlgorithmEdDSA)
+	require.NoError(t, err)
+	keyring.Add(announced)
+
+	active, err := keyring.Rotate(AlgorithmEdDSA)
+	require.NoError(t, err)
+	assert.Equal(t, announced.ID, active.ID)
+	assert.Len(t, keyring.Keys(), 2)
+}
+
+func TestKeyringRejectsForeignTokens(t *testing.T) {
+	keyring := NewKeyring(t.TempDir())
+	_, err := keyring.Rotate(AlgorithmEdDSA)
+	require.NoError(t, err)
+	authenticator := NewKeyringAuthenticator(keyring, Audience, Issuer)
+
+	hmacToken, err := NewJWTAuthenticator("mysecret", Audience, Issuer).GenerateToken(newTestClaims())
+	require.NoError(t, err)
+	_, err = authenticator.ValidateToken(hmacToken)
+	assert.Error(t, err)
+
+	other := NewKeyring(t.TempDir())
+	_, err = other.Rotate(AlgorithmEdDSA)
+	require.NoError(t, err)
+	foreignToken, err := NewKeyringAuthenticator(other, Audience, Issuer).GenerateToken(newTestClaims())
+	require.NoError(t, err)
+	_, err = authenticator.ValidateToken(foreignToken)
+	assert.Error(t, err)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, newTestClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = authenticator.ValidateToken(unsigned)
+	assert.Error(t, err)
+}
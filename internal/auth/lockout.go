@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginGuard tracks failed login attempts per key (an account, an IP, ...)
+// and locks a key out once it reaches the threshold. Each further failure
+// doubles the lockout, up to maxLockout. A key's history is forgotten after
+// maxLockout passes without a new failure.
+type LoginGuard struct {
+	mu          sync.Mutex
+	attempts    map[string]*loginAttempts
+	threshold   int
+	baseLockout time.Duration
+	maxLockout  time.Duration
+	now         func() time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginGuard creates a guard that locks a key after threshold failures.
+func NewLoginGuard(threshold int, baseLockout, maxLockout time.Duration) *LoginGuard {
+	return &LoginGuard{
+		attempts:    make(map[string]*loginAttempts),
+		threshold:   threshold,
+		baseLockout: baseLockout,
+		maxLockout:  maxLockout,
+		now:         time.Now,
+	}
+}
+
+// LockedFor reports how much longer key is locked out; zero means a login
+// attempt is allowed.
+func (g *LoginGuard) LockedFor(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.attempts[key]
+	if !ok {
+		return 0
+	}
+
+	remaining := a.lockedUntil.Sub(g.now())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Fail records a failed attempt for key.
+func (g *LoginGuard) Fail(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.prune(now)
+
+	a, ok := g.attempts[key]
+	if !ok {
+		a = &loginAttempts{}
+		g.attempts[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	if a.failures >= g.threshold {
+		lockout := g.baseLockout << (a.failures - g.threshold)
+		// The shift overflows to <= 0 long before failures get unreasonable
+		if lockout <= 0 || lockout > g.maxLockout {
+			lockout = g.maxLockout
+		}
+		a.lockedUntil = now.Add(lockout)
+	}
+}
+
+// Succeed clears the failure history of key.
+func (g *LoginGuard) Succeed(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.attempts, key)
+}
+
+// prune drops keys that are no longer locked and have been quiet for
+// maxLockout, so the map doesn't grow without bound.
+func (g *LoginGuard) prune(now time.Time) {
+	for key, a := range g.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > g.maxLockout {
+			delete(g.attempts, key)
+		}
+	}
+}
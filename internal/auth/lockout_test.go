@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginGuard(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	guard := NewLoginGuard(3, time.Minute, 10*time.Minute)
+	guard.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		fail    bool
+		want    time.Duration
+	}{
+		{name: "first failure", fail: true, want: 0},
+		{name: "second failure", fail: true, want: 0},
+		{name: "third failure locks", fail: true, want: time.Minute},
+		{name: "still locked", advance: 30 * time.Second, want: 30 * time.Second},
+		{name: "lock expires", advance: 30 * time.Second, want: 0},
+		{name: "fourth failure doubles", fail: true, want: 2 * time.Minute},
+		{name: "fifth failure doubles again", advance: 2 * time.Minute, fail: true, want: 4 * time.Minute},
+		{name: "sixth failure doubles again", advance: 4 * time.Minute, fail: true, want: 8 * time.Minute},
+		{name: "seventh failure is capped", advance: 8 * time.Minute, fail: true, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			if tt.fail {
+				guard.Fail("user:1")
+			}
+			assert.Equal(t, tt.want, guard.LockedFor("user:1"))
+		})
+	}
+
+	assert.Zero(t, guard.LockedFor("user:2"), "other keys are unaffected")
+
+	guard.Succeed("user:1")
+	assert.Zero(t, guard.LockedFor("user:1"))
+	guard.Fail("user:1")
+	assert.Zero(t, guard.LockedFor("user:1"), "success resets the failure count")
+}
+
+func TestLoginGuardForgetsQuietKeys(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	guard := NewLoginGuard(2, time.Minute, 5*time.Minute)
+	guard.now = func() time.Time { return now }
+
+	guard.Fail("ip:10.0.0.1")
+	now = now.Add(6 * time.Minute)
+	guard.Fail("ip:10.0.0.2")
+
+	_, ok := guard.attempts["ip:10.0.0.1"]
+	assert.False(t, ok)
+
+	guard.Fail("ip:10.0.0.1")
+	assert.Zero(t, guard.LockedFor("ip:10.0.0.1"), "failures older than the max lockout are forgotten")
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes is where bcrypt stops reading. Anything past it would be
+// silently ignored, so longer passwords are rejected instead.
+const MaxPasswordBytes = 72
+
+const DefaultPasswordMinLength = 8
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswords     map[string]struct{}
+	commonPasswordsOnce sync.Once
+)
+
+// IsCommonPassword reports whether password appears in the bundled list of
+// passwords known from public breaches. It works offline by design.
+func IsCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]struct{})
+		scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			commonPasswords[line] = struct{}{}
+		}
+	})
+
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+// PasswordPolicy decides whether a new password is acceptable. Existing
+// passwords are never re-checked, so tightening the policy only affects
+// passwords set afterwards.
+type PasswordPolicy struct {
+	MinLength int
+}
+
+func NewPasswordPolicy(minLength int) *PasswordPolicy {
+	if minLength <= 0 {
+		minLength = DefaultPasswordMinLength
+	}
+	return &PasswordPolicy{
+		MinLength: minLength,
+	}
+}
+
+// Validate returns an error describing why password can't be used by the
+// account with the given username and email. The message is safe to show
+// to the user.
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+
+	if len(password) > MaxPasswordBytes {
+		return fmt.Errorf("password cannot be longer than %d bytes", MaxPasswordBytes)
+	}
+
+	lower := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, personal := range []string{strings.ToLower(username), localPart} {
+		// Very short names would rule out too many unrelated passwords
+		if len(personal) >= 3 && strings.Contains(lower, personal) {
+			return errors.New("password cannot contain your username or email")
+		}
+	}
+
+	if IsCommonPassword(password) {
+		return errors.New("password is too common, please choose another")
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(10)
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{"valid", "correct horse battery", ""},
+		{"empty", "", "password is required"},
+		{"too short", "tr4ining!", "at least 10 characters"},
+		{"multibyte counts characters", "ünïcödé-pässwörd", ""},
+		{"too long", strings.Repeat("a1", 37), "longer than 72 bytes"},
+		{"contains username", "xJohnDoe-2024!", "username or email"},
+		{"contains email local part", "jdoe.fitness.2024", "username or email"},
+		{"common", "Password123", "too common"},
+		{"common is case insensitive", "QWERTYUIOP", "too common"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, "johndoe", "jdoe.fitness@example.com")
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPasswordPolicyDefaultsMinLength(t *testing.T) {
+	assert.Equal(t, DefaultPasswordMinLength, NewPasswordPolicy(0).MinLength)
+}
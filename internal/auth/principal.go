@@ -0,0 +1,33 @@
+package auth
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID    int
+	Email     string
+	Role      string
+	SessionID int64
+	// APIKeyID is set when the request authenticated with an API key
+	// rather than a session token.
+	APIKeyID int64
+	// Scopes limits what the caller may do. Nil means no limit beyond the
+	// role, which is the case for interactive sessions.
+	Scopes []string
+}
+
+// HasPermission reports whether the principal's role grants permission.
+func (p *Principal) HasPermission(permission string) bool {
+	return HasPermission(p.Role, permission)
+}
+
+// HasScope reports whether the principal may act within scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
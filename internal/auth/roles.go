@@ -0,0 +1,57 @@
+package auth
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+const (
+	PermissionUsersRead       = "users:read"
+	PermissionUsersManage     = "users:manage"
+	PermissionWorkoutsReadAny = "workouts:read_any"
+	PermissionStatsRead       = "stats:read"
+	PermissionAuditRead       = "audit:read"
+	PermissionWebhooksManage  = "webhooks:manage"
+	PermissionJobsManage      = "jobs:manage"
+)
+
+// rolePermissions lists what each role may do beyond managing its own data.
+var rolePermissions = map[string][]string{
+	RoleUser: {},
+	RoleSupport: {
+		PermissionUsersRead,
+		PermissionWorkoutsReadAny,
+		PermissionStatsRead,
+	},
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersManage,
+		PermissionWorkoutsReadAny,
+		PermissionStatsRead,
+		PermissionAuditRead,
+		PermissionWebhooksManage,
+		PermissionJobsManage,
+	},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// PermissionsForRole returns the permissions granted to role.
+func PermissionsForRole(role string) []string {
+	return rolePermissions[role]
+}
+
+// HasPermission reports whether role grants permission.
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
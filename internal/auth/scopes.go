@@ -0,0 +1,23 @@
+package auth
+
+// Scopes an API key can be limited to.
+const (
+	ScopeWorkoutsRead      = "workouts:read"
+	ScopeWorkoutsWrite     = "workouts:write"
+	ScopeProfileRead       = "profile:read"
+	ScopeMeasurementsRead  = "measurements:read"
+	ScopeMeasurementsWrite = "measurements:write"
+)
+
+var validScopes = map[string]bool{
+	ScopeWorkoutsRead:      true,
+	ScopeWorkoutsWrite:     true,
+	ScopeProfileRead:       true,
+	ScopeMeasurementsRead:  true,
+	ScopeMeasurementsWrite: true,
+}
+
+// ValidScope reports whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	return validScopes[scope]
+}
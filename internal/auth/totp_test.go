@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238 appendix B, base32 encoded.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; a 6-digit code is the last six of them
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "time %d", tt.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(rfc6238Secret, TOTPStep(now))
+	require.NoError(t, err)
+
+	step, ok := ValidateTOTP(rfc6238Secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now), step)
+
+	// A code from the previous period is still accepted for clock drift
+	step, ok = ValidateTOTP(rfc6238Secret, code, now.Add(TOTPPeriod))
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now), step)
+
+	_, ok = ValidateTOTP(rfc6238Secret, code, now.Add(3*TOTPPeriod))
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(rfc6238Secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	uri, err := url.Parse(TOTPURI("Workout Tracker", "john@example.com", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Workout Tracker:john@example.com", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Workout Tracker", uri.Query().Get("issuer"))
+}
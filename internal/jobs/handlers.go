@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/mailer"
+	"github.com/LikhithMar14/workout-tracker/internal/notify"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// EmailPayload is the payload of a store.JobSendEmail job: who to email and
+// which kind of token to send them. The token is only created when the
+// email goes out, so it never sits in the jobs table.
+type EmailPayload struct {
+	UserID int    `json:"user_id"`
+	Scope  string `json:"scope"`
+}
+
+// tokenEmail is how a token of one scope is emailed.
+type tokenEmail struct {
+	template string
+	// field is the template field the token goes in.
+	field string
+	ttl   time.Duration
+	// recipient returns the address to send the token to, or "" if the
+	// user no longer needs it.
+	recipient func(user *store.User) string
+}
+
+var tokenEmails = map[string]tokenEmail{
+	store.ScopeActivation: {
+		template: "user_welcome.tmpl",
+		field:    "ActivationToken",
+		ttl:      3 * 24 * time.Hour,
+		recipient: func(user *store.User) string {
+			if user.Activated {
+				return ""
+			}
+			return user.Email
+		},
+	},
+	store.ScopePasswordReset: {
+		template: "password_reset.tmpl",
+		field:    "PasswordResetToken",
+		ttl:      45 * time.Minute,
+		recipient: func(user *store.User) string {
+			if !user.Activated || user.DisabledAt != nil {
+				return ""
+			}
+			return user.Email
+		},
+	},
+	// Only the address waiting to be confirmed gets the token
+	store.ScopeEmailChange: {
+		template: "email_change.tmpl",
+		field:    "EmailChangeToken",
+		ttl:      24 * time.Hour,
+		recipient: func(user *store.User) string {
+			if user.PendingEmail == nil {
+				return ""
+			}
+			return *user.PendingEmail
+		},
+	},
+}
+
+// SendEmail creates a token for the user and emails it to them through m.
+// Emails the user no longer needs, because they were deleted or already
+// used another token, are skipped.
+func SendEmail(userStore store.UserStore, tokenStore store.TokenStore, m mailer.Mailer) HandlerFunc {
+	return Typed(func(ctx context.Context, payload EmailPayload) error {
+		email, ok := tokenEmails[payload.Scope]
+		if !ok {
+			return Permanent(fmt.Errorf("no email for token scope %q", payload.Scope))
+		}
+
+		user, err := userStore.GetUserByID(payload.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return nil
+		}
+
+		recipient := email.recipient(user)
+		if recipient == "" {
+			return nil
+		}
+
+		token, err := tokenStore.CreateToken(user.ID, email.ttl, payload.Scope)
+		if err != nil {
+			return err
+		}
+
+		return m.Send(recipient, email.template, map[string]any{
+			"Username":  user.Username,
+			email.field: token.Plaintext,
+		})
+	})
+}
+
+// WorkoutSaved runs the follow-up work for a workout once the transaction
+// saving it has committed.
+func WorkoutSaved(workoutStore store.WorkoutStore, notifier *notify.Notifier) HandlerFunc {
+	return Typed(func(ctx context.Context, payload store.WorkoutSavedPayload) error {
+		if !payload.Created {
+			return nil
+		}
+
+		workout, err := workoutStore.GetWorkoutByID(int64(payload.WorkoutID))
+		if err != nil {
+			return err
+		}
+		// Deleted before the job ran
+		if workout == nil {
+			return nil
+		}
+
+		notifier.WorkoutLogged(ctx, workout)
+		return nil
+	})
+}
+
+// CheckTrainingGaps notifies users who haven't trained for longer than gap.
+func CheckTrainingGaps(notifier *notify.Notifier, gap time.Duration) HandlerFunc {
+	return func(ctx context.Context, job *store.Job) error {
+		return notifier.CheckTrainingGaps(ctx, gap)
+	}
+}
+
+// PurgeExpiredData deletes data past its retention period.
+func PurgeExpiredData(maintenanceStore store.MaintenanceStore, logger *log.Logger) HandlerFunc {
+	return func(ctx context.Context, job *store.Job) error {
+		deleted, err := maintenanceStore.PurgeExpiredData(time.Now())
+		if err != nil {
+			return fmt.Errorf("purging expired data: %w", err)
+		}
+		logger.Printf("INFO: purged expired data: %v", deleted)
+		return nil
+	}
+}
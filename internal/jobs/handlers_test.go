@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUserStore struct {
+	store.UserStore
+	users map[int]*store.User
+}
+
+func (f *fakeUserStore) GetUserByID(id int) (*store.User, error) {
+	return f.users[id], nil
+}
+
+type fakeTokenStore struct {
+	store.TokenStore
+	tokens []*store.Token
+}
+
+func (f *fakeTokenStore) CreateToken(userID int, ttl time.Duration, scope string) (*store.Token, error) {
+	token := &store.Token{Plaintext: "token-" + scope, UserID: userID, Expiry: time.Now().Add(ttl), Scope: scope}
+	f.tokens = append(f.tokens, token)
+	return token, nil
+}
+
+type sentEmail struct {
+	recipient string
+	template  string
+	data      map[string]any
+}
+
+type fakeMailer struct {
+	sent []sentEmail
+}
+
+func (f *fakeMailer) Send(recipient, templateFile string, data any) error {
+	f.sent = append(f.sent, sentEmail{recipient, templateFile, data.(map[string]any)})
+	return nil
+}
+
+func TestSendEmail(t *testing.T) {
+	pending := "new@example.com"
+	users := &fakeUserStore{users: map[int]*store.User{
+		1: {ID: 1, Username: "ada", Email: "ada@example.com"},
+		2: {ID: 2, Username: "bob", Email: "bob@example.com", Activated: true},
+		3: {ID: 3, Username: "cy", Email: "cy@example.com", Activated: true, PendingEmail: &pending},
+	}}
+
+	tests := []struct {
+		name      string
+		payload   EmailPayload
+		recipient string
+		template  string
+		field     string
+	}{
+		{
+			name:      "activation",
+			payload:   EmailPayload{UserID: 1, Scope: store.ScopeActivation},
+			recipient: "ada@example.com",
+			template:  "user_welcome.tmpl",
+			field:     "ActivationToken",
+		},
+		{
+			name:      "password reset",
+			payload:   EmailPayload{UserID: 2, Scope: store.ScopePasswordReset},
+			recipient: "bob@example.com",
+			template:  "password_reset.tmpl",
+			field:     "PasswordResetToken",
+		},
+		{
+			name:      "email change goes to the new address",
+			payload:   EmailPayload{UserID: 3, Scope: store.ScopeEmailChange},
+			recipient: "new@example.com",
+			template:  "email_change.tmpl",
+			field:     "EmailChangeToken",
+		},
+		{
+			name:    "activation of an active account is skipped",
+			payload: EmailPayload{UserID: 2, Scope: store.ScopeActivation},
+		},
+		{
+			name:    "password reset of an inactive account is skipped",
+			payload: EmailPayload{UserID: 1, Scope: store.ScopePasswordReset},
+		},
+		{
+			name:    "email change without a pending address is skipped",
+			payload: EmailPayload{UserID: 2, Scope: store.ScopeEmailChange},
+		},
+		{
+			name:    "deleted user is skipped",
+			payload: EmailPayload{UserID: 99, Scope: store.ScopeActivation},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := &fakeTokenStore{}
+			mail := &fakeMailer{}
+			payload, err := json.Marshal(tt.payload)
+			require.NoError(t, err)
+
+			err = SendEmail(users, tokens, mail)(context.Background(), &store.Job{Type: store.JobSendEmail, Payload: payload})
+			require.NoError(t, err)
+
+			if tt.recipient == "" {
+				assert.Empty(t, mail.sent)
+				assert.Empty(t, tokens.tokens, "no token is created for a skipped email")
+				return
+			}
+			require.Len(t, mail.sent, 1)
+			require.Len(t, tokens.tokens, 1)
+			assert.Equal(t, tt.recipient, mail.sent[0].recipient)
+			assert.Equal(t, tt.template, mail.sent[0].template)
+			assert.Equal(t, tokens.tokens[0].Plaintext, mail.sent[0].data[tt.field])
+		})
+	}
+}
+
+func TestSendEmailUnknownScopeIsPermanent(t *testing.T) {
+	handler := SendEmail(&fakeUserStore{}, &fakeTokenStore{}, &fakeMailer{})
+	err := handler(context.Background(), &store.Job{Type: store.JobSendEmail, Payload: []byte(`{"user_id": 1, "scope": "mfa"}`)})
+
+	var permanent permanentError
+	assert.ErrorAs(t, err, &permanent)
+}
@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+const (
+	// BaseBackoff is the wait before a failed job's first retry; it doubles
+	// with each attempt.
+	BaseBackoff = 10 * time.Second
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff = time.Hour
+)
+
+// HandlerFunc runs one job. Returning an error retries the job later, or
+// dead-letters it once it is out of attempts or the error is Permanent.
+type HandlerFunc func(ctx context.Context, job *store.Job) error
+
+// Typed adapts a handler taking the job's decoded payload. Payloads that
+// don't decode are dead-lettered straight away.
+func Typed[T any](fn func(ctx context.Context, payload T) error) HandlerFunc {
+	return func(ctx context.Context, job *store.Job) error {
+		var payload T
+		err := json.Unmarshal(job.Payload, &payload)
+		if err != nil {
+			return Permanent(fmt.Errorf("decoding %s payload: %w", job.Type, err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error retrying won't fix.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Backoff returns how long to wait before retrying a job that failed on
+// the given attempt.
+func Backoff(attempt int) time.Duration {
+	wait := BaseBackoff
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return wait
+}
+
+// Runner claims jobs from the queue and runs them with a pool of workers.
+// Several runners, in one process or many, can share the queue.
+type Runner struct {
+	JobStore     store.JobStore
+	Workers      int
+	PollInterval time.Duration
+	// Lease is how long a claimed job may run before another runner assumes
+	// its worker died and claims it again.
+	Lease  time.Duration
+	Logger *log.Logger
+
+	handlers  map[string]HandlerFunc
+	recurring map[string]time.Duration
+	now       func() time.Time
+}
+
+func NewRunner(jobStore store.JobStore, workers int, logger *log.Logger) *Runner {
+	return &Runner{
+		JobStore:     jobStore,
+		Workers:      max(workers, 1),
+		PollInterval: time.Second,
+		Lease:        5 * time.Minute,
+		Logger:       logger,
+		handlers:     map[string]HandlerFunc{},
+		recurring:    map[string]time.Duration{},
+		now:          time.Now,
+	}
+}
+
+// Register sets the handler for a job type.
+func (r *Runner) Register(jobType string, handler HandlerFunc) {
+	r.handlers[jobType] = handler
+}
+
+// Schedule registers a handler that runs every interval. The next run is
+// queued once the current one finishes, whether it succeeded or died.
+func (r *Runner) Schedule(jobType string, interval time.Duration, handler HandlerFunc) {
+	r.Register(jobType, handler)
+	r.recurring[jobType] = interval
+}
+
+func (r *Runner) types() []string {
+	types := make([]string, 0, len(r.handlers))
+	for jobType := range r.handlers {
+		types = append(types, jobType)
+	}
+	return types
+}
+
+// enqueueRecurring queues the next run of a recurring job. The unique key
+// keeps runners from queueing it twice.
+func (r *Runner) enqueueRecurring(jobType string, runAt time.Time) {
+	key := jobType
+	err := r.JobStore.EnqueueJob(&store.Job{Type: jobType, UniqueKey: &key, RunAt: runAt})
+	if err != nil {
+		r.Logger.Printf("ERROR: scheduling %s job: %v", jobType, err)
+	}
+}
+
+// RunOnce claims a batch of due jobs, runs them and returns how many it ran.
+// It claims no more jobs than it has workers, so every job starts as soon as
+// it is claimed; jobs queued behind a slow one could outlive their lease and
+// be claimed, and run, a second time.
+func (r *Runner) RunOnce(ctx context.Context) (int, error) {
+	claimed, err := r.JobStore.ClaimJobs(r.types(), r.Workers, r.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan *store.Job)
+	var wg sync.WaitGroup
+	for range r.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				r.run(ctx, job)
+			}
+		}()
+	}
+	for _, job := range claimed {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	return len(claimed), nil
+}
+
+func (r *Runner) run(ctx context.Context, job *store.Job) {
+	err := r.call(ctx, job)
+
+	var permanent permanentError
+	switch {
+	case err == nil:
+		err = r.JobStore.CompleteJob(job.ID, job.Attempts)
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		r.Logger.Printf("ERROR: job %d (%s) is dead after %d attempts: %v", job.ID, job.Type, job.Attempts, err)
+		err = r.JobStore.KillJob(job.ID, job.Attempts, err.Error())
+	default:
+		err = r.JobStore.RetryJob(job.ID, job.Attempts, err.Error(), r.now().Add(Backoff(job.Attempts)))
+		if err == nil {
+			return
+		}
+	}
+	// The job ran past its lease and another runner claimed it again; that
+	// runner now owns it, including queueing the next run of recurring jobs
+	if errors.Is(err, sql.ErrNoRows) {
+		r.Logger.Printf("WARN: job %d (%s) lost its lease on attempt %d", job.ID, job.Type, job.Attempts)
+		return
+	}
+	if err != nil {
+		r.Logger.Printf("ERROR: updating job %d: %v", job.ID, err)
+	}
+
+	if interval, ok := r.recurring[job.Type]; ok {
+		r.enqueueRecurring(job.Type, r.now().Add(interval))
+	}
+}
+
+// call runs the job's handler, turning a panic into a permanent error.
+func (r *Runner) call(ctx context.Context, job *store.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = Permanent(fmt.Errorf("panic: %v", p))
+		}
+	}()
+
+	handler, ok := r.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job type %q", job.Type))
+	}
+	return handler(ctx, job)
+}
+
+// Run queues the first run of every recurring job, then runs due jobs
+// until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	for jobType := range r.recurring {
+		r.enqueueRecurring(jobType, r.now())
+	}
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while there's a backlog, then wait for the next tick
+		ran, err := r.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.Logger.Printf("ERROR: running jobs: %v", err)
+		}
+		if ran > 0 && err == nil && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
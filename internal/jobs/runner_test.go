@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore hands out its due jobs once and records how each one finished.
+type fakeStore struct {
+	store.JobStore
+
+	mu       sync.Mutex
+	due      []*store.Job
+	statuses map[int64]string
+	runAt    map[int64]time.Time
+	errors   map[int64]string
+	enqueued []*store.Job
+	// lost holds jobs another runner claimed again after their lease ran out.
+	lost map[int64]bool
+}
+
+func newFakeStore(due ...*store.Job) *fakeStore {
+	return &fakeStore{
+		due:      due,
+		statuses: map[int64]string{},
+		runAt:    map[int64]time.Time{},
+		errors:   map[int64]string{},
+		lost:     map[int64]bool{},
+	}
+}
+
+func (f *fakeStore) EnqueueJob(job *store.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enqueued = append(f.enqueued, job)
+	return nil
+}
+
+func (f *fakeStore) ClaimJobs(types []string, limit int, lease time.Duration) ([]*store.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(limit, len(f.due))
+	claimed := f.due[:n]
+	f.due = f.due[n:]
+	return claimed, nil
+}
+
+func (f *fakeStore) CompleteJob(id int64, attempt int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lost[id] {
+		return sql.ErrNoRows
+	}
+	f.statuses[id] = store.JobSucceeded
+	return nil
+}
+
+func (f *fakeStore) RetryJob(id int64, attempt int, lastError string, runAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lost[id] {
+		return sql.ErrNoRows
+	}
+	f.statuses[id] = store.JobPending
+	f.errors[id] = lastError
+	f.runAt[id] = runAt
+	return nil
+}
+
+func (f *fakeStore) KillJob(id int64, attempt int, lastError string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lost[id] {
+		return sql.ErrNoRows
+	}
+	f.statuses[id] = store.JobDead
+	f.errors[id] = lastError
+	return nil
+}
+
+// claimedJob is a job as ClaimJobs returns it, on its attempts'th attempt.
+func claimedJob(id int64, jobType, payload string, attempts int) *store.Job {
+	return &store.Job{
+		ID:          id,
+		Type:        jobType,
+		Payload:     []byte(payload),
+		Status:      store.JobRunning,
+		Attempts:    attempts,
+		MaxAttempts: 3,
+	}
+}
+
+func newTestRunner(jobStore store.JobStore) *Runner {
+	runner := NewRunner(jobStore, 2, log.New(io.Discard, "", 0))
+	now := time.Unix(1700000000, 0)
+	runner.now = func() time.Time { return now }
+	return runner
+}
+
+func TestRunOnce(t *testing.T) {
+	type greeting struct {
+		Name string `json:"name"`
+	}
+
+	var mu sync.Mutex
+	greeted := []string{}
+
+	jobStore := newFakeStore(
+		claimedJob(1, "greet", `{"name":"ada"}`, 1),
+		claimedJob(2, "greet", `{"name":"fail"}`, 1),
+		claimedJob(3, "greet", `{"name":"fail"}`, 3),
+		claimedJob(4, "greet", `not json`, 1),
+		claimedJob(5, "greet", `{"name":"panic"}`, 1),
+		claimedJob(6, "unknown", `{}`, 1),
+	)
+	runner := newTestRunner(jobStore)
+	runner.Register("greet", Typed(func(ctx context.Context, payload greeting) error {
+		switch payload.Name {
+		case "fail":
+			return errors.New("temporarily unavailable")
+		case "panic":
+			panic("boom")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		greeted = append(greeted, payload.Name)
+		return nil
+	}))
+
+	// Each batch is one job per worker
+	ran := 0
+	for {
+		n, err := runner.RunOnce(context.Background())
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+		assert.LessOrEqual(t, n, runner.Workers)
+		ran += n
+	}
+	assert.Equal(t, 6, ran)
+	assert.Equal(t, []string{"ada"}, greeted)
+
+	tests := []struct {
+		name   string
+		id     int64
+		status string
+	}{
+		{"succeeded", 1, store.JobSucceeded},
+		{"failure with attempts left is retried", 2, store.JobPending},
+		{"failure on the last attempt is dead", 3, store.JobDead},
+		{"undecodable payload is dead", 4, store.JobDead},
+		{"panic is dead", 5, store.JobDead},
+		{"unknown type is dead", 6, store.JobDead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, jobStore.statuses[tt.id])
+		})
+	}
+
+	assert.Equal(t, runner.now().Add(BaseBackoff), jobStore.runAt[2])
+	assert.Equal(t, "temporarily unavailable", jobStore.errors[2])
+	assert.Contains(t, jobStore.errors[5], "panic: boom")
+}
+
+func TestPermanentErrorIsNotRetried(t *testing.T) {
+	jobStore := newFakeStore(claimedJob(1, "invalid", `{}`, 1))
+	runner := newTestRunner(jobStore)
+	runner.Register("invalid", func(ctx context.Context, job *store.Job) error {
+		return Permanent(errors.New("recipient rejected"))
+	})
+
+	_, err := runner.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, store.JobDead, jobStore.statuses[1])
+	assert.Equal(t, "recipient rejected", jobStore.errors[1])
+}
+
+func TestScheduledJobIsRequeued(t *testing.T) {
+	jobStore := newFakeStore(claimedJob(1, "purge", `{}`, 1))
+	runner := newTestRunner(jobStore)
+	runner.Schedule("purge", time.Hour, func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+
+	_, err := runner.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, store.JobSucceeded, jobStore.statuses[1])
+
+	require.Len(t, jobStore.enqueued, 1)
+	next := jobStore.enqueued[0]
+	assert.Equal(t, "purge", next.Type)
+	require.NotNil(t, next.UniqueKey)
+	assert.Equal(t, "purge", *next.UniqueKey)
+	assert.Equal(t, runner.now().Add(time.Hour), next.RunAt)
+}
+
+func TestLostLeaseLeavesJobToNewOwner(t *testing.T) {
+	jobStore := newFakeStore(claimedJob(1, "purge", `{}`, 1))
+	jobStore.lost[1] = true
+	runner := newTestRunner(jobStore)
+	runner.Schedule("purge", time.Hour, func(ctx context.Context, job *store.Job) error {
+		return nil
+	})
+
+	_, err := runner.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, jobStore.statuses)
+	assert.Empty(t, jobStore.enqueued, "the runner holding the lease queues the next run")
+}
+
+// endlessStore always has another job due.
+type endlessStore struct {
+	*fakeStore
+	claims int
+}
+
+func (f *endlessStore) ClaimJobs(types []string, limit int, lease time.Duration) ([]*store.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.claims++
+	return []*store.Job{claimedJob(int64(f.claims), "work", `{}`, 1)}, nil
+}
+
+func TestRunStopsWithBacklog(t *testing.T) {
+	jobStore := &endlessStore{fakeStore: newFakeStore()}
+	runner := newTestRunner(jobStore)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner.Register("work", func(ctx context.Context, job *store.Job) error {
+		if job.ID == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run kept draining the queue after ctx was cancelled")
+	}
+	assert.Equal(t, 3, jobStore.claims)
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Backoff(tt.attempt), "attempt %d", tt.attempt)
+	}
+}
@@ -0,0 +1,163 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Mailer sends templated emails. templateFile names a file under templates/
+// that defines "subject", "plainBody" and "htmlBody" templates.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// Message is a fully rendered email.
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+	SentAt    time.Time
+}
+
+func render(sender, recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{From: sender, To: recipient, SentAt: time.Now()}
+
+	parts := []struct {
+		name string
+		dst  *string
+	}{
+		{"subject", &msg.Subject},
+		{"plainBody", &msg.PlainBody},
+		{"htmlBody", &msg.HTMLBody},
+	}
+	for _, part := range parts {
+		buf := new(bytes.Buffer)
+		err = tmpl.ExecuteTemplate(buf, part.name, data)
+		if err != nil {
+			return nil, err
+		}
+		*part.dst = strings.TrimSpace(buf.String())
+	}
+
+	return msg, nil
+}
+
+// Bytes encodes the message as a multipart/alternative RFC 5322 email.
+func (m *Message) Bytes() []byte {
+	const boundary = "workout-tracker-boundary"
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(buf, "Date: %s\r\n", m.SentAt.Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(buf, "--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", boundary, m.PlainBody)
+	fmt.Fprintf(buf, "--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, m.HTMLBody)
+	fmt.Fprintf(buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+// SMTPMailer delivers mail through an SMTP relay.
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+func NewSMTPMailer(host string, port int, username, password, sender string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		auth:   auth,
+		sender: sender,
+	}
+}
+
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.sender, []string{recipient}, msg.Bytes())
+}
+
+// MemoryMailer keeps sent messages in memory; useful in tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	sender   string
+	messages []Message
+}
+
+func NewMemoryMailer(sender string) *MemoryMailer {
+	return &MemoryMailer{sender: sender}
+}
+
+func (m *MemoryMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// FileMailer writes each message as an .eml file into a directory, so
+// local development works without an SMTP server.
+type FileMailer struct {
+	dir    string
+	sender string
+}
+
+func NewFileMailer(dir, sender string) *FileMailer {
+	return &FileMailer{dir: dir, sender: sender}
+}
+
+func (m *FileMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", msg.SentAt.UnixNano(), strings.TrimSuffix(templateFile, filepath.Ext(templateFile)))
+	return os.WriteFile(filepath.Join(m.dir, name), msg.Bytes(), 0o644)
+}
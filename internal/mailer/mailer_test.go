@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer("sender@example.com")
+
+	err := m.Send("john@example.com", "user_welcome.tmpl", map[string]any{
+		"Username":        "johndoe",
+		"ActivationToken": "ABCDEFGH",
+	})
+	require.NoError(t, err)
+
+	messages := m.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "john@example.com", messages[0].To)
+	assert.Equal(t, "Welcome to Workout Tracker!", messages[0].Subject)
+	assert.Contains(t, messages[0].PlainBody, "ABCDEFGH")
+	assert.Contains(t, messages[0].HTMLBody, "ABCDEFGH")
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir, "sender@example.com")
+
+	err := m.Send("john@example.com", "password_reset.tmpl", map[string]any{
+		"Username":           "johndoe",
+		"PasswordResetToken": "RESET123",
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Subject: Reset your Workout Tracker password")
+	assert.Contains(t, string(content), "RESET123")
+}
+
+func TestUnknownTemplate(t *testing.T) {
+	m := NewMemoryMailer("sender@example.com")
+
+	err := m.Send("john@example.com", "missing.tmpl", nil)
+	assert.Error(t, err)
+	assert.Empty(t, m.Messages())
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,37 +11,47 @@ import (
 	"time"
 
 	"github.com/LikhithMar14/workout-tracker/internal/auth"
+	"github.com/LikhithMar14/workout-tracker/internal/store"
 	"github.com/LikhithMar14/workout-tracker/internal/utils"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // ContextKey is a type for context keys to avoid conflicts
 type ContextKey string
 
 const (
-	// UserIDKey is the context key for user ID
-	UserIDKey ContextKey = "userID"
-	// UserEmailKey is the context key for user email
-	UserEmailKey ContextKey = "userEmail"
+	// PrincipalKey is the context key for the authenticated caller
+	PrincipalKey ContextKey = "principal"
+	// RequestIDKey is the context key for the request ID
+	RequestIDKey ContextKey = "requestID"
 )
 
 // Middleware is a struct that holds dependencies for middleware functions
 type Middleware struct {
 	Logger        *log.Logger
 	Authenticator auth.Authenticator
+	SessionStore  store.SessionStore
+	APIKeyStore   store.APIKeyStore
 }
 
 // NewMiddleware creates a new middleware instance
-func NewMiddleware(logger *log.Logger, authenticator auth.Authenticator) *Middleware {
+func NewMiddleware(logger *log.Logger, authenticator auth.Authenticator, sessionStore store.SessionStore, apiKeyStore store.APIKeyStore) *Middleware {
 	return &Middleware{
 		Logger:        logger,
 		Authenticator: authenticator,
+		SessionStore:  sessionStore,
+		APIKeyStore:   apiKeyStore,
 	}
 }
 
-// RequireAuth is a middleware that validates JWT tokens
+// RequireAuth is a middleware that validates JWT tokens or API keys. API
+// keys are accepted in the X-API-Key header or as a bearer token.
 func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			m.authenticateAPIKey(w, r, next, apiKey)
+			return
+		}
+
 		// Get the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -61,50 +73,136 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		if strings.HasPrefix(tokenString, store.APIKeyPrefix) {
+			m.authenticateAPIKey(w, r, next, tokenString)
+			return
+		}
+
 		// Validate the token
-		token, err := m.Authenticator.ValidateToken(tokenString)
+		claims, err := m.Authenticator.ValidateToken(tokenString)
 		if err != nil {
 			m.Logger.Printf("ERROR: token validation failed: %v", err)
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired token"})
 			return
 		}
 
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
+		principal, err := claims.Principal()
+		if err != nil {
+			m.Logger.Printf("ERROR: invalid token claims: %v", err)
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token claims"})
 			return
 		}
 
-		// Extract user information from claims
-		userID, ok := claims["user_id"].(float64) // JWT numeric claims are float64
-		if !ok {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid user ID in token"})
+		// Reject tokens whose session was revoked (logout, password change, account deletion)
+		active, err := m.SessionStore.IsSessionActive(principal.SessionID, principal.UserID)
+		if err != nil {
+			m.Logger.Printf("ERROR: checking session: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 			return
 		}
-
-		email, ok := claims["email"].(string)
-		if !ok {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid email in token"})
+		if !active {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired token"})
 			return
 		}
 
-		// Add user information to context
-		ctx := context.WithValue(r.Context(), UserIDKey, int(userID))
-		ctx = context.WithValue(ctx, UserEmailKey, email)
+		ctx := WithPrincipal(r.Context(), principal)
 
 		// Call the next handler with the updated context
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (m *Middleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	key, user, err := m.APIKeyStore.GetAPIKeyForAuth(plaintext)
+	if err != nil {
+		m.Logger.Printf("ERROR: checking API key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if key == nil || !user.Activated || user.DisabledAt != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired API key"})
+		return
+	}
+
+	principal := &auth.Principal{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     user.Role,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}
+
+	next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+}
+
+// RequireScope is a middleware that rejects callers whose credentials are
+// not allowed to act within scope. It must run after RequireAuth.
+func (m *Middleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := GetPrincipalFromContext(r.Context())
+			if err != nil {
+				utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": fmt.Sprintf("this API key lacks the %s scope", scope)})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession is a middleware for account and admin routes that API
+// keys must never reach. It must run after RequireAuth.
+func (m *Middleware) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := GetPrincipalFromContext(r.Context())
+		if err != nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+			return
+		}
+
+		if principal.APIKeyID != 0 {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "this endpoint requires a logged-in session"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission is a middleware that only lets through users whose role
+// grants the permission. It must run after RequireAuth.
+func (m *Middleware) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := GetPrincipalFromContext(r.Context())
+			if err != nil {
+				utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+				return
+			}
+
+			if !principal.HasPermission(permission) {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to access this resource"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // CORS middleware to handle cross-origin requests
 func (m *Middleware) CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*") // In production, specify allowed origins
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID")
 		w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
 
 		// Handle preflight requests
@@ -117,6 +215,26 @@ func (m *Middleware) CORS(next http.Handler) http.Handler {
 	})
 }
 
+// RequestID middleware tags each request with an ID, reusing a sane
+// X-Request-ID sent by a proxy and generating one otherwise
+func (m *Middleware) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 64 || strings.ContainsAny(requestID, " \t\r\n") {
+			b := make([]byte, 16)
+			_, err := rand.Read(b)
+			if err != nil {
+				m.Logger.Printf("ERROR: generating request ID: %v", err)
+			}
+			requestID = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := context.WithValue(r.Context(), RequestIDKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // RequestLogger middleware to log requests
 func (m *Middleware) RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -130,12 +248,14 @@ func (m *Middleware) RequestLogger(next http.Handler) http.Handler {
 
 		// Log the request
 		duration := time.Since(start)
-		m.Logger.Printf("%s %s %d %v %s",
+		requestID, _ := GetRequestIDFromContext(r.Context())
+		m.Logger.Printf("%s %s %d %v %s %s",
 			r.Method,
 			r.URL.Path,
 			wrapped.statusCode,
 			duration,
 			r.RemoteAddr,
+			requestID,
 		)
 	})
 }
@@ -172,22 +292,27 @@ func (m *Middleware) RecoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// GetUserIDFromContext extracts user ID from request context
-func GetUserIDFromContext(ctx context.Context) (int, error) {
-	userID, ok := ctx.Value(UserIDKey).(int)
-	if !ok {
-		return 0, fmt.Errorf("user ID not found in context")
+// WithPrincipal returns a copy of ctx carrying the authenticated caller
+func WithPrincipal(ctx context.Context, principal *auth.Principal) context.Context {
+	return context.WithValue(ctx, PrincipalKey, principal)
+}
+
+// GetPrincipalFromContext extracts the authenticated caller from request context
+func GetPrincipalFromContext(ctx context.Context) (*auth.Principal, error) {
+	principal, ok := ctx.Value(PrincipalKey).(*auth.Principal)
+	if !ok || principal == nil {
+		return nil, fmt.Errorf("principal not found in context")
 	}
-	return userID, nil
+	return principal, nil
 }
 
-// GetUserEmailFromContext extracts user email from request context
-func GetUserEmailFromContext(ctx context.Context) (string, error) {
-	email, ok := ctx.Value(UserEmailKey).(string)
+// GetRequestIDFromContext extracts the request ID from request context
+func GetRequestIDFromContext(ctx context.Context) (string, error) {
+	requestID, ok := ctx.Value(RequestIDKey).(string)
 	if !ok {
-		return "", fmt.Errorf("user email not found in context")
+		return "", fmt.Errorf("request ID not found in context")
 	}
-	return email, nil
+	return requestID, nil
 }
 
 // RateLimiter is a simple in-memory rate limiter
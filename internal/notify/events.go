@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+)
+
+// StreakMilestones are the streak lengths, in days, worth a notification.
+var StreakMilestones = []int{7, 14, 30, 50, 100, 200, 365}
+
+const day = 24 * time.Hour
+
+// WorkoutLogged notifies the owner of a newly logged workout about personal
+// records it set and streak milestones it reached. Workouts a coach assigned
+// are plans rather than performances, so they are skipped.
+func (n *Notifier) WorkoutLogged(ctx context.Context, workout *store.Workout) {
+	if workout.AssignedBy != nil {
+		return
+	}
+
+	bests, err := n.WorkoutStore.GetPersonalBests(workout.UserID, workout.ID)
+	if err != nil {
+		n.Logger.Printf("ERROR: getting personal bests: %v", err)
+	} else {
+		for _, record := range PersonalRecords(workout, bests) {
+			n.Notify(ctx, workout.UserID, record)
+		}
+	}
+
+	now := time.Now().UTC()
+	days, err := n.WorkoutStore.ListTrainingDays(workout.UserID, now.Add(-time.Duration(StreakMilestones[len(StreakMilestones)-1]+1)*day))
+	if err != nil {
+		n.Logger.Printf("ERROR: listing training days: %v", err)
+		return
+	}
+
+	streak := StreakLength(days, now)
+	if !isMilestone(streak) {
+		return
+	}
+
+	// A second workout on the milestone day doesn't celebrate it again
+	today := now.Truncate(day)
+	notified, err := n.NotificationStore.HasNotificationSince(workout.UserID, TypeStreakMilestone, today)
+	if err != nil {
+		n.Logger.Printf("ERROR: checking streak notifications: %v", err)
+		return
+	}
+	if !notified {
+		n.Notify(ctx, workout.UserID, StreakMilestone{Days: streak})
+	}
+}
+
+// PersonalRecords returns the exercises of the workout lifted heavier than
+// the previous bests, keyed by lower-cased exercise name. Exercises without
+// a previous best are a first attempt rather than a record.
+func PersonalRecords(workout *store.Workout, bests map[string]float64) []PersonalRecord {
+	var records []PersonalRecord
+	seen := map[string]int{}
+
+	for _, entry := range workout.Entries {
+		if entry.Weight == nil {
+			continue
+		}
+		key := strings.ToLower(entry.ExerciseName)
+		previous, ok := bests[key]
+		if !ok || *entry.Weight <= previous {
+			continue
+		}
+
+		if i, ok := seen[key]; ok {
+			if *entry.Weight > records[i].Weight {
+				records[i].Weight = *entry.Weight
+			}
+			continue
+		}
+		seen[key] = len(records)
+		records = append(records, PersonalRecord{
+			WorkoutID:    workout.ID,
+			ExerciseName: entry.ExerciseName,
+			Weight:       *entry.Weight,
+			PreviousBest: previous,
+			WeightUnit:   units.Kilograms,
+		})
+	}
+
+	return records
+}
+
+// StreakLength counts the consecutive training days ending on today's UTC
+// date. days must be distinct and sorted most recent first.
+func StreakLength(days []time.Time, today time.Time) int {
+	expected := today.UTC().Truncate(day)
+	streak := 0
+
+	for _, d := range days {
+		d = d.UTC().Truncate(day)
+		if d.After(expected) {
+			continue
+		}
+		if !d.Equal(expected) {
+			break
+		}
+		streak++
+		expected = expected.Add(-day)
+	}
+
+	return streak
+}
+
+func isMilestone(streak int) bool {
+	for _, milestone := range StreakMilestones {
+		if streak == milestone {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTrainingGaps notifies users who haven't logged a workout for longer
+// than gap. Each user hears about a gap once, until they train again.
+func (n *Notifier) CheckTrainingGaps(ctx context.Context, gap time.Duration) error {
+	now := time.Now()
+	users, err := n.NotificationStore.ListInactiveUsers(now.Add(-gap), TypeTrainingGap)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		n.Notify(ctx, user.UserID, TrainingGap{
+			DaysSinceLastWorkout: int(now.Sub(user.LastWorkoutAt) / day),
+			LastWorkoutAt:        user.LastWorkoutAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return nil
+}
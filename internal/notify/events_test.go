@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreakLength(t *testing.T) {
+	today := time.Date(2024, 3, 10, 18, 30, 0, 0, time.UTC)
+	date := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		days []time.Time
+		want int
+	}{
+		{name: "no workouts", days: nil, want: 0},
+		{name: "only today", days: []time.Time{date(10)}, want: 1},
+		{name: "consecutive days", days: []time.Time{date(10), date(9), date(8)}, want: 3},
+		{name: "gap ends the streak", days: []time.Time{date(10), date(9), date(7), date(6)}, want: 2},
+		{name: "nothing today", days: []time.Time{date(9), date(8)}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StreakLength(tt.days, today))
+		})
+	}
+}
+
+func TestPersonalRecords(t *testing.T) {
+	weight := func(w float64) *float64 { return &w }
+	workout := &store.Workout{
+		ID: 7,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", Weight: weight(80)},
+			{ExerciseName: "bench press", Weight: weight(85)},
+			{ExerciseName: "Squat", Weight: weight(100)},
+			{ExerciseName: "Deadlift", Weight: weight(140)},
+			{ExerciseName: "Push Ups"},
+		},
+	}
+	bests := map[string]float64{
+		"bench press": 75,
+		"squat":       100,
+	}
+
+	records := PersonalRecords(workout, bests)
+
+	assert.Equal(t, []PersonalRecord{
+		{WorkoutID: 7, ExerciseName: "Bench Press", Weight: 85, PreviousBest: 75, WeightUnit: "kg"},
+	}, records)
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/LikhithMar14/workout-tracker/internal/utils"
+)
+
+// Notification types. Each has a matching payload struct.
+const (
+	TypePersonalRecord  = "personal_record"
+	TypeStreakMilestone = "streak_milestone"
+	TypeTrainingGap     = "training_gap"
+	TypeSecurity        = "security"
+)
+
+// Types lists every notification type, in the order preferences are shown.
+var Types = []string{TypePersonalRecord, TypeStreakMilestone, TypeTrainingGap, TypeSecurity}
+
+func ValidType(notificationType string) bool {
+	for _, t := range Types {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// Mandatory reports whether a type can't be turned off. Users always hear
+// about security events on their account.
+func Mandatory(notificationType string) bool {
+	return notificationType == TypeSecurity
+}
+
+// Payload is the type-specific content of a notification.
+type Payload interface {
+	Type() string
+}
+
+// PersonalRecord weights are in kilograms, as stored.
+type PersonalRecord struct {
+	WorkoutID    int     `json:"workout_id"`
+	ExerciseName string  `json:"exercise_name"`
+	Weight       float64 `json:"weight"`
+	PreviousBest float64 `json:"previous_best"`
+	WeightUnit   string  `json:"weight_unit"`
+}
+
+func (PersonalRecord) Type() string { return TypePersonalRecord }
+
+type StreakMilestone struct {
+	Days int `json:"days"`
+}
+
+func (StreakMilestone) Type() string { return TypeStreakMilestone }
+
+type TrainingGap struct {
+	DaysSinceLastWorkout int    `json:"days_since_last_workout"`
+	LastWorkoutAt        string `json:"last_workout_at"`
+}
+
+func (TrainingGap) Type() string { return TypeTrainingGap }
+
+type SecurityEvent struct {
+	Event     string `json:"event"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+func (SecurityEvent) Type() string { return TypeSecurity }
+
+// Dispatcher delivers a stored notification over another channel, such as
+// push or email.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, notification *store.Notification) error
+}
+
+// Notifier records notifications in the in-app notification center, if the
+// user wants that type, and hands them to any extra dispatchers.
+type Notifier struct {
+	NotificationStore store.NotificationStore
+	WorkoutStore      store.WorkoutStore
+	Dispatchers       []Dispatcher
+	Logger            *log.Logger
+}
+
+func NewNotifier(notificationStore store.NotificationStore, workoutStore store.WorkoutStore, logger *log.Logger, dispatchers ...Dispatcher) *Notifier {
+	return &Notifier{
+		NotificationStore: notificationStore,
+		WorkoutStore:      workoutStore,
+		Dispatchers:       dispatchers,
+		Logger:            logger,
+	}
+}
+
+// Preferences returns whether each type is enabled for the user. Types are
+// on unless the user turned them off.
+func (n *Notifier) Preferences(userID int) (map[string]bool, error) {
+	stored, err := n.NotificationStore.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences := make(map[string]bool, len(Types))
+	for _, notificationType := range Types {
+		enabled, ok := stored[notificationType]
+		preferences[notificationType] = !ok || enabled || Mandatory(notificationType)
+	}
+	return preferences, nil
+}
+
+// Notify sends the payload to the user. Like auditing, it never fails the
+// caller: errors are only logged.
+func (n *Notifier) Notify(ctx context.Context, userID int, payload Payload) {
+	preferences, err := n.Preferences(userID)
+	if err != nil {
+		n.Logger.Printf("ERROR: reading notification preferences: %v", err)
+		return
+	}
+	if !preferences[payload.Type()] {
+		return
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		n.Logger.Printf("ERROR: encoding %s notification: %v", payload.Type(), err)
+		return
+	}
+
+	notification := &store.Notification{
+		UserID:  userID,
+		Type:    payload.Type(),
+		Payload: data,
+	}
+	err = n.NotificationStore.CreateNotification(notification)
+	if err != nil {
+		n.Logger.Printf("ERROR: creating %s notification: %v", payload.Type(), err)
+		return
+	}
+
+	for _, dispatcher := range n.Dispatchers {
+		err = dispatcher.Dispatch(ctx, notification)
+		if err != nil {
+			n.Logger.Printf("ERROR: dispatching notification %d: %v", notification.ID, err)
+		}
+	}
+}
+
+// SecurityEvent tells the user about a change to their account, along with
+// where the request came from.
+func (n *Notifier) SecurityEvent(r *http.Request, userID int, event string) {
+	n.Notify(r.Context(), userID, SecurityEvent{
+		Event:     event,
+		IP:        utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+}
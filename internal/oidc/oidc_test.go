@@ -0,0 +1,186 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider is a minimal OpenID provider that issues one authorization
+// code per login and checks the PKCE verifier on redemption.
+type stubProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	audience string
+	codes    map[string]url.Values
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	sp := &stubProvider{t: t, key: key, audience: "client-id", codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 sp.server.URL,
+			"authorization_endpoint": sp.server.URL + "/authorize",
+			"token_endpoint":         sp.server.URL + "/token",
+			"jwks_uri":               sp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "client-id" || secret != "client-secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		r.ParseForm()
+		login, ok := sp.codes[r.PostForm.Get("code")]
+		if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != login.Get("code_challenge") {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		delete(sp.codes, r.PostForm.Get("code"))
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     sp.idToken(login.Get("nonce")),
+		})
+	})
+	sp.server = httptest.NewServer(mux)
+	t.Cleanup(sp.server.Close)
+
+	return sp
+}
+
+// authorize simulates the user approving the login in the browser.
+func (sp *stubProvider) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(sp.t, err)
+
+	params := u.Query()
+	code = "code-" + params.Get("state")
+	sp.codes[code] = params
+	return code, params.Get("state")
+}
+
+func (sp *stubProvider) idToken(nonce string) string {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                sp.server.URL,
+		"sub":                "00u123",
+		"aud":                sp.audience,
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              nonce,
+		"email":              "john@example.com",
+		"email_verified":     true,
+		"preferred_username": "john",
+	})
+	token.Header["kid"] = "stub-key"
+
+	signed, err := token.SignedString(sp.key)
+	require.NoError(sp.t, err)
+	return signed
+}
+
+func (sp *stubProvider) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:         "stub",
+		IssuerURL:    sp.server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8080/auth/stub/callback",
+	}, sp.server.Client())
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	sp := newStubProvider(t)
+	provider := sp.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/authorize", u.Path)
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+
+	code, state := sp.authorize(authURL)
+	assert.Equal(t, "state-1", state)
+
+	identity, err := provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "00u123", identity.Subject)
+	assert.Equal(t, "john@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, "john", identity.PreferredUsername)
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	sp := newStubProvider(t)
+	provider := sp.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	require.NoError(t, err)
+	code, _ := sp.authorize(authURL)
+
+	_, err = provider.Exchange(ctx, code, "someone-elses-verifier", "nonce-1")
+	assert.Error(t, err)
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	sp := newStubProvider(t)
+	provider := sp.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	require.NoError(t, err)
+	code, _ := sp.authorize(authURL)
+
+	_, err = provider.Exchange(ctx, code, "verifier-1", "nonce-2")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestExchangeRejectsWrongAudience(t *testing.T) {
+	sp := newStubProvider(t)
+	sp.audience = "another-client"
+	provider := sp.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	require.NoError(t, err)
+	code, _ := sp.authorize(authURL)
+
+	_, err = provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
@@ -13,17 +13,15 @@ import (
 func SetupRoutes(app *app.Application) http.Handler {
 	r := chi.NewRouter()
 
-	// Create JWT authenticator (in production, get these from environment variables)
-	authenticator := auth.NewJWTAuthenticator("mysecret", "workout-tracker-users", "workout-tracker-app")
-
 	// Create middleware instance
-	mw := middleware.NewMiddleware(app.Logger, authenticator)
+	mw := middleware.NewMiddleware(app.Logger, app.Authenticator, app.SessionStore, app.APIKeyStore)
 
 	// Create rate limiter (100 requests per minute)
 	rateLimiter := middleware.NewRateLimiter(100, time.Minute)
 
 	// Global middleware (applied to all routes)
 	r.Use(mw.RecoverPanic)
+	r.Use(mw.RequestID)
 	r.Use(mw.CORS)
 	r.Use(mw.RequestLogger)
 	r.Use(mw.ContentType)
@@ -32,17 +30,134 @@ func SetupRoutes(app *app.Application) http.Handler {
 	// Public routes (no authentication required)
 	r.Post("/register", app.UserHandler.HandleRegisterUser)
 	r.Post("/login", app.UserHandler.HandleLoginUser)
+	r.Post("/login/mfa", app.UserHandler.HandleLoginMFA)
+	r.Post("/users/activate", app.UserHandler.HandleActivateUser)
+	r.Post("/users/email/confirm", app.UserHandler.HandleConfirmEmailChange)
+	r.Post("/password-reset", app.UserHandler.HandleRequestPasswordReset)
+	r.Put("/password-reset", app.UserHandler.HandleResetPassword)
 	r.Get("/health", app.HealthCheck)
+	r.Get("/.well-known/jwks.json", app.KeysHandler.HandleJWKS)
+	r.Get("/auth/{provider}/login", app.OIDCHandler.HandleLogin)
+	r.Get("/auth/{provider}/callback", app.OIDCHandler.HandleCallback)
+	r.Get("/public/workouts/{slug}", app.WorkoutHandler.HandleGetPublicWorkout)
 
 	// Protected routes (authentication required)
 	r.Group(func(r chi.Router) {
 		r.Use(mw.RequireAuth)
 
+		// Routes reachable with an API key, limited by its scopes
+		r.With(mw.RequireScope(auth.ScopeProfileRead)).Get("/me", app.UserHandler.HandleGetMe)
+
 		// Workout routes
-		r.Get("/workouts/{id}", app.WorkoutHandler.HandleGetWorkoutByID)
-		r.Post("/workouts", app.WorkoutHandler.HandleCreateWorkout)
-		r.Put("/workouts/{id}", app.WorkoutHandler.HandleUpdateWorkoutByID)
-		r.Delete("/workouts/{id}", app.WorkoutHandler.HandleDeleteWorkoutByID)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/workouts/{id}", app.WorkoutHandler.HandleGetWorkoutByID)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Post("/workouts", app.WorkoutHandler.HandleCreateWorkout)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Post("/workouts/import-file", app.WorkoutHandler.HandleImportFile)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Put("/workouts/{id}", app.WorkoutHandler.HandleUpdateWorkoutByID)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Delete("/workouts/{id}", app.WorkoutHandler.HandleDeleteWorkoutByID)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/workouts/{id}/samples", app.WorkoutHandler.HandleListSamples)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Put("/workouts/{id}/samples", app.WorkoutHandler.HandleUploadSamples)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/workouts/{id}/grants", app.WorkoutHandler.HandleListGrants)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Post("/workouts/{id}/grants", app.WorkoutHandler.HandleCreateGrant)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Delete("/workouts/{id}/grants/{userID}", app.WorkoutHandler.HandleDeleteGrant)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/workouts/{id}/comments", app.WorkoutHandler.HandleListComments)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Post("/workouts/{id}/comments", app.WorkoutHandler.HandleCreateComment)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Patch("/workouts/{id}/comments/{commentID}", app.WorkoutHandler.HandleUpdateComment)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Delete("/workouts/{id}/comments/{commentID}", app.WorkoutHandler.HandleDeleteComment)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Post("/workouts/{id}/reactions", app.WorkoutHandler.HandleToggleReaction)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/exercises/{name}/next", app.WorkoutHandler.HandleGetNextSession)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/exercises/{name}/progression", app.WorkoutHandler.HandleGetProgression)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsWrite)).Put("/exercises/{name}/progression", app.WorkoutHandler.HandleUpdateProgression)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/feed", app.SocialHandler.HandleGetFeed)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/coaching/athletes/{id}/workouts", app.CoachHandler.HandleListAthleteWorkouts)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/stats/cardio", app.StatsHandler.HandleGetCardioStats)
+		r.With(mw.RequireScope(auth.ScopeWorkoutsRead)).Get("/stats/load", app.StatsHandler.HandleGetLoadStats)
+
+		// Measurement routes
+		r.With(mw.RequireScope(auth.ScopeMeasurementsRead)).Get("/measurements", app.MeasurementHandler.HandleListMeasurements)
+		r.With(mw.RequireScope(auth.ScopeMeasurementsRead)).Get("/measurements/trend", app.MeasurementHandler.HandleGetTrend)
+		r.With(mw.RequireScope(auth.ScopeMeasurementsWrite)).Post("/measurements", app.MeasurementHandler.HandleCreateMeasurement)
+		r.With(mw.RequireScope(auth.ScopeMeasurementsRead)).Get("/measurements/{id}", app.MeasurementHandler.HandleGetMeasurement)
+		r.With(mw.RequireScope(auth.ScopeMeasurementsWrite)).Patch("/measurements/{id}", app.MeasurementHandler.HandleUpdateMeasurement)
+		r.With(mw.RequireScope(auth.ScopeMeasurementsWrite)).Delete("/measurements/{id}", app.MeasurementHandler.HandleDeleteMeasurement)
+
+		// Routes that need an interactive login session
+		r.Group(func(r chi.Router) {
+			r.Use(mw.RequireSession)
+
+			// Account routes
+			r.Patch("/me", app.UserHandler.HandleUpdateMe)
+			r.Post("/me/password", app.UserHandler.HandleChangePassword)
+			r.Delete("/me", app.UserHandler.HandleDeleteMe)
+			r.Post("/tokens/refresh", app.UserHandler.HandleRefreshToken)
+
+			// Two-factor authentication routes
+			r.Get("/me/2fa", app.UserHandler.HandleGetTwoFactor)
+			r.Post("/me/2fa/totp", app.UserHandler.HandleEnrollTOTP)
+			r.Post("/me/2fa/totp/confirm", app.UserHandler.HandleConfirmTOTP)
+			r.Delete("/me/2fa", app.UserHandler.HandleDisableTwoFactor)
+
+			// Follow routes
+			r.Get("/me/followers", app.SocialHandler.HandleListFollowers)
+			r.Get("/me/following", app.SocialHandler.HandleListFollowing)
+			r.Post("/users/{id}/follow", app.SocialHandler.HandleFollowUser)
+			r.Delete("/users/{id}/follow", app.SocialHandler.HandleUnfollowUser)
+			r.Get("/me/follow-requests", app.SocialHandler.HandleListFollowRequests)
+			r.Post("/me/follow-requests/{id}/approve", app.SocialHandler.HandleApproveFollowRequest)
+			r.Delete("/me/follow-requests/{id}", app.SocialHandler.HandleDeclineFollowRequest)
+
+			// Coaching routes
+			r.Get("/coaching/links", app.CoachHandler.HandleListLinks)
+			r.Post("/coaching/links", app.CoachHandler.HandleCreateInvitation)
+			r.Post("/coaching/links/{id}/accept", app.CoachHandler.HandleAcceptLink)
+			r.Put("/coaching/links/{id}/permissions", app.CoachHandler.HandleUpdatePermissions)
+			r.Delete("/coaching/links/{id}", app.CoachHandler.HandleDeleteLink)
+
+			// Notification routes
+			r.Get("/notifications", app.NotificationHandler.HandleListNotifications)
+			r.Post("/notifications/read", app.NotificationHandler.HandleMarkAllRead)
+			r.Post("/notifications/{id}/read", app.NotificationHandler.HandleMarkRead)
+			r.Get("/me/notification-preferences", app.NotificationHandler.HandleGetPreferences)
+			r.Put("/me/notification-preferences", app.NotificationHandler.HandleUpdatePreferences)
+
+			// Webhook routes
+			r.Get("/me/webhooks", app.WebhookHandler.HandleListWebhooks)
+			r.Post("/me/webhooks", app.WebhookHandler.HandleCreateWebhook)
+			r.Patch("/me/webhooks/{id}", app.WebhookHandler.HandleUpdateWebhook)
+			r.Delete("/me/webhooks/{id}", app.WebhookHandler.HandleDeleteWebhook)
+			r.Get("/me/webhooks/{id}/deliveries", app.WebhookHandler.HandleListDeliveries)
+			r.Get("/me/webhooks/{id}/deliveries/{deliveryID}", app.WebhookHandler.HandleGetDelivery)
+			r.Post("/me/webhooks/{id}/deliveries/{deliveryID}/redeliver", app.WebhookHandler.HandleRedeliver)
+
+			// API key routes
+			r.Get("/me/api-keys", app.APIKeyHandler.HandleListAPIKeys)
+			r.Post("/me/api-keys", app.APIKeyHandler.HandleCreateAPIKey)
+			r.Delete("/me/api-keys/{id}", app.APIKeyHandler.HandleDeleteAPIKey)
+
+			// Admin routes (each guarded by the permission it needs)
+			r.Route("/admin", func(r chi.Router) {
+				r.With(mw.RequirePermission(auth.PermissionUsersRead)).Get("/users", app.AdminHandler.HandleListUsers)
+				r.With(mw.RequirePermission(auth.PermissionUsersRead)).Get("/users/{id}", app.AdminHandler.HandleGetUser)
+				r.With(mw.RequirePermission(auth.PermissionUsersManage)).Post("/users/{id}/disable", app.AdminHandler.HandleDisableUser)
+				r.With(mw.RequirePermission(auth.PermissionUsersManage)).Post("/users/{id}/enable", app.AdminHandler.HandleEnableUser)
+				r.With(mw.RequirePermission(auth.PermissionWorkoutsReadAny)).Get("/workouts/{id}", app.AdminHandler.HandleGetWorkout)
+				r.With(mw.RequirePermission(auth.PermissionStatsRead)).Get("/stats", app.AdminHandler.HandleGetStats)
+				r.With(mw.RequirePermission(auth.PermissionAuditRead)).Get("/audit", app.AdminHandler.HandleListAuditEvents)
+
+				r.Route("/webhooks", func(r chi.Router) {
+					r.Use(mw.RequirePermission(auth.PermissionWebhooksManage))
+					r.Get("/", app.AdminWebhookHandler.HandleListWebhooks)
+					r.Post("/", app.AdminWebhookHandler.HandleCreateWebhook)
+					r.Patch("/{id}", app.AdminWebhookHandler.HandleUpdateWebhook)
+					r.Delete("/{id}", app.AdminWebhookHandler.HandleDeleteWebhook)
+					r.Get("/{id}/deliveries", app.AdminWebhookHandler.HandleListDeliveries)
+					r.Get("/{id}/deliveries/{deliveryID}", app.AdminWebhookHandler.HandleGetDelivery)
+					r.Post("/{id}/deliveries/{deliveryID}/redeliver", app.AdminWebhookHandler.HandleRedeliver)
+				})
+
+				r.With(mw.RequirePermission(auth.PermissionJobsManage)).Get("/jobs", app.JobHandler.HandleListJobs)
+				r.With(mw.RequirePermission(auth.PermissionJobsManage)).Post("/jobs/{id}/retry", app.JobHandler.HandleRetryJob)
+			})
+		})
 	})
 
 	return r
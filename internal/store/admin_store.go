@@ -0,0 +1,60 @@
+package store
+
+import (
+	"database/sql"
+)
+
+// SystemStats is a snapshot of overall usage for the admin dashboard.
+type SystemStats struct {
+	TotalUsers         int `json:"total_users"`
+	ActivatedUsers     int `json:"activated_users"`
+	DisabledUsers      int `json:"disabled_users"`
+	TotalWorkouts      int `json:"total_workouts"`
+	TotalEntries       int `json:"total_entries"`
+	WorkoutsLast7Days  int `json:"workouts_last_7_days"`
+	ActiveUsersLast30d int `json:"active_users_last_30_days"`
+}
+
+type PostgresAdminStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAdminStore(db *sql.DB) *PostgresAdminStore {
+	return &PostgresAdminStore{
+		db: db,
+	}
+}
+
+type AdminStore interface {
+	GetSystemStats() (*SystemStats, error)
+}
+
+func (pg *PostgresAdminStore) GetSystemStats() (*SystemStats, error) {
+	stats := &SystemStats{}
+
+	query := `
+		SELECT
+			(SELECT count(*) FROM users),
+			(SELECT count(*) FROM users WHERE activated),
+			(SELECT count(*) FROM users WHERE disabled_at IS NOT NULL),
+			(SELECT count(*) FROM workouts),
+			(SELECT count(*) FROM workout_entries),
+			(SELECT count(*) FROM workouts WHERE created_at > CURRENT_TIMESTAMP - INTERVAL '7 days'),
+			(SELECT count(DISTINCT user_id) FROM workouts WHERE created_at > CURRENT_TIMESTAMP - INTERVAL '30 days')
+	`
+
+	err := pg.db.QueryRow(query).Scan(
+		&stats.TotalUsers,
+		&stats.ActivatedUsers,
+		&stats.DisabledUsers,
+		&stats.TotalWorkouts,
+		&stats.TotalEntries,
+		&stats.WorkoutsLast7Days,
+		&stats.ActiveUsersLast30d,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
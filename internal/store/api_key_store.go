@@ -0,0 +1,207 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs.
+const APIKeyPrefix = "wt_"
+
+var keyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// APIKey is a long-lived, scope-limited credential a user creates for
+// scripts and integrations. The key is "wt_<prefix>_<secret>": the prefix
+// finds the row and only the SHA-256 hash of the whole key is stored.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Plaintext  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIKey generates the secret for a key. The plaintext is only
+// available on the returned value; it can't be recovered later.
+func NewAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	randomBytes := make([]byte, 25)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := strings.ToLower(keyEncoding.EncodeToString(randomBytes))
+	prefix, secret := encoded[:8], encoded[8:]
+	plaintext := APIKeyPrefix + prefix + "_" + secret
+	hash := sha256.Sum256([]byte(plaintext))
+
+	return &APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Plaintext: plaintext,
+		Hash:      hash[:],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// parseAPIKeyPrefix returns the lookup prefix of a plaintext key.
+func parseAPIKeyPrefix(plaintext string) (string, bool) {
+	rest, ok := strings.CutPrefix(plaintext, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	return prefix, ok && prefix != ""
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{
+		db: db,
+	}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(*APIKey) error
+	ListAPIKeys(userID int) ([]*APIKey, error)
+	DeleteAPIKey(id int64, userID int) error
+	GetAPIKeyForAuth(plaintext string) (*APIKey, *User, error)
+}
+
+func (pg *PostgresAPIKeyStore) CreateAPIKey(key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	return pg.db.QueryRow(query, key.UserID, key.Name, key.Prefix, key.Hash, key.Scopes, key.ExpiresAt).Scan(
+		&key.ID, &key.CreatedAt,
+	)
+}
+
+func (pg *PostgresAPIKeyStore) ListAPIKeys(userID int) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key := &APIKey{}
+		var scopes pgtype.TextArray
+		err = rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		err = scopes.AssignTo(&key.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (pg *PostgresAPIKeyStore) DeleteAPIKey(id int64, userID int) error {
+	result, err := pg.db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAPIKeyForAuth returns a valid, unexpired key matching plaintext along
+// with its owner, or nils when there is none. It also records the use.
+func (pg *PostgresAPIKeyStore) GetAPIKeyForAuth(plaintext string) (*APIKey, *User, error) {
+	prefix, ok := parseAPIKeyPrefix(plaintext)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	query := `
+		SELECT k.id, k.user_id, k.name, k.prefix, k.hash, k.scopes, k.expires_at, k.last_used_at, k.created_at,
+			u.username, u.email, u.role, u.activated, u.disabled_at
+		FROM api_keys k
+		INNER JOIN users u ON u.id = k.user_id
+		WHERE k.prefix = $1
+	`
+
+	key := &APIKey{}
+	user := &User{}
+	var scopes pgtype.TextArray
+	err := pg.db.QueryRow(query, prefix).Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt,
+		&user.Username, &user.Email, &user.Role, &user.Activated, &user.DisabledAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, nil
+		default:
+			return nil, nil, err
+		}
+	}
+	user.ID = key.UserID
+
+	hash := sha256.Sum256([]byte(plaintext))
+	if subtle.ConstantTimeCompare(hash[:], key.Hash) != 1 {
+		return nil, nil, nil
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return nil, nil, nil
+	}
+
+	err = scopes.AssignTo(&key.Scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only touch last_used_at once a minute so busy scripts don't write on every request
+	_, err = pg.db.Exec(`
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`, key.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, user, nil
+}
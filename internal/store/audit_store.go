@@ -0,0 +1,141 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent is an immutable record of a security-sensitive or
+// data-changing action.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    *int            `json:"actor_id,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   *int64          `json:"target_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows down ListAuditEvents. Zero values match everything.
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   *int64
+	From       *time.Time
+	To         *time.Time
+	Page       int
+	PageSize   int
+}
+
+type PostgresAuditStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditStore(db *sql.DB) *PostgresAuditStore {
+	return &PostgresAuditStore{
+		db: db,
+	}
+}
+
+type AuditStore interface {
+	RecordAuditEvent(*AuditEvent) error
+	ListAuditEvents(filter AuditFilter) ([]*AuditEvent, int, error)
+}
+
+// nullJSON turns an empty raw message into a SQL NULL.
+func nullJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+func (pg *PostgresAuditStore) RecordAuditEvent(event *AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, request_id, changes, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`
+
+	return pg.db.QueryRow(query,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		nullJSON(event.Changes),
+		nullJSON(event.Metadata),
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (pg *PostgresAuditStore) ListAuditEvents(filter AuditFilter) ([]*AuditEvent, int, error) {
+	query := `
+		SELECT count(*) OVER(), id, actor_id, action, target_type, target_id,
+			COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(request_id, ''), changes, metadata, created_at
+		FROM audit_events
+		WHERE ($1::BIGINT IS NULL OR actor_id = $1)
+		AND ($2 = '' OR action = $2 OR action LIKE $2 || '.%')
+		AND ($3 = '' OR target_type = $3)
+		AND ($4::BIGINT IS NULL OR target_id = $4)
+		AND ($5::TIMESTAMPTZ IS NULL OR created_at >= $5)
+		AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $7 OFFSET $8
+	`
+
+	rows, err := pg.db.Query(query,
+		filter.ActorID,
+		filter.Action,
+		filter.TargetType,
+		filter.TargetID,
+		filter.From,
+		filter.To,
+		filter.PageSize,
+		(filter.Page-1)*filter.PageSize,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	events := []*AuditEvent{}
+	for rows.Next() {
+		event := &AuditEvent{}
+		var changes, metadata []byte
+		err = rows.Scan(
+			&total,
+			&event.ID,
+			&event.ActorID,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&event.IP,
+			&event.UserAgent,
+			&event.RequestID,
+			&changes,
+			&metadata,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		event.Changes = changes
+		event.Metadata = metadata
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
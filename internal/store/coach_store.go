@@ -0,0 +1,214 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+const (
+	CoachLinkPending = "pending"
+	CoachLinkActive  = "active"
+)
+
+var ErrDuplicateCoachLink = errors.New("these users are already linked or have a pending invitation")
+
+// CoachPermissions are what an athlete lets their coach do.
+type CoachPermissions struct {
+	ViewHistory    bool `json:"view_history"`
+	AssignWorkouts bool `json:"assign_workouts"`
+	Comment        bool `json:"comment"`
+}
+
+// CoachLink connects a coach to an athlete. Either side can invite the
+// other; the link only grants anything once the invitee accepts.
+type CoachLink struct {
+	ID              int64            `json:"id"`
+	CoachID         int              `json:"coach_id"`
+	CoachUsername   string           `json:"coach_username"`
+	AthleteID       int              `json:"athlete_id"`
+	AthleteUsername string           `json:"athlete_username"`
+	InvitedBy       int              `json:"invited_by"`
+	Status          string           `json:"status"`
+	Permissions     CoachPermissions `json:"permissions"`
+	CreatedAt       time.Time        `json:"created_at"`
+	AcceptedAt      *time.Time       `json:"accepted_at,omitempty"`
+}
+
+type PostgresCoachStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCoachStore(db *sql.DB) *PostgresCoachStore {
+	return &PostgresCoachStore{
+		db: db,
+	}
+}
+
+type CoachStore interface {
+	CreateCoachLink(link *CoachLink) error
+	GetCoachLink(id int64) (*CoachLink, error)
+	ListCoachLinks(userID int) ([]*CoachLink, error)
+	AcceptCoachLink(id int64, inviteeID int) error
+	UpdateCoachPermissions(id int64, athleteID int, permissions CoachPermissions) error
+	DeleteCoachLink(id int64, userID int) error
+	GetCoachPermissions(coachID, athleteID int) (*CoachPermissions, error)
+}
+
+const coachLinkColumns = `
+	l.id, l.coach_id, c.username, l.athlete_id, a.username, l.invited_by, l.status,
+	l.can_view_history, l.can_assign_workouts, l.can_comment, l.created_at, l.accepted_at
+`
+
+func scanCoachLink(row interface{ Scan(...any) error }) (*CoachLink, error) {
+	link := &CoachLink{}
+	err := row.Scan(
+		&link.ID, &link.CoachID, &link.CoachUsername, &link.AthleteID, &link.AthleteUsername, &link.InvitedBy, &link.Status,
+		&link.Permissions.ViewHistory, &link.Permissions.AssignWorkouts, &link.Permissions.Comment, &link.CreatedAt, &link.AcceptedAt,
+	)
+	return link, err
+}
+
+func (pg *PostgresCoachStore) CreateCoachLink(link *CoachLink) error {
+	query := `
+		INSERT INTO coach_links (coach_id, athlete_id, invited_by, can_view_history, can_assign_workouts, can_comment)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at
+	`
+
+	err := pg.db.QueryRow(query, link.CoachID, link.AthleteID, link.InvitedBy,
+		link.Permissions.ViewHistory, link.Permissions.AssignWorkouts, link.Permissions.Comment,
+	).Scan(&link.ID, &link.Status, &link.CreatedAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateCoachLink
+	}
+	return err
+}
+
+func (pg *PostgresCoachStore) GetCoachLink(id int64) (*CoachLink, error) {
+	query := `
+		SELECT ` + coachLinkColumns + `
+		FROM coach_links l
+		INNER JOIN users c ON c.id = l.coach_id
+		INNER JOIN users a ON a.id = l.athlete_id
+		WHERE l.id = $1
+	`
+
+	link, err := scanCoachLink(pg.db.QueryRow(query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return link, nil
+}
+
+// ListCoachLinks returns every link the user is part of, as coach or athlete.
+func (pg *PostgresCoachStore) ListCoachLinks(userID int) ([]*CoachLink, error) {
+	query := `
+		SELECT ` + coachLinkColumns + `
+		FROM coach_links l
+		INNER JOIN users c ON c.id = l.coach_id
+		INNER JOIN users a ON a.id = l.athlete_id
+		WHERE l.coach_id = $1 OR l.athlete_id = $1
+		ORDER BY l.created_at DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*CoachLink{}
+	for rows.Next() {
+		link, err := scanCoachLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// AcceptCoachLink activates a pending link. Only the side that was invited
+// can accept it.
+func (pg *PostgresCoachStore) AcceptCoachLink(id int64, inviteeID int) error {
+	query := `
+		UPDATE coach_links
+		SET status = 'active', accepted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending' AND invited_by <> $2 AND (coach_id = $2 OR athlete_id = $2)
+	`
+
+	return pg.execOne(query, id, inviteeID)
+}
+
+// UpdateCoachPermissions changes what the coach may do. Only the athlete
+// decides this.
+func (pg *PostgresCoachStore) UpdateCoachPermissions(id int64, athleteID int, permissions CoachPermissions) error {
+	query := `
+		UPDATE coach_links
+		SET can_view_history = $3, can_assign_workouts = $4, can_comment = $5
+		WHERE id = $1 AND athlete_id = $2
+	`
+
+	return pg.execOne(query, id, athleteID, permissions.ViewHistory, permissions.AssignWorkouts, permissions.Comment)
+}
+
+// DeleteCoachLink ends a link or declines an invitation; either side may do it.
+func (pg *PostgresCoachStore) DeleteCoachLink(id int64, userID int) error {
+	query := `
+		DELETE FROM coach_links
+		WHERE id = $1 AND (coach_id = $2 OR athlete_id = $2)
+	`
+
+	return pg.execOne(query, id, userID)
+}
+
+// GetCoachPermissions returns what coachID may do for athleteID, or nil when
+// there is no active link between them.
+func (pg *PostgresCoachStore) GetCoachPermissions(coachID, athleteID int) (*CoachPermissions, error) {
+	query := `
+		SELECT can_view_history, can_assign_workouts, can_comment
+		FROM coach_links
+		WHERE coach_id = $1 AND athlete_id = $2 AND status = 'active'
+	`
+
+	permissions := &CoachPermissions{}
+	err := pg.db.QueryRow(query, coachID, athleteID).Scan(&permissions.ViewHistory, &permissions.AssignWorkouts, &permissions.Comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return permissions, nil
+}
+
+func (pg *PostgresCoachStore) execOne(query string, args ...any) error {
+	result, err := pg.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var reactions = []string{"like", "fire", "strong", "clap"}
+
+func ValidReaction(reaction string) bool {
+	for _, r := range reactions {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+type WorkoutComment struct {
+	ID        int64     `json:"id"`
+	WorkoutID int64     `json:"workout_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PostgresCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommentStore(db *sql.DB) *PostgresCommentStore {
+	return &PostgresCommentStore{
+		db: db,
+	}
+}
+
+type CommentStore interface {
+	CreateComment(comment *WorkoutComment) error
+	GetComment(id int64) (*WorkoutComment, error)
+	ListComments(workoutID int64) ([]*WorkoutComment, error)
+	UpdateComment(comment *WorkoutComment) error
+	DeleteComment(id int64) error
+	ToggleReaction(workoutID int64, userID int, reaction string) (bool, error)
+}
+
+func (pg *PostgresCommentStore) CreateComment(comment *WorkoutComment) error {
+	query := `
+		WITH inserted AS (
+			INSERT INTO workout_comments (workout_id, user_id, body)
+			VALUES ($1, $2, $3)
+			RETURNING id, user_id, created_at, updated_at
+		)
+		SELECT i.id, u.username, i.created_at, i.updated_at
+		FROM inserted i
+		INNER JOIN users u ON u.id = i.user_id
+	`
+
+	return pg.db.QueryRow(query, comment.WorkoutID, comment.UserID, comment.Body).Scan(
+		&comment.ID, &comment.Username, &comment.CreatedAt, &comment.UpdatedAt,
+	)
+}
+
+func (pg *PostgresCommentStore) GetComment(id int64) (*WorkoutComment, error) {
+	query := `
+		SELECT c.id, c.workout_id, c.user_id, u.username, c.body, c.created_at, c.updated_at
+		FROM workout_comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1
+	`
+
+	comment := &WorkoutComment{}
+	err := pg.db.QueryRow(query, id).Scan(
+		&comment.ID, &comment.WorkoutID, &comment.UserID, &comment.Username, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return comment, nil
+}
+
+func (pg *PostgresCommentStore) ListComments(workoutID int64) ([]*WorkoutComment, error) {
+	query := `
+		SELECT c.id, c.workout_id, c.user_id, u.username, c.body, c.created_at, c.updated_at
+		FROM workout_comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.workout_id = $1
+		ORDER BY c.created_at, c.id
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*WorkoutComment{}
+	for rows.Next() {
+		comment := &WorkoutComment{}
+		err = rows.Scan(&comment.ID, &comment.WorkoutID, &comment.UserID, &comment.Username, &comment.Body, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+func (pg *PostgresCommentStore) UpdateComment(comment *WorkoutComment) error {
+	query := `
+		UPDATE workout_comments
+		SET body = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING updated_at
+	`
+
+	err := pg.db.QueryRow(query, comment.Body, comment.ID).Scan(&comment.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+func (pg *PostgresCommentStore) DeleteComment(id int64) error {
+	query := `
+		DELETE FROM workout_comments
+		WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ToggleReaction adds the user's reaction, or removes it if it was already
+// there. It reports whether the reaction is now present.
+func (pg *PostgresCommentStore) ToggleReaction(workoutID int64, userID int, reaction string) (bool, error) {
+	result, err := pg.db.Exec(`
+		DELETE FROM workout_reactions
+		WHERE workout_id = $1 AND user_id = $2 AND reaction = $3
+	`, workoutID, userID, reaction)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected > 0 {
+		return false, nil
+	}
+
+	_, err = pg.db.Exec(`
+		INSERT INTO workout_reactions (workout_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, workoutID, userID, reaction)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
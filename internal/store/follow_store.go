@@ -0,0 +1,187 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// FollowUser is the public view of a user on either side of a follow.
+// FollowedAt is when the follow was approved, or for a pending request when
+// it was made.
+type FollowUser struct {
+	ID         int       `json:"id"`
+	Username   string    `json:"username"`
+	Bio        string    `json:"bio"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type PostgresFollowStore struct {
+	db *sql.DB
+}
+
+func NewPostgresFollowStore(db *sql.DB) *PostgresFollowStore {
+	return &PostgresFollowStore{
+		db: db,
+	}
+}
+
+type FollowStore interface {
+	Follow(followerID, followeeID int) (bool, error)
+	Unfollow(followerID, followeeID int) error
+	ApproveFollowRequest(followeeID, followerID int) error
+	DeclineFollowRequest(followeeID, followerID int) error
+	IsFollowing(followerID, followeeID int) (bool, error)
+	ListFollowers(userID int) ([]*FollowUser, error)
+	ListFollowing(userID int) ([]*FollowUser, error)
+	ListFollowRequests(userID int) ([]*FollowUser, error)
+}
+
+// Follow asks to follow a user, and reports whether the follow is already
+// approved. Until the followee approves it, the request grants nothing.
+// Following someone twice is not an error.
+func (pg *PostgresFollowStore) Follow(followerID, followeeID int) (bool, error) {
+	query := `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT (follower_id, followee_id) DO UPDATE SET follower_id = EXCLUDED.follower_id
+		RETURNING approved_at IS NOT NULL
+	`
+
+	var approved bool
+	err := pg.db.QueryRow(query, followerID, followeeID).Scan(&approved)
+	return approved, err
+}
+
+// ApproveFollowRequest approves a pending request, returning sql.ErrNoRows
+// when there's none.
+func (pg *PostgresFollowStore) ApproveFollowRequest(followeeID, followerID int) error {
+	query := `
+		UPDATE follows
+		SET approved_at = CURRENT_TIMESTAMP
+		WHERE followee_id = $1 AND follower_id = $2 AND approved_at IS NULL
+	`
+
+	return pg.execFollowRequest(query, followeeID, followerID)
+}
+
+// DeclineFollowRequest deletes a pending request, returning sql.ErrNoRows
+// when there's none.
+func (pg *PostgresFollowStore) DeclineFollowRequest(followeeID, followerID int) error {
+	query := `
+		DELETE FROM follows
+		WHERE followee_id = $1 AND follower_id = $2 AND approved_at IS NULL
+	`
+
+	return pg.execFollowRequest(query, followeeID, followerID)
+}
+
+func (pg *PostgresFollowStore) execFollowRequest(query string, followeeID, followerID int) error {
+	result, err := pg.db.Exec(query, followeeID, followerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Unfollow deletes a follow, or withdraws a request that is still pending.
+func (pg *PostgresFollowStore) Unfollow(followerID, followeeID int) error {
+	query := `
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followee_id = $2
+	`
+
+	result, err := pg.db.Exec(query, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2 AND approved_at IS NOT NULL)
+	`
+
+	var following bool
+	err := pg.db.QueryRow(query, followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+func (pg *PostgresFollowStore) ListFollowers(userID int) ([]*FollowUser, error) {
+	query := `
+		SELECT u.id, u.username, u.bio, f.approved_at
+		FROM follows f
+		INNER JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = $1 AND f.approved_at IS NOT NULL
+		ORDER BY f.approved_at DESC
+	`
+
+	return pg.listFollowUsers(query, userID)
+}
+
+func (pg *PostgresFollowStore) ListFollowing(userID int) ([]*FollowUser, error) {
+	query := `
+		SELECT u.id, u.username, u.bio, f.approved_at
+		FROM follows f
+		INNER JOIN users u ON u.id = f.followee_id
+		WHERE f.follower_id = $1 AND f.approved_at IS NOT NULL
+		ORDER BY f.approved_at DESC
+	`
+
+	return pg.listFollowUsers(query, userID)
+}
+
+// ListFollowRequests returns the users waiting for userID to approve them.
+func (pg *PostgresFollowStore) ListFollowRequests(userID int) ([]*FollowUser, error) {
+	query := `
+		SELECT u.id, u.username, u.bio, f.created_at
+		FROM follows f
+		INNER JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = $1 AND f.approved_at IS NULL
+		ORDER BY f.created_at DESC
+	`
+
+	return pg.listFollowUsers(query, userID)
+}
+
+func (pg *PostgresFollowStore) listFollowUsers(query string, userID int) ([]*FollowUser, error) {
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*FollowUser{}
+	for rows.Next() {
+		user := &FollowUser{}
+		var bio sql.NullString
+		err = rows.Scan(&user.ID, &user.Username, &bio, &user.FollowedAt)
+		if err != nil {
+			return nil, err
+		}
+		user.Bio = bio.String
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WorkoutGrant lets one specific user see a workout and comment on it.
+type WorkoutGrant struct {
+	WorkoutID int       `json:"workout_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PostgresGrantStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGrantStore(db *sql.DB) *PostgresGrantStore {
+	return &PostgresGrantStore{
+		db: db,
+	}
+}
+
+type GrantStore interface {
+	GrantAccess(workoutID int64, userID int) error
+	RevokeAccess(workoutID int64, userID int) error
+	HasAccess(workoutID int64, userID int) (bool, error)
+	ListGrants(workoutID int64) ([]*WorkoutGrant, error)
+}
+
+// GrantAccess is idempotent; granting the same user twice is not an error.
+func (pg *PostgresGrantStore) GrantAccess(workoutID int64, userID int) error {
+	query := `
+		INSERT INTO workout_grants (workout_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := pg.db.Exec(query, workoutID, userID)
+	return err
+}
+
+func (pg *PostgresGrantStore) RevokeAccess(workoutID int64, userID int) error {
+	query := `
+		DELETE FROM workout_grants
+		WHERE workout_id = $1 AND user_id = $2
+	`
+
+	result, err := pg.db.Exec(query, workoutID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresGrantStore) HasAccess(workoutID int64, userID int) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM workout_grants WHERE workout_id = $1 AND user_id = $2)
+	`
+
+	var granted bool
+	err := pg.db.QueryRow(query, workoutID, userID).Scan(&granted)
+	return granted, err
+}
+
+func (pg *PostgresGrantStore) ListGrants(workoutID int64) ([]*WorkoutGrant, error) {
+	query := `
+		SELECT g.workout_id, g.user_id, u.username, g.created_at
+		FROM workout_grants g
+		INNER JOIN users u ON u.id = g.user_id
+		WHERE g.workout_id = $1
+		ORDER BY g.created_at
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []*WorkoutGrant{}
+	for rows.Next() {
+		grant := &WorkoutGrant{}
+		err = rows.Scan(&grant.WorkoutID, &grant.UserID, &grant.Username, &grant.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Identity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's stable subject.
+type Identity struct {
+	ID          int64     `json:"id"`
+	UserID      int       `json:"-"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+type PostgresIdentityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityStore(db *sql.DB) *PostgresIdentityStore {
+	return &PostgresIdentityStore{
+		db: db,
+	}
+}
+
+type IdentityStore interface {
+	GetUserByIdentity(provider, subject string) (*User, error)
+	LinkIdentity(identity *Identity) error
+	CreateUserWithIdentity(user *User, identity *Identity) error
+	TouchIdentity(provider, subject, email string) error
+}
+
+// GetUserByIdentity returns the user linked to the provider subject, or nil
+// if the identity has never logged in.
+func (pg *PostgresIdentityStore) GetUserByIdentity(provider, subject string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.activated, u.role, u.disabled_at, u.created_at, u.updated_at
+		FROM user_identities i
+		INNER JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	err := pg.db.QueryRow(query, provider, subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Activated,
+		&user.Role,
+		&user.DisabledAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (pg *PostgresIdentityStore) LinkIdentity(identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_login_at
+	`
+
+	return pg.db.QueryRow(query, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(
+		&identity.ID, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+}
+
+// CreateUserWithIdentity provisions a new user and links the identity in one
+// transaction, so a failed link never leaves an orphaned account behind.
+func (pg *PostgresIdentityStore) CreateUserWithIdentity(user *User, identity *Identity) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (username, email, password_hash, bio, activated)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, role, created_at, updated_at
+	`
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.Activated).Scan(
+		&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	identity.UserID = user.ID
+	query = `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_login_at
+	`
+	err = tx.QueryRow(query, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(
+		&identity.ID, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TouchIdentity records a login through the identity and keeps the email the
+// provider last reported.
+func (pg *PostgresIdentityStore) TouchIdentity(provider, subject, email string) error {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = CURRENT_TIMESTAMP, email = $3
+		WHERE provider = $1 AND subject = $2
+	`
+
+	result, err := pg.db.Exec(query, provider, subject, email)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
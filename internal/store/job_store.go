@@ -0,0 +1,260 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job types.
+const (
+	JobSendEmail        = "email.send"
+	JobWorkoutSaved     = "workout.saved"
+	JobTrainingGaps     = "notifications.training_gaps"
+	JobPurgeExpiredData = "maintenance.purge"
+)
+
+// Job statuses. Jobs that run out of attempts are dead-lettered: they stay
+// in the table as dead until an admin retries them.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// DefaultJobMaxAttempts applies to jobs enqueued without a MaxAttempts.
+const DefaultJobMaxAttempts = 5
+
+// Job is a unit of background work run after the transaction that enqueued
+// it commits.
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	UniqueKey   *string         `json:"unique_key,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   *string         `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// NewJob builds a job of the type with payload encoded as JSON. It runs as
+// soon as possible unless RunAt is set.
+func NewJob(jobType string, payload any) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Type: jobType, Payload: data, MaxAttempts: DefaultJobMaxAttempts}, nil
+}
+
+// JobFilter narrows down ListJobs. Zero values match everything.
+type JobFilter struct {
+	Status   string
+	Type     string
+	Page     int
+	PageSize int
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so jobs can be enqueued
+// inside another store's transaction.
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type PostgresJobStore struct {
+	db *sql.DB
+}
+
+func NewPostgresJobStore(db *sql.DB) *PostgresJobStore {
+	return &PostgresJobStore{
+		db: db,
+	}
+}
+
+type JobStore interface {
+	EnqueueJob(*Job) error
+	ClaimJobs(types []string, limit int, lease time.Duration) ([]*Job, error)
+	CompleteJob(id int64, attempt int) error
+	RetryJob(id int64, attempt int, lastError string, runAt time.Time) error
+	KillJob(id int64, attempt int, lastError string) error
+	ListJobs(filter JobFilter) ([]*Job, int, error)
+	RequeueJob(id int64) error
+}
+
+// EnqueueJob inserts the job using q, which may be a transaction. A job
+// whose UniqueKey matches an unfinished job is skipped, leaving its ID 0.
+func EnqueueJob(q Querier, job *Job) error {
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultJobMaxAttempts
+	}
+	payload := job.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	query := `
+		INSERT INTO jobs (type, payload, unique_key, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4, COALESCE($5, CURRENT_TIMESTAMP))
+		ON CONFLICT (unique_key) WHERE status IN ('pending', 'running') DO NOTHING
+		RETURNING id, status, run_at, created_at
+	`
+
+	err := q.QueryRow(query, job.Type, string(payload), job.UniqueKey, job.MaxAttempts, runAt).Scan(
+		&job.ID, &job.Status, &job.RunAt, &job.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func (pg *PostgresJobStore) EnqueueJob(job *Job) error {
+	return EnqueueJob(pg.db, job)
+}
+
+// ClaimJobs marks up to limit due jobs of the given types as running and
+// returns them. Jobs whose lease ran out, because their worker died, are
+// claimed again.
+func (pg *PostgresJobStore) ClaimJobs(types []string, limit int, lease time.Duration) ([]*Job, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM jobs
+			WHERE type = ANY($1)
+			AND ((status = 'pending' AND run_at <= CURRENT_TIMESTAMP) OR (status = 'running' AND locked_until < CURRENT_TIMESTAMP))
+			ORDER BY run_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE jobs j
+		SET status = 'running', attempts = j.attempts + 1,
+			locked_until = CURRENT_TIMESTAMP + make_interval(secs => $3), updated_at = CURRENT_TIMESTAMP
+		FROM due
+		WHERE j.id = due.id
+		RETURNING j.id, j.type, j.payload, j.unique_key, j.status, j.attempts, j.max_attempts, j.run_at, j.last_error, j.created_at, j.finished_at
+	`
+
+	rows, err := pg.db.Query(query, types, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job := &Job{}
+		var payload []byte
+		err = rows.Scan(&job.ID, &job.Type, &payload, &job.UniqueKey, &job.Status, &job.Attempts, &job.MaxAttempts,
+			&job.RunAt, &job.LastError, &job.CreatedAt, &job.FinishedAt)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = payload
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// The methods finishing a job only apply to the attempt that claimed it.
+// If the job's lease ran out and another runner claimed it again, the
+// attempt no longer matches and they return sql.ErrNoRows.
+
+// CompleteJob marks the job as succeeded.
+func (pg *PostgresJobStore) CompleteJob(id int64, attempt int) error {
+	return pg.finishJob(`
+		UPDATE jobs
+		SET status = 'succeeded', locked_until = NULL, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'running' AND attempts = $2
+	`, id, attempt)
+}
+
+// RetryJob puts a failed job back in the queue to run again at runAt.
+func (pg *PostgresJobStore) RetryJob(id int64, attempt int, lastError string, runAt time.Time) error {
+	return pg.finishJob(`
+		UPDATE jobs
+		SET status = 'pending', locked_until = NULL, last_error = $3, run_at = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'running' AND attempts = $2
+	`, id, attempt, lastError, runAt)
+}
+
+// KillJob dead-letters a job that can't succeed.
+func (pg *PostgresJobStore) KillJob(id int64, attempt int, lastError string) error {
+	return pg.finishJob(`
+		UPDATE jobs
+		SET status = 'dead', locked_until = NULL, last_error = $3, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'running' AND attempts = $2
+	`, id, attempt, lastError)
+}
+
+func (pg *PostgresJobStore) finishJob(query string, args ...any) error {
+	result, err := pg.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresJobStore) ListJobs(filter JobFilter) ([]*Job, int, error) {
+	query := `
+		SELECT count(*) OVER(), id, type, payload, unique_key, status, attempts, max_attempts, run_at, last_error, created_at, finished_at
+		FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := pg.db.Query(query, filter.Status, filter.Type, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	jobs := []*Job{}
+	for rows.Next() {
+		job := &Job{}
+		var payload []byte
+		err = rows.Scan(&total, &job.ID, &job.Type, &payload, &job.UniqueKey, &job.Status, &job.Attempts, &job.MaxAttempts,
+			&job.RunAt, &job.LastError, &job.CreatedAt, &job.FinishedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		job.Payload = payload
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return jobs, total, nil
+}
+
+// RequeueJob gives a dead job a fresh set of attempts, starting now.
+func (pg *PostgresJobStore) RequeueJob(id int64) error {
+	return pg.finishJob(`
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = CURRENT_TIMESTAMP, finished_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'dead'
+	`, id)
+}
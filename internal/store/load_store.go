@@ -0,0 +1,173 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoadDay is the state of the training load model at the end of a UTC day.
+// Acute and Chronic are exponentially weighted averages of daily load over
+// a week and four weeks; Fitness and Fatigue are the two components of the
+// Banister impulse-response model.
+type LoadDay struct {
+	Day     time.Time
+	Load    float64
+	Acute   float64
+	Chronic float64
+	Fitness float64
+	Fatigue float64
+}
+
+type PostgresLoadStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoadStore(db *sql.DB) *PostgresLoadStore {
+	return &PostgresLoadStore{db: db}
+}
+
+// LoadStore caches each user's training load model day by day. The cached
+// days always run without gaps from the first one, as saving or deleting a
+// workout removes the days from its own onwards.
+type LoadStore interface {
+	// GetLatestLoadDay returns the last cached day, or nil when there are
+	// none, along with the version to pass to SaveLoadDays.
+	GetLatestLoadDay(userID int) (*LoadDay, int64, error)
+	ListLoadDays(userID int, from, to time.Time) ([]*LoadDay, error)
+	// SaveLoadDays caches days following the latest one, unless days were
+	// removed since version was read. It reports whether they were saved.
+	SaveLoadDays(userID int, version int64, days []*LoadDay) (bool, error)
+}
+
+func (pg *PostgresLoadStore) GetLatestLoadDay(userID int) (*LoadDay, int64, error) {
+	// The version is read first: days removed after it are caught on save
+	var version int64
+	err := pg.db.QueryRow(`SELECT COALESCE((SELECT version FROM training_load_versions WHERE user_id = $1), 0)`, userID).Scan(&version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+	SELECT day, load, acute, chronic, fitness, fatigue
+	FROM training_load_days
+	WHERE user_id = $1
+	ORDER BY day DESC
+	LIMIT 1
+	`
+
+	day := &LoadDay{}
+	err = pg.db.QueryRow(query, userID).Scan(&day.Day, &day.Load, &day.Acute, &day.Chronic, &day.Fitness, &day.Fatigue)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, version, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return day, version, nil
+}
+
+// ListLoadDays returns the cached days between from and to, inclusive,
+// oldest first.
+func (pg *PostgresLoadStore) ListLoadDays(userID int, from, to time.Time) ([]*LoadDay, error) {
+	query := `
+	SELECT day, load, acute, chronic, fitness, fatigue
+	FROM training_load_days
+	WHERE user_id = $1 AND day BETWEEN $2::date AND $3::date
+	ORDER BY day
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []*LoadDay{}
+	for rows.Next() {
+		day := &LoadDay{}
+		err = rows.Scan(&day.Day, &day.Load, &day.Acute, &day.Chronic, &day.Fitness, &day.Fatigue)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
+
+func (pg *PostgresLoadStore) SaveLoadDays(userID int, version int64, days []*LoadDay) (bool, error) {
+	if len(days) == 0 {
+		return true, nil
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Holding the row keeps workouts from removing days until this commits
+	_, err = tx.Exec(`INSERT INTO training_load_versions (user_id, version) VALUES ($1, 0) ON CONFLICT DO NOTHING`, userID)
+	if err != nil {
+		return false, err
+	}
+	var current int64
+	err = tx.QueryRow(`SELECT version FROM training_load_versions WHERE user_id = $1 FOR UPDATE`, userID).Scan(&current)
+	if err != nil {
+		return false, err
+	}
+	if current != version {
+		return false, nil
+	}
+
+	dates := make([]time.Time, len(days))
+	loads := make([]float64, len(days))
+	acutes := make([]float64, len(days))
+	chronics := make([]float64, len(days))
+	fitnesses := make([]float64, len(days))
+	fatigues := make([]float64, len(days))
+	for i, day := range days {
+		dates[i] = day.Day
+		loads[i] = day.Load
+		acutes[i] = day.Acute
+		chronics[i] = day.Chronic
+		fitnesses[i] = day.Fitness
+		fatigues[i] = day.Fatigue
+	}
+
+	query := `
+	INSERT INTO training_load_days (user_id, day, load, acute, chronic, fitness, fatigue)
+	SELECT $1, * FROM unnest($2::date[], $3::float8[], $4::float8[], $5::float8[], $6::float8[], $7::float8[])
+	ON CONFLICT (user_id, day) DO NOTHING
+	`
+
+	_, err = tx.Exec(query, userID, dates, loads, acutes, chronics, fitnesses, fatigues)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// invalidateTrainingLoad removes the cached days of the workout's owner
+// from the day of the workout onwards, in the transaction changing it.
+func invalidateTrainingLoad(tx *sql.Tx, workoutID int) error {
+	query := `
+	WITH workout AS (
+		SELECT user_id, (COALESCE(started_at, created_at) AT TIME ZONE 'UTC')::date AS day
+		FROM workouts
+		WHERE id = $1
+	), removed AS (
+		DELETE FROM training_load_days d
+		USING workout w
+		WHERE d.user_id = w.user_id AND d.day >= w.day
+	)
+	INSERT INTO training_load_versions (user_id, version)
+	SELECT user_id, 1 FROM workout
+	ON CONFLICT (user_id) DO UPDATE SET version = training_load_versions.version + 1
+	`
+
+	_, err := tx.Exec(query, workoutID)
+	return err
+}
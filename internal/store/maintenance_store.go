@@ -0,0 +1,61 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Retention periods for data nobody needs once it's old enough.
+const (
+	SessionRetention          = 30 * 24 * time.Hour
+	ReadNotificationRetention = 90 * 24 * time.Hour
+	FinishedJobRetention      = 7 * 24 * time.Hour
+	WebhookDeliveryRetention  = 30 * 24 * time.Hour
+)
+
+type PostgresMaintenanceStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMaintenanceStore(db *sql.DB) *PostgresMaintenanceStore {
+	return &PostgresMaintenanceStore{
+		db: db,
+	}
+}
+
+type MaintenanceStore interface {
+	PurgeExpiredData(now time.Time) (map[string]int64, error)
+}
+
+// PurgeExpiredData deletes expired tokens, long-dead sessions, old read
+// notifications, finished jobs and delivered webhooks, returning how many
+// rows were deleted from each table.
+func (pg *PostgresMaintenanceStore) PurgeExpiredData(now time.Time) (map[string]int64, error) {
+	purges := []struct {
+		table string
+		query string
+		args  []any
+	}{
+		{"tokens", `DELETE FROM tokens WHERE expiry < $1`, []any{now}},
+		{"sessions", `DELETE FROM sessions WHERE COALESCE(revoked_at, expires_at) < $1`, []any{now.Add(-SessionRetention)}},
+		{"notifications", `DELETE FROM notifications WHERE read_at < $1`, []any{now.Add(-ReadNotificationRetention)}},
+		{"jobs", `DELETE FROM jobs WHERE status = 'succeeded' AND finished_at < $1`, []any{now.Add(-FinishedJobRetention)}},
+		{"webhook_deliveries", `DELETE FROM webhook_deliveries WHERE status = 'succeeded' AND created_at < $1`, []any{now.Add(-WebhookDeliveryRetention)}},
+	}
+
+	deleted := make(map[string]int64, len(purges))
+	for _, purge := range purges {
+		result, err := pg.db.Exec(purge.query, purge.args...)
+		if err != nil {
+			return deleted, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted[purge.table] = rowsAffected
+	}
+
+	return deleted, nil
+}
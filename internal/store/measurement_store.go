@@ -0,0 +1,235 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+)
+
+// Measurement metrics.
+const (
+	MetricBodyweight = "bodyweight"
+	MetricBodyFat    = "body_fat"
+	MetricWaist      = "waist"
+	MetricChest      = "chest"
+	MetricHips       = "hips"
+	MetricNeck       = "neck"
+	MetricArm        = "arm"
+	MetricThigh      = "thigh"
+)
+
+// MeasurementUnits lists the units each metric can be recorded in.
+var MeasurementUnits = map[string][]string{
+	MetricBodyweight: {units.Kilograms, units.Pounds},
+	MetricBodyFat:    {"%"},
+	MetricWaist:      {units.Centimeters, units.Inches},
+	MetricChest:      {units.Centimeters, units.Inches},
+	MetricHips:       {units.Centimeters, units.Inches},
+	MetricNeck:       {units.Centimeters, units.Inches},
+	MetricArm:        {units.Centimeters, units.Inches},
+	MetricThigh:      {units.Centimeters, units.Inches},
+}
+
+func ValidMetric(metric string) bool {
+	_, ok := MeasurementUnits[metric]
+	return ok
+}
+
+// ValidMeasurementUnit reports whether the metric can be recorded in unit.
+func ValidMeasurementUnit(metric, unit string) bool {
+	for _, u := range MeasurementUnits[metric] {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
+
+type Measurement struct {
+	ID         int64     `json:"id"`
+	UserID     int       `json:"user_id"`
+	Metric     string    `json:"metric"`
+	Value      float64   `json:"value"`
+	Unit       string    `json:"unit"`
+	MeasuredAt time.Time `json:"measured_at"`
+	Notes      *string   `json:"notes,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ValueIn returns the measurement converted to unit, which must be one of
+// the units of its metric.
+func (m *Measurement) ValueIn(unit string) float64 {
+	switch {
+	case m.Unit == unit:
+		return m.Value
+	case m.Unit == units.Pounds && unit == units.Kilograms:
+		return m.Value * units.KilogramsPerPound
+	case m.Unit == units.Kilograms && unit == units.Pounds:
+		return m.Value / units.KilogramsPerPound
+	case m.Unit == units.Inches && unit == units.Centimeters:
+		return m.Value * units.CentimetersPerInch
+	case m.Unit == units.Centimeters && unit == units.Inches:
+		return m.Value / units.CentimetersPerInch
+	}
+	return m.Value
+}
+
+// MeasurementFilter narrows down ListMeasurements. Zero values match everything.
+type MeasurementFilter struct {
+	Metric string
+	From   *time.Time
+	To     *time.Time
+}
+
+type PostgresMeasurementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMeasurementStore(db *sql.DB) *PostgresMeasurementStore {
+	return &PostgresMeasurementStore{
+		db: db,
+	}
+}
+
+type MeasurementStore interface {
+	CreateMeasurement(measurement *Measurement) error
+	GetMeasurement(id int64) (*Measurement, error)
+	ListMeasurements(userID int, filter MeasurementFilter) ([]*Measurement, error)
+	UpdateMeasurement(measurement *Measurement) error
+	DeleteMeasurement(id int64) error
+	GetBodyweightKg(userID int, at time.Time) (*float64, error)
+}
+
+func (pg *PostgresMeasurementStore) CreateMeasurement(measurement *Measurement) error {
+	query := `
+		INSERT INTO measurements (user_id, metric, value, unit, measured_at, notes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`
+
+	return pg.db.QueryRow(query, measurement.UserID, measurement.Metric, measurement.Value, measurement.Unit, measurement.MeasuredAt, measurement.Notes).Scan(
+		&measurement.ID, &measurement.CreatedAt, &measurement.UpdatedAt,
+	)
+}
+
+func (pg *PostgresMeasurementStore) GetMeasurement(id int64) (*Measurement, error) {
+	query := `
+		SELECT id, user_id, metric, value, unit, measured_at, notes, created_at, updated_at
+		FROM measurements
+		WHERE id = $1
+	`
+
+	measurement := &Measurement{}
+	err := pg.db.QueryRow(query, id).Scan(
+		&measurement.ID, &measurement.UserID, &measurement.Metric, &measurement.Value, &measurement.Unit,
+		&measurement.MeasuredAt, &measurement.Notes, &measurement.CreatedAt, &measurement.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return measurement, nil
+}
+
+// ListMeasurements returns the user's measurements in the order they were
+// taken.
+func (pg *PostgresMeasurementStore) ListMeasurements(userID int, filter MeasurementFilter) ([]*Measurement, error) {
+	query := `
+		SELECT id, user_id, metric, value, unit, measured_at, notes, created_at, updated_at
+		FROM measurements
+		WHERE user_id = $1
+		AND ($2 = '' OR metric = $2)
+		AND ($3::timestamptz IS NULL OR measured_at >= $3)
+		AND ($4::timestamptz IS NULL OR measured_at <= $4)
+		ORDER BY measured_at, id
+	`
+
+	rows, err := pg.db.Query(query, userID, filter.Metric, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := []*Measurement{}
+	for rows.Next() {
+		measurement := &Measurement{}
+		err = rows.Scan(&measurement.ID, &measurement.UserID, &measurement.Metric, &measurement.Value, &measurement.Unit,
+			&measurement.MeasuredAt, &measurement.Notes, &measurement.CreatedAt, &measurement.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, measurement)
+	}
+
+	return measurements, rows.Err()
+}
+
+func (pg *PostgresMeasurementStore) UpdateMeasurement(measurement *Measurement) error {
+	query := `
+		UPDATE measurements
+		SET metric = $1, value = $2, unit = $3, measured_at = $4, notes = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING updated_at
+	`
+
+	err := pg.db.QueryRow(query, measurement.Metric, measurement.Value, measurement.Unit, measurement.MeasuredAt, measurement.Notes, measurement.ID).Scan(&measurement.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+func (pg *PostgresMeasurementStore) DeleteMeasurement(id int64) error {
+	query := `
+		DELETE FROM measurements
+		WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetBodyweightKg returns the user's bodyweight in kilograms as of at: the
+// latest weigh-in before it, or failing that the first one after. It returns
+// nil if the user never weighed in.
+func (pg *PostgresMeasurementStore) GetBodyweightKg(userID int, at time.Time) (*float64, error) {
+	query := `
+		SELECT CASE unit WHEN 'lb' THEN value * $3 ELSE value END
+		FROM measurements
+		WHERE user_id = $1 AND metric = 'bodyweight'
+		ORDER BY measured_at <= $2 DESC, abs(extract(epoch FROM measured_at - $2))
+		LIMIT 1
+	`
+
+	var kg float64
+	err := pg.db.QueryRow(query, userID, at, units.KilogramsPerPound).Scan(&kg)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return &kg, nil
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Notification is a message shown in a user's notification center. Payload
+// holds the type-specific details.
+type Notification struct {
+	ID        int64           `json:"id"`
+	UserID    int             `json:"-"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NotificationFilter narrows down ListNotifications.
+type NotificationFilter struct {
+	UnreadOnly bool
+	Page       int
+	PageSize   int
+}
+
+// InactiveUser is a user who hasn't logged a workout for a while and
+// hasn't been told about it since their last one.
+type InactiveUser struct {
+	UserID        int
+	LastWorkoutAt time.Time
+}
+
+type PostgresNotificationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresNotificationStore(db *sql.DB) *PostgresNotificationStore {
+	return &PostgresNotificationStore{
+		db: db,
+	}
+}
+
+type NotificationStore interface {
+	CreateNotification(*Notification) error
+	ListNotifications(userID int, filter NotificationFilter) ([]*Notification, int, error)
+	CountUnread(userID int) (int, error)
+	HasNotificationSince(userID int, notificationType string, since time.Time) (bool, error)
+	MarkRead(id int64, userID int) error
+	MarkAllRead(userID int) (int64, error)
+	GetPreferences(userID int) (map[string]bool, error)
+	SetPreference(userID int, notificationType string, enabled bool) error
+	ListInactiveUsers(cutoff time.Time, notificationType string) ([]*InactiveUser, error)
+}
+
+func (pg *PostgresNotificationStore) CreateNotification(notification *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, type, payload)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	payload := notification.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+
+	return pg.db.QueryRow(query, notification.UserID, notification.Type, string(payload)).Scan(&notification.ID, &notification.CreatedAt)
+}
+
+func (pg *PostgresNotificationStore) ListNotifications(userID int, filter NotificationFilter) ([]*Notification, int, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, type, payload, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := pg.db.Query(query, userID, filter.UnreadOnly, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	notifications := []*Notification{}
+	for rows.Next() {
+		notification := &Notification{}
+		var payload []byte
+		err = rows.Scan(&total, &notification.ID, &notification.UserID, &notification.Type, &payload, &notification.ReadAt, &notification.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		notification.Payload = payload
+		notifications = append(notifications, notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return notifications, total, nil
+}
+
+func (pg *PostgresNotificationStore) CountUnread(userID int) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	var count int
+	err := pg.db.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+func (pg *PostgresNotificationStore) HasNotificationSince(userID int, notificationType string, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM notifications
+			WHERE user_id = $1 AND type = $2 AND created_at >= $3
+		)
+	`
+
+	var exists bool
+	err := pg.db.QueryRow(query, userID, notificationType, since).Scan(&exists)
+	return exists, err
+}
+
+// MarkRead marks one of the user's notifications as read. Marking a
+// notification that is already read is not an error.
+func (pg *PostgresNotificationStore) MarkRead(id int64, userID int) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := pg.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user as read and
+// returns how many there were.
+func (pg *PostgresNotificationStore) MarkAllRead(userID int) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	result, err := pg.db.Exec(query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetPreferences returns the types the user explicitly turned on or off.
+// Types missing from the map use their default.
+func (pg *PostgresNotificationStore) GetPreferences(userID int) (map[string]bool, error) {
+	query := `
+		SELECT type, enabled
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := map[string]bool{}
+	for rows.Next() {
+		var notificationType string
+		var enabled bool
+		err = rows.Scan(&notificationType, &enabled)
+		if err != nil {
+			return nil, err
+		}
+		preferences[notificationType] = enabled
+	}
+
+	return preferences, rows.Err()
+}
+
+func (pg *PostgresNotificationStore) SetPreference(userID int, notificationType string, enabled bool) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE
+		SET enabled = EXCLUDED.enabled, updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := pg.db.Exec(query, userID, notificationType, enabled)
+	return err
+}
+
+// ListInactiveUsers returns active users whose latest workout is older than
+// cutoff and who haven't received a notificationType notification since.
+func (pg *PostgresNotificationStore) ListInactiveUsers(cutoff time.Time, notificationType string) ([]*InactiveUser, error) {
+	query := `
+		SELECT w.user_id, max(w.created_at) AS last_workout_at
+		FROM workouts w
+		INNER JOIN users u ON u.id = w.user_id
+		WHERE u.activated AND u.disabled_at IS NULL
+		GROUP BY w.user_id
+		HAVING max(w.created_at) < $1
+		AND NOT EXISTS (
+			SELECT 1 FROM notifications n
+			WHERE n.user_id = w.user_id AND n.type = $2 AND n.created_at > max(w.created_at)
+		)
+	`
+
+	rows, err := pg.db.Query(query, cutoff, notificationType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*InactiveUser{}
+	for rows.Next() {
+		user := &InactiveUser{}
+		err = rows.Scan(&user.UserID, &user.LastWorkoutAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Progression schemes.
+const (
+	// ProgressionLinear adds weight every session.
+	ProgressionLinear = "linear"
+	// ProgressionDouble adds reps up to the top of a range, then weight.
+	ProgressionDouble = "double"
+	// ProgressionRPE sets the weight for a target RPE.
+	ProgressionRPE = "rpe"
+)
+
+func ValidProgressionScheme(scheme string) bool {
+	switch scheme {
+	case ProgressionLinear, ProgressionDouble, ProgressionRPE:
+		return true
+	}
+	return false
+}
+
+// ProgressionSettings is how a user progresses on an exercise. Increment is
+// stored in kilograms; handlers convert it to and from the caller's units
+// and set IncrementUnit.
+type ProgressionSettings struct {
+	UserID        int        `json:"-"`
+	ExerciseName  string     `json:"exercise_name"`
+	Scheme        string     `json:"scheme"`
+	Increment     float64    `json:"increment"`
+	IncrementUnit string     `json:"increment_unit,omitempty"`
+	MinReps       int        `json:"min_reps"`
+	MaxReps       int        `json:"max_reps"`
+	TargetRPE     float64    `json:"target_rpe"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+type PostgresProgressionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProgressionStore(db *sql.DB) *PostgresProgressionStore {
+	return &PostgresProgressionStore{db: db}
+}
+
+type ProgressionStore interface {
+	GetProgressionSettings(userID int, exerciseName string) (*ProgressionSettings, error)
+	SaveProgressionSettings(*ProgressionSettings) error
+}
+
+// GetProgressionSettings returns the user's settings for an exercise, or
+// nil if they haven't chosen any.
+func (pg *PostgresProgressionStore) GetProgressionSettings(userID int, exerciseName string) (*ProgressionSettings, error) {
+	query := `
+	SELECT user_id, exercise_name, scheme, increment_kg, min_reps, max_reps, target_rpe, updated_at
+	FROM progression_settings
+	WHERE user_id = $1 AND exercise_name = $2
+	`
+
+	settings := &ProgressionSettings{}
+	err := pg.db.QueryRow(query, userID, strings.ToLower(exerciseName)).Scan(&settings.UserID, &settings.ExerciseName, &settings.Scheme,
+		&settings.Increment, &settings.MinReps, &settings.MaxReps, &settings.TargetRPE, &settings.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SaveProgressionSettings creates or replaces the user's settings for an
+// exercise.
+func (pg *PostgresProgressionStore) SaveProgressionSettings(settings *ProgressionSettings) error {
+	query := `
+	INSERT INTO progression_settings (user_id, exercise_name, scheme, increment_kg, min_reps, max_reps, target_rpe)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (user_id, exercise_name) DO UPDATE
+	SET scheme = EXCLUDED.scheme, increment_kg = EXCLUDED.increment_kg, min_reps = EXCLUDED.min_reps,
+		max_reps = EXCLUDED.max_reps, target_rpe = EXCLUDED.target_rpe, updated_at = CURRENT_TIMESTAMP
+	RETURNING exercise_name, updated_at
+	`
+
+	return pg.db.QueryRow(query, settings.UserID, strings.ToLower(settings.ExerciseName), settings.Scheme, settings.Increment,
+		settings.MinReps, settings.MaxReps, settings.TargetRPE).Scan(&settings.ExerciseName, &settings.UpdatedAt)
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// Sample is one reading of a workout's sensors, taken OffsetMs
+// milliseconds after it started.
+type Sample struct {
+	OffsetMs  int  `json:"offset_ms"`
+	HeartRate *int `json:"heart_rate,omitempty"`
+	Power     *int `json:"power,omitempty"`
+	Cadence   *int `json:"cadence,omitempty"`
+}
+
+// HeartRateMetrics summarize a workout's heart rate samples. Zone seconds
+// are the time spent in each of the five heart rate zones.
+type HeartRateMetrics struct {
+	AvgHeartRate  *int     `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate  *int     `json:"max_heart_rate,omitempty"`
+	HRZoneSeconds []int    `json:"hr_zone_seconds,omitempty"`
+	TRIMP         *float64 `json:"trimp,omitempty"`
+}
+
+// SampleSource yields the samples of a workout in order.
+type SampleSource interface {
+	// Next returns the next sample, or io.EOF after the last one.
+	Next() (*Sample, error)
+	// HeartRate returns the metrics derived from the samples once Next has
+	// returned io.EOF.
+	HeartRate() HeartRateMetrics
+}
+
+type PostgresSampleStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSampleStore(db *sql.DB) *PostgresSampleStore {
+	return &PostgresSampleStore{
+		db: db,
+	}
+}
+
+type SampleStore interface {
+	ReplaceSamples(ctx context.Context, workoutID int64, source SampleSource) (int64, error)
+	ListSamples(workoutID int64, resolutionMs int) ([]Sample, error)
+}
+
+// copySource feeds a SampleSource to COPY.
+type copySource struct {
+	workoutID int64
+	source    SampleSource
+	sample    *Sample
+	err       error
+}
+
+func (c *copySource) Next() bool {
+	c.sample, c.err = c.source.Next()
+	if errors.Is(c.err, io.EOF) {
+		c.err = nil
+		return false
+	}
+	return c.err == nil
+}
+
+func (c *copySource) Values() ([]any, error) {
+	return []any{c.workoutID, c.sample.OffsetMs, c.sample.HeartRate, c.sample.Power, c.sample.Cadence}, nil
+}
+
+func (c *copySource) Err() error {
+	return c.err
+}
+
+// ReplaceSamples swaps the workout's samples for those of source, streaming
+// them to the database with COPY, and stores the heart rate metrics derived
+// from them on the workout. Nothing changes if source fails part way.
+func (pg *PostgresSampleStore) ReplaceSamples(ctx context.Context, workoutID int64, source SampleSource) (int64, error) {
+	conn, err := pg.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var copied int64
+	// COPY needs the pgx connection underneath database/sql
+	err = conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+
+		tx, err := stdlibConn.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		_, err = tx.Exec(ctx, `DELETE FROM workout_samples WHERE workout_id = $1`, workoutID)
+		if err != nil {
+			return err
+		}
+
+		copied, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"workout_samples"},
+			[]string{"workout_id", "offset_ms", "heart_rate", "power", "cadence"},
+			&copySource{workoutID: workoutID, source: source},
+		)
+		if err != nil {
+			return err
+		}
+
+		metrics := source.HeartRate()
+		query := `
+			UPDATE workouts
+			SET avg_heart_rate = $1, max_heart_rate = $2, hr_zone_seconds = $3, trimp = $4
+			WHERE id = $5
+		`
+		_, err = tx.Exec(ctx, query, metrics.AvgHeartRate, metrics.MaxHeartRate, metrics.HRZoneSeconds, metrics.TRIMP, workoutID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+
+	return copied, err
+}
+
+// ListSamples returns the workout's samples averaged over buckets of
+// resolutionMs, each at the offset its bucket starts.
+func (pg *PostgresSampleStore) ListSamples(workoutID int64, resolutionMs int) ([]Sample, error) {
+	query := `
+		SELECT offset_ms / $2 * $2 AS bucket,
+			round(avg(heart_rate))::int, round(avg(power))::int, round(avg(cadence))::int
+		FROM workout_samples
+		WHERE workout_id = $1
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := pg.db.Query(query, workoutID, resolutionMs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []Sample{}
+	for rows.Next() {
+		var sample Sample
+		err = rows.Scan(&sample.OffsetMs, &sample.HeartRate, &sample.Power, &sample.Cadence)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session is a login session backing one or more issued access tokens.
+// Revoking a session invalidates every token that carries its ID.
+type Session struct {
+	ID        int64      `json:"id"`
+	UserID    int        `json:"user_id"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	IP        string     `json:"ip,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{
+		db: db,
+	}
+}
+
+type SessionStore interface {
+	CreateSession(*Session) error
+	IsSessionActive(sessionID int64, userID int) (bool, error)
+	ExtendSession(sessionID int64, expiresAt time.Time) error
+	RevokeSession(sessionID int64) error
+	RevokeUserSessions(userID int, exceptSessionID int64) error
+}
+
+func (pg *PostgresSessionStore) CreateSession(session *Session) error {
+	query := `
+		INSERT INTO sessions (user_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	return pg.db.QueryRow(query, session.UserID, session.UserAgent, session.IP, session.ExpiresAt).Scan(
+		&session.ID, &session.CreatedAt,
+	)
+}
+
+func (pg *PostgresSessionStore) IsSessionActive(sessionID int64, userID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		)
+	`
+
+	var active bool
+	err := pg.db.QueryRow(query, sessionID, userID).Scan(&active)
+	if err != nil {
+		return false, err
+	}
+	return active, nil
+}
+
+func (pg *PostgresSessionStore) ExtendSession(sessionID int64, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions SET expires_at = $1
+		WHERE id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := pg.db.Exec(query, expiresAt, sessionID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresSessionStore) RevokeSession(sessionID int64) error {
+	query := `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	result, err := pg.db.Exec(query, sessionID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of the user apart from
+// exceptSessionID. Pass 0 to revoke all of them.
+func (pg *PostgresSessionStore) RevokeUserSessions(userID int, exceptSessionID int64) error {
+	query := `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`
+
+	_, err := pg.db.Exec(query, userID, exceptSessionID)
+	return err
+}
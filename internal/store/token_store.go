@@ -0,0 +1,114 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+const (
+	ScopeActivation    = "activation"
+	ScopePasswordReset = "password-reset"
+	ScopeMFA           = "mfa"
+	ScopeEmailChange   = "email-change"
+)
+
+// Token is a single-use secret emailed to a user. Only the SHA-256 hash of
+// the plaintext is persisted.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int       `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func generateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+type PostgresTokenStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+	return &PostgresTokenStore{
+		db: db,
+	}
+}
+
+type TokenStore interface {
+	CreateToken(userID int, ttl time.Duration, scope string) (*Token, error)
+	ConsumeToken(scope, plaintextToken string) (int, error)
+	DeleteAllForUser(scope string, userID int) error
+}
+
+func (pg *PostgresTokenStore) CreateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = pg.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ConsumeToken deletes an unexpired token with the given scope and returns
+// the ID of its owner, or 0 when there's no such token. Deleting and checking
+// in one statement means concurrent requests can't both redeem it.
+func (pg *PostgresTokenStore) ConsumeToken(scope, plaintextToken string) (int, error) {
+	tokenHash := sha256.Sum256([]byte(plaintextToken))
+
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > now()
+		RETURNING user_id
+	`
+
+	var userID int
+	err := pg.db.QueryRow(query, tokenHash[:], scope).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (pg *PostgresTokenStore) DeleteAllForUser(scope string, userID int) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND user_id = $2
+	`
+
+	_, err := pg.db.Exec(query, scope, userID)
+	return err
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// TwoFactor is a user's TOTP enrollment. It only protects logins once
+// ConfirmedAt is set, i.e. after the user proved their app produces codes.
+type TwoFactor struct {
+	UserID      int
+	Secret      string
+	ConfirmedAt *time.Time
+	LastStep    *int64
+}
+
+func (tf *TwoFactor) Enabled() bool {
+	return tf != nil && tf.ConfirmedAt != nil
+}
+
+// GenerateRecoveryCodes returns fresh one-time codes in the form
+// xxxxx-xxxxx, along with the hashes to store.
+func GenerateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		randomBytes := make([]byte, 7)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case and dashes so codes can be typed loosely.
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
+
+type PostgresTwoFactorStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{
+		db: db,
+	}
+}
+
+type TwoFactorStore interface {
+	GetTwoFactor(userID int) (*TwoFactor, error)
+	SetPendingSecret(userID int, secret string) error
+	EnableTwoFactor(userID int, recoveryCodeHashes [][]byte) error
+	DisableTwoFactor(userID int) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, code string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+}
+
+func (pg *PostgresTwoFactorStore) GetTwoFactor(userID int) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_step
+		FROM user_totp
+		WHERE user_id = $1
+	`
+
+	tf := &TwoFactor{}
+	err := pg.db.QueryRow(query, userID).Scan(&tf.UserID, &tf.Secret, &tf.ConfirmedAt, &tf.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return tf, nil
+}
+
+// SetPendingSecret starts (or restarts) enrollment with a new secret. It
+// never replaces a confirmed secret.
+func (pg *PostgresTwoFactorStore) SetPendingSecret(userID int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = NULL, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL
+	`
+
+	result, err := pg.db.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// EnableTwoFactor confirms the pending secret and replaces any recovery codes.
+func (pg *PostgresTwoFactorStore) EnableTwoFactor(userID int, recoveryCodeHashes [][]byte) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_totp SET confirmed_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresTwoFactorStore) DisableTwoFactor(userID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code for step has been used, returning false
+// if it (or a later one) already was, so an intercepted code can't be replayed.
+func (pg *PostgresTwoFactorStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp SET last_step = $2
+		WHERE user_id = $1 AND (last_step IS NULL OR last_step < $2)
+	`
+
+	result, err := pg.db.Exec(query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode burns a matching unused recovery code.
+func (pg *PostgresTwoFactorStore) UseRecoveryCode(userID int, code string) (bool, error) {
+	query := `
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+
+	result, err := pg.db.Exec(query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (pg *PostgresTwoFactorStore) CountRecoveryCodes(userID int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+
+	var count int
+	err := pg.db.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
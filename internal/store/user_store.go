@@ -1,20 +1,44 @@
 package store
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrDuplicateUsername = errors.New("a user with this username already exists")
+	ErrDuplicateEmail    = errors.New("a user with this email already exists")
+)
+
+// bcryptCost is the work factor for new password hashes. Hashes made with
+// a different cost are upgraded on the next successful login.
+var bcryptCost = 12
+
+// SetBcryptCost changes the work factor used for new password hashes. It
+// must be called before the server starts handling requests.
+func SetBcryptCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	bcryptCost = cost
+	return nil
+}
+
 type password struct {
 	plainText *string
 	hash      []byte
+	rehashed  bool
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), bcryptCost)
 	if err != nil {
 		return err
 	}
@@ -25,6 +49,9 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Matches reports whether plaintextPassword is correct. When it is and the
+// stored hash uses an outdated cost, the hash is replaced in memory and
+// Rehashed reports true so the caller can persist it with UpdatePassword.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
@@ -35,9 +62,35 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 			return false, err
 		}
 	}
+
+	// Failing to upgrade isn't a reason to fail the login; the old hash still works
+	cost, err := bcrypt.Cost(p.hash)
+	if err == nil && cost != bcryptCost && p.Set(plaintextPassword) == nil {
+		p.rehashed = true
+	}
 	return true, nil
 }
 
+// Rehashed reports whether Matches upgraded the hash.
+func (p *password) Rehashed() bool {
+	return p.rehashed
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// CompareDummyPassword spends as long as a real password check without
+// matching anything. Logins for unknown users call it so that response
+// times don't reveal which accounts exist.
+func CompareDummyPassword(plaintextPassword string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcryptCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(plaintextPassword))
+}
+
 var AnonymousUser = &User{}
 
 func (u *User) IsAnonymous() bool {
@@ -45,13 +98,29 @@ func (u *User) IsAnonymous() bool {
 }
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash password  `json:"-"`
-	Bio          string    `json:"bio"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               int        `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	PendingEmail     *string    `json:"pending_email,omitempty"`
+	PasswordHash     password   `json:"-"`
+	Bio              string     `json:"bio"`
+	Activated        bool       `json:"activated"`
+	Role             string     `json:"role"`
+	UnitSystem       string     `json:"unit_system"`
+	MaxHeartRate     *int       `json:"max_heart_rate,omitempty"`
+	RestingHeartRate *int       `json:"resting_heart_rate,omitempty"`
+	DisabledAt       *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// UserFilter narrows down ListUsers. Query matches username or email.
+type UserFilter struct {
+	Query    string
+	Role     string
+	Disabled *bool
+	Page     int
+	PageSize int
 }
 
 type PostgresUserStore struct {
@@ -66,44 +135,111 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 type UserStore interface {
 	CreateUser(*User) error
+	GetUserByID(id int) (*User, error)
 	GetUserByUsername(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserForToken(scope, plaintextToken string) (*User, error)
 	UpdateUser(*User) error
+	UpdatePassword(*User) error
+	DeleteUser(id int) error
+	ListUsers(filter UserFilter) ([]*User, int, error)
+	SetUserDisabled(id int, disabled bool) error
+}
+
+// uniqueViolation maps a unique constraint violation on the users table to
+// the matching sentinel error, returning err unchanged otherwise.
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		switch pgErr.ConstraintName {
+		case "users_username_key":
+			return ErrDuplicateUsername
+		case "users_email_key":
+			return ErrDuplicateEmail
+		}
+	}
+	return err
 }
 
 func (pg *PostgresUserStore) CreateUser(user *User) error {
 	query := `
-		INSERT INTO users (username, email, password_hash, bio)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at
+		INSERT INTO users (username, email, password_hash, bio, activated)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, role, unit_system, created_at, updated_at
 	`
 
-	err := pg.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(
-		&user.ID, &user.CreatedAt, &user.UpdatedAt,
+	err := pg.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.Activated).Scan(
+		&user.ID, &user.Role, &user.UnitSystem, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
-		return err
+		return uniqueViolation(err)
 	}
 	return nil
 }
 
-func (pg *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
-	user := &User{
-		PasswordHash: password{},
-	}
+func (pg *PostgresUserStore) GetUserByID(id int) (*User, error) {
+	query := `
+		SELECT id, username, email, pending_email, password_hash, bio, activated, role, unit_system, max_heart_rate, resting_heart_rate, disabled_at, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`
 
+	return pg.getUser(query, id)
+}
+
+func (pg *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, bio, created_at, updated_at
+		SELECT id, username, email, pending_email, password_hash, bio, activated, role, unit_system, max_heart_rate, resting_heart_rate, disabled_at, created_at, updated_at
 		FROM users
 		WHERE username = $1
 	`
 
-	err := pg.db.QueryRow(query, username).Scan(
+	return pg.getUser(query, username)
+}
+
+func (pg *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, username, email, pending_email, password_hash, bio, activated, role, unit_system, max_heart_rate, resting_heart_rate, disabled_at, created_at, updated_at
+		FROM users
+		WHERE email = $1
+	`
+
+	return pg.getUser(query, email)
+}
+
+// GetUserForToken returns the owner of an unexpired token with the given scope.
+func (pg *PostgresUserStore) GetUserForToken(scope, plaintextToken string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(plaintextToken))
+
+	query := `
+		SELECT users.id, users.username, users.email, users.pending_email, users.password_hash, users.bio, users.activated, users.role, users.unit_system, users.max_heart_rate, users.resting_heart_rate, users.disabled_at, users.created_at, users.updated_at
+		FROM users
+		INNER JOIN tokens ON users.id = tokens.user_id
+		WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3
+	`
+
+	return pg.getUser(query, tokenHash[:], scope, time.Now())
+}
+
+func (pg *PostgresUserStore) getUser(query string, args ...any) (*User, error) {
+	user := &User{
+		PasswordHash: password{},
+	}
+
+	err := pg.db.QueryRow(query, args...).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.PendingEmail,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
+		&user.Role,
+		&user.UnitSystem,
+		&user.MaxHeartRate,
+		&user.RestingHeartRate,
+		&user.DisabledAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -123,11 +259,126 @@ func (pg *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 func (s *PostgresUserStore) UpdateUser(user *User) error {
 	query := `
 		UPDATE users
-		SET username = $1, email = $2, bio = $3, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $4
+		SET username = $1, email = $2, pending_email = $3, bio = $4, activated = $5, unit_system = $6, max_heart_rate = $7, resting_heart_rate = $8,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $9
+	`
+
+	result, err := s.db.Exec(query, user.Username, user.Email, user.PendingEmail, user.Bio, user.Activated, user.UnitSystem, user.MaxHeartRate, user.RestingHeartRate, user.ID)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *PostgresUserStore) UpdatePassword(user *User) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+
+	result, err := s.db.Exec(query, user.PasswordHash.hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteUser removes the user; workouts, entries and sessions go with it
+// through their ON DELETE CASCADE foreign keys.
+func (s *PostgresUserStore) DeleteUser(id int) error {
+	result, err := s.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *PostgresUserStore) ListUsers(filter UserFilter) ([]*User, int, error) {
+	query := `
+		SELECT count(*) OVER(), id, username, email, bio, activated, role, unit_system, max_heart_rate, resting_heart_rate, disabled_at, created_at, updated_at
+		FROM users
+		WHERE ($1 = '' OR username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+		AND ($2 = '' OR role = $2)
+		AND ($3::BOOLEAN IS NULL OR (disabled_at IS NOT NULL) = $3)
+		ORDER BY id
+		LIMIT $4 OFFSET $5
+	`
+
+	rows, err := s.db.Query(query, filter.Query, filter.Role, filter.Disabled, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		err = rows.Scan(
+			&total,
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Bio,
+			&user.Activated,
+			&user.Role,
+			&user.UnitSystem,
+			&user.MaxHeartRate,
+			&user.RestingHeartRate,
+			&user.DisabledAt,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (s *PostgresUserStore) SetUserDisabled(id int, disabled bool) error {
+	query := `
+		UPDATE users
+		SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) ELSE NULL END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
 	`
 
-	result, err := s.db.Exec(query, user.Username, user.Email, user.Bio, user.ID)
+	result, err := s.db.Exec(query, disabled, id)
 	if err != nil {
 		return err
 	}
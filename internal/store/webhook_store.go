@@ -0,0 +1,412 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// Events webhooks can subscribe to.
+const (
+	WebhookEventWorkoutCreated = "workout.created"
+	WebhookEventWorkoutUpdated = "workout.updated"
+	WebhookEventWorkoutDeleted = "workout.deleted"
+)
+
+var WebhookEventTypes = []string{WebhookEventWorkoutCreated, WebhookEventWorkoutUpdated, WebhookEventWorkoutDeleted}
+
+func ValidWebhookEvent(eventType string) bool {
+	for _, e := range WebhookEventTypes {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery statuses. A delivery stays pending while it has attempts left.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription that POSTs events to a URL. Webhooks registered
+// by an admin have no UserID and receive every user's events.
+type Webhook struct {
+	ID         int64     `json:"id"`
+	UserID     *int      `json:"user_id,omitempty"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"-"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int64                     `json:"id"`
+	WebhookID     int64                     `json:"webhook_id"`
+	EventType     string                    `json:"event_type"`
+	Payload       json.RawMessage           `json:"payload"`
+	Status        string                    `json:"status"`
+	Attempts      int                       `json:"attempts"`
+	NextAttemptAt *time.Time                `json:"next_attempt_at,omitempty"`
+	LastAttemptAt *time.Time                `json:"last_attempt_at,omitempty"`
+	CreatedAt     time.Time                 `json:"created_at"`
+	AttemptLog    []*WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt logs one try at delivering an event.
+type WebhookDeliveryAttempt struct {
+	ID             int64     `json:"id"`
+	DeliveryID     int64     `json:"-"`
+	ResponseStatus *int      `json:"response_status,omitempty"`
+	ResponseBody   *string   `json:"response_body,omitempty"`
+	Error          *string   `json:"error,omitempty"`
+	DurationMS     int       `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// PendingDelivery is a delivery claimed by a worker, with what it needs to
+// send it. Global is set for deliveries to webhooks registered by an admin.
+type PendingDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+	Global bool
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{
+		db: db,
+	}
+}
+
+type WebhookStore interface {
+	CreateWebhook(*Webhook) error
+	GetWebhook(id int64) (*Webhook, error)
+	ListWebhooks(userID *int) ([]*Webhook, error)
+	UpdateWebhook(*Webhook) error
+	DeleteWebhook(id int64) error
+	ListDeliveries(webhookID int64, page, pageSize int) ([]*WebhookDelivery, int, error)
+	GetDelivery(id int64) (*WebhookDelivery, error)
+	Redeliver(id int64) error
+	ClaimDueDeliveries(limit int, lease time.Duration) ([]*PendingDelivery, error)
+	CompleteAttempt(attempt *WebhookDeliveryAttempt, status string, nextAttemptAt *time.Time) error
+}
+
+// enqueueWebhookEvent queues a delivery of the event to every active webhook
+// subscribed to it that may see userID's data. It runs in the caller's
+// transaction so events are only sent for changes that were committed.
+func enqueueWebhookEvent(tx *sql.Tx, eventType string, userID int, data any) error {
+	payload, err := json.Marshal(map[string]any{
+		"event":       eventType,
+		"occurred_at": time.Now().UTC(),
+		"data":        data,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT id, $1, $2
+		FROM webhooks
+		WHERE active AND $1 = ANY(event_types) AND (user_id IS NULL OR user_id = $3)
+	`
+
+	_, err = tx.Exec(query, eventType, string(payload), userID)
+	return err
+}
+
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	webhook := &Webhook{}
+	var eventTypes pgtype.TextArray
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &eventTypes, &webhook.Secret, &webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = eventTypes.AssignTo(&webhook.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (pg *PostgresWebhookStore) CreateWebhook(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, event_types, secret, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	return pg.db.QueryRow(query, webhook.UserID, webhook.URL, webhook.EventTypes, webhook.Secret, webhook.Active).Scan(
+		&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt,
+	)
+}
+
+func (pg *PostgresWebhookStore) GetWebhook(id int64) (*Webhook, error) {
+	query := `
+		SELECT id, user_id, url, event_types, secret, active, created_at, updated_at
+		FROM webhooks
+		WHERE id = $1
+	`
+
+	webhook, err := scanWebhook(pg.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return webhook, err
+}
+
+// ListWebhooks returns the user's webhooks, or the admin-registered ones
+// when userID is nil.
+func (pg *PostgresWebhookStore) ListWebhooks(userID *int) ([]*Webhook, error) {
+	query := `
+		SELECT id, user_id, url, event_types, secret, active, created_at, updated_at
+		FROM webhooks
+		WHERE user_id IS NOT DISTINCT FROM $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (pg *PostgresWebhookStore) UpdateWebhook(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, event_types = $2, active = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING updated_at
+	`
+
+	return pg.db.QueryRow(query, webhook.URL, webhook.EventTypes, webhook.Active, webhook.ID).Scan(&webhook.UpdatedAt)
+}
+
+func (pg *PostgresWebhookStore) DeleteWebhook(id int64) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresWebhookStore) ListDeliveries(webhookID int64, page, pageSize int) ([]*WebhookDelivery, int, error) {
+	query := `
+		SELECT count(*) OVER(), id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := pg.db.Query(query, webhookID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		var payload []byte
+		err = rows.Scan(&total, &delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
+
+// GetDelivery returns a delivery with the log of its attempts.
+func (pg *PostgresWebhookStore) GetDelivery(id int64) (*WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, created_at
+		FROM webhook_deliveries
+		WHERE id = $1
+	`
+
+	delivery := &WebhookDelivery{}
+	var payload []byte
+	err := pg.db.QueryRow(query, id).Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+
+	attemptQuery := `
+		SELECT id, delivery_id, response_status, response_body, error, duration_ms, created_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := pg.db.Query(attemptQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = []*WebhookDeliveryAttempt{}
+	for rows.Next() {
+		attempt := &WebhookDeliveryAttempt{}
+		err = rows.Scan(&attempt.ID, &attempt.DeliveryID, &attempt.ResponseStatus, &attempt.ResponseBody, &attempt.Error, &attempt.DurationMS, &attempt.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+
+	return delivery, rows.Err()
+}
+
+// Redeliver queues a delivery to be sent again right away with a fresh set
+// of attempts. Earlier attempts stay in its log.
+func (pg *PostgresWebhookStore) Redeliver(id int64) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ClaimDueDeliveries picks up to limit pending deliveries that are due and
+// pushes their next attempt back by lease, so concurrent workers don't send
+// them twice. A worker that dies mid-delivery leaves them to be retried
+// once the lease runs out.
+func (pg *PostgresWebhookStore) ClaimDueDeliveries(limit int, lease time.Duration) ([]*PendingDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT d.id
+			FROM webhook_deliveries d
+			INNER JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND w.active
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret, w.user_id IS NULL
+	`
+
+	rows, err := pg.db.Query(query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*PendingDelivery{}
+	for rows.Next() {
+		delivery := &PendingDelivery{}
+		var payload []byte
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Status,
+			&delivery.Attempts, &delivery.CreatedAt, &delivery.URL, &delivery.Secret, &delivery.Global)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// CompleteAttempt logs an attempt and moves its delivery to status. Pending
+// deliveries are retried at nextAttemptAt.
+func (pg *PostgresWebhookStore) CompleteAttempt(attempt *WebhookDeliveryAttempt, status string, nextAttemptAt *time.Time) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_delivery_attempts (delivery_id, response_status, response_body, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(query, attempt.DeliveryID, attempt.ResponseStatus, attempt.ResponseBody, attempt.Error, attempt.DurationMS).Scan(&attempt.ID, &attempt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, last_attempt_at = CURRENT_TIMESTAMP, next_attempt_at = $2
+		WHERE id = $3
+	`, status, nextAttemptAt, attempt.DeliveryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
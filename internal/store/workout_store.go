@@ -1,36 +1,162 @@
 package store
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base32"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+)
+
+// ErrDuplicateWorkout is returned when the user already has a workout that
+// started at the same time, such as an activity file imported twice.
+var ErrDuplicateWorkout = errors.New("a workout starting at this time already exists")
+
+const (
+	VisibilityPrivate   = "private"
+	VisibilityFollowers = "followers"
+	VisibilityPublic    = "public"
 )
 
+func ValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityFollowers, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// Activities a distance entry can record.
+const (
+	ActivityRun  = "run"
+	ActivityRide = "ride"
+	ActivityRow  = "row"
+	ActivitySwim = "swim"
+	ActivityWalk = "walk"
+	ActivityHike = "hike"
+)
+
+func ValidActivity(activity string) bool {
+	switch activity {
+	case ActivityRun, ActivityRide, ActivityRow, ActivitySwim, ActivityWalk, ActivityHike:
+		return true
+	}
+	return false
+}
+
 type Workout struct {
-	ID              int            `json:"id"`
-	UserID          int            `json:"user_id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description,omitempty"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  *int           `json:"calories_burned,omitempty"`
-	Entries         []WorkoutEntry `json:"entries,omitempty"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
+	ID                int            `json:"id"`
+	UserID            int            `json:"user_id"`
+	Title             string         `json:"title"`
+	Description       string         `json:"description,omitempty"`
+	DurationMinutes   int            `json:"duration_minutes"`
+	CaloriesBurned    *int           `json:"calories_burned,omitempty"`
+	CaloriesEstimated bool           `json:"calories_estimated"`
+	Visibility        string         `json:"visibility"`
+	ShareSlug         *string        `json:"share_slug,omitempty"`
+	AssignedBy        *int           `json:"assigned_by,omitempty"`
+	StartedAt         *time.Time     `json:"started_at,omitempty"`
+	Entries           []WorkoutEntry `json:"entries,omitempty"`
+	Volume            *float64       `json:"volume,omitempty"`
+	CommentCount      int            `json:"comment_count"`
+	ReactionCounts    map[string]int `json:"reaction_counts"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	HeartRateMetrics
+}
+
+// FeedWorkout is a workout as it appears in a follower's feed.
+type FeedWorkout struct {
+	Workout
+	Username string `json:"username"`
 }
 
+// prepareSharing defaults the visibility and keeps the public link in step
+// with it: a public workout gets an unguessable slug the first time it's
+// shared, and making it non-public again kills the old link.
+func prepareSharing(workout *Workout) error {
+	if workout.Visibility == "" {
+		workout.Visibility = VisibilityPrivate
+	}
+
+	if workout.Visibility != VisibilityPublic {
+		workout.ShareSlug = nil
+		return nil
+	}
+	if workout.ShareSlug != nil {
+		return nil
+	}
+
+	randomBytes := make([]byte, 15)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	slug := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	workout.ShareSlug = &slug
+	return nil
+}
+
+// WorkoutEntry is one exercise of a workout. Weight is stored in kilograms,
+// distance in kilometres and elevation gain in metres; handlers convert them
+// to and from the caller's units and set the unit fields. Pace and Speed are
+// never stored: they're derived from distance and duration when the entry
+// is presented.
 type WorkoutEntry struct {
 	ID              int       `json:"id"`
 	ExerciseName    string    `json:"exercise_name"`
+	Activity        *string   `json:"activity,omitempty"`
 	Sets            int       `json:"sets"`
 	Reps            *int      `json:"reps,omitempty"`
 	DurationSeconds *int      `json:"duration_seconds,omitempty"`
 	Weight          *float64  `json:"weight,omitempty"`
+	WeightUnit      string    `json:"weight_unit,omitempty"`
+	Distance        *float64  `json:"distance,omitempty"`
+	DistanceUnit    string    `json:"distance_unit,omitempty"`
+	ElevationGain   *float64  `json:"elevation_gain,omitempty"`
+	ElevationUnit   string    `json:"elevation_unit,omitempty"`
+	AvgHeartRate    *int      `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate    *int      `json:"max_heart_rate,omitempty"`
+	RPE             *float64  `json:"rpe,omitempty"`
+	Pace            *float64  `json:"pace,omitempty"`
+	Speed           *float64  `json:"speed,omitempty"`
+	Splits          []Split   `json:"splits,omitempty"`
 	Notes           *string   `json:"notes,omitempty"`
 	OrderIndex      int       `json:"order_index"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
 
+// Split is one lap or segment of a distance entry, in the same units as
+// its entry.
+type Split struct {
+	Distance        float64  `json:"distance"`
+	DurationSeconds int      `json:"duration_seconds"`
+	ElevationGain   *float64 `json:"elevation_gain,omitempty"`
+	AvgHeartRate    *int     `json:"avg_heart_rate,omitempty"`
+	Pace            *float64 `json:"pace,omitempty"`
+}
+
+// LoggedEntry is an entry along with the workout it was logged in.
+// LoggedAt is when the workout started, if known, or else when it was saved.
+type LoggedEntry struct {
+	WorkoutEntry
+	WorkoutID int       `json:"workout_id"`
+	LoggedAt  time.Time `json:"logged_at"`
+}
+
+// WeeklyDistance is the distance covered in the week starting on Monday
+// WeekStart (UTC), in kilometres.
+type WeeklyDistance struct {
+	WeekStart  time.Time `json:"week_start"`
+	DistanceKm float64   `json:"distance_km"`
+}
+
 type PostgressWorkoutStore struct {
 	db *sql.DB
 }
@@ -46,9 +172,24 @@ type WorkoutStore interface {
 	UpdateWorkout(*Workout) error
 	DeleteWorkoutByID(int64) error
 	DeleteWorkoutByIDAndUserID(workoutID int64, userID int) error
+	GetWorkoutByShareSlug(slug string) (*Workout, error)
+	ListFeed(userID int, page, pageSize int) ([]*FeedWorkout, int, error)
+	ListWorkoutsByUserID(userID int, page, pageSize int) ([]*Workout, int, error)
+	GetPersonalBests(userID int, excludeWorkoutID int) (map[string]float64, error)
+	ListTrainingDays(userID int, since time.Time) ([]time.Time, error)
+	ListWeeklyDistance(userID int, activity string, since time.Time) ([]WeeklyDistance, error)
+	ListCardioEntries(userID int, activity string, minDistanceKm float64) ([]*LoggedEntry, error)
+	GetFirstWorkoutTime(userID int) (*time.Time, error)
+	ListWorkoutsBetween(userID int, from, to time.Time) ([]*Workout, error)
+	ListExerciseHistory(userID int, exerciseName string, limit int) ([]*LoggedEntry, error)
 }
 
 func (pg *PostgressWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
+	err := prepareSharing(workout)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return nil, err
@@ -56,27 +197,34 @@ func (pg *PostgressWorkoutStore) CreateWorkout(workout *Workout) (*Workout, erro
 	defer tx.Rollback()
 
 	query := `
-		INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, calories_estimated, visibility, share_slug, assigned_by, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, updated_at
 	`
 
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt)
+	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated, workout.Visibility, workout.ShareSlug, workout.AssignedBy, workout.StartedAt).Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt)
+	if err != nil {
+		return nil, duplicateWorkoutError(err)
+	}
+
+	err = insertEntries(tx, workout)
 	if err != nil {
 		return nil, err
 	}
 
-	for i := range workout.Entries {
-		entry := &workout.Entries[i]
-		query := `
-			INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id
-		`
-		err = tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
-		if err != nil {
-			return nil, err
-		}
+	err = invalidateTrainingLoad(tx, workout.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enqueueWebhookEvent(tx, WebhookEventWorkoutCreated, workout.UserID, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enqueueWorkoutSaved(tx, workout.ID, true)
+	if err != nil {
+		return nil, err
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -89,22 +237,30 @@ func (pg *PostgressWorkoutStore) CreateWorkout(workout *Workout) (*Workout, erro
 func (pg *PostgressWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 	workout := &Workout{}
 	query := `
-	SELECT id, user_id, title, description, duration_minutes, calories_burned, created_at, updated_at
+	SELECT id, user_id, title, description, duration_minutes, calories_burned, calories_estimated, visibility, share_slug, assigned_by, started_at,
+		avg_heart_rate, max_heart_rate, hr_zone_seconds, trimp, created_at, updated_at
 	FROM workouts
 	WHERE id=$1
 	`
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CreatedAt, &workout.UpdatedAt)
+	var zoneSeconds pgtype.Int4Array
+	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CaloriesEstimated, &workout.Visibility, &workout.ShareSlug, &workout.AssignedBy, &workout.StartedAt,
+		&workout.AvgHeartRate, &workout.MaxHeartRate, &zoneSeconds, &workout.TRIMP, &workout.CreatedAt, &workout.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 
+	if err != nil {
+		return nil, err
+	}
+	err = zoneSeconds.AssignTo(&workout.HRZoneSeconds)
 	if err != nil {
 		return nil, err
 	}
 
 	entryQuery := `
-  SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+  SELECT id, exercise_name, activity, sets, reps, duration_seconds, weight_kg,
+    distance_km, elevation_gain_m, avg_heart_rate, max_heart_rate, rpe, notes, order_index
   FROM workout_entries
   WHERE workout_id = $1
   ORDER BY order_index
@@ -122,10 +278,16 @@ func (pg *PostgressWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 		err = rows.Scan(
 			&entry.ID,
 			&entry.ExerciseName,
+			&entry.Activity,
 			&entry.Sets,
 			&entry.Reps,
 			&entry.DurationSeconds,
 			&entry.Weight,
+			&entry.Distance,
+			&entry.ElevationGain,
+			&entry.AvgHeartRate,
+			&entry.MaxHeartRate,
+			&entry.RPE,
 			&entry.Notes,
 			&entry.OrderIndex,
 		)
@@ -134,6 +296,19 @@ func (pg *PostgressWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 		}
 		workout.Entries = append(workout.Entries, entry)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.attachSplits([]*Workout{workout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.attachCounts([]*Workout{workout})
+	if err != nil {
+		return nil, err
+	}
 
 	return workout, nil
 }
@@ -141,22 +316,30 @@ func (pg *PostgressWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 func (pg *PostgressWorkoutStore) GetWorkoutByIDAndUserID(workoutID int64, userID int) (*Workout, error) {
 	workout := &Workout{}
 	query := `
-	SELECT id, user_id, title, description, duration_minutes, calories_burned, created_at, updated_at
+	SELECT id, user_id, title, description, duration_minutes, calories_burned, calories_estimated, visibility, share_slug, assigned_by, started_at,
+		avg_heart_rate, max_heart_rate, hr_zone_seconds, trimp, created_at, updated_at
 	FROM workouts
 	WHERE id=$1 AND user_id=$2
 	`
-	err := pg.db.QueryRow(query, workoutID, userID).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CreatedAt, &workout.UpdatedAt)
+	var zoneSeconds pgtype.Int4Array
+	err := pg.db.QueryRow(query, workoutID, userID).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CaloriesEstimated, &workout.Visibility, &workout.ShareSlug, &workout.AssignedBy, &workout.StartedAt,
+		&workout.AvgHeartRate, &workout.MaxHeartRate, &zoneSeconds, &workout.TRIMP, &workout.CreatedAt, &workout.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 
+	if err != nil {
+		return nil, err
+	}
+	err = zoneSeconds.AssignTo(&workout.HRZoneSeconds)
 	if err != nil {
 		return nil, err
 	}
 
 	entryQuery := `
-  SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, created_at, updated_at
+  SELECT id, exercise_name, activity, sets, reps, duration_seconds, weight_kg,
+    distance_km, elevation_gain_m, avg_heart_rate, max_heart_rate, rpe, notes, order_index, created_at, updated_at
   FROM workout_entries
   WHERE workout_id = $1
   ORDER BY order_index
@@ -173,10 +356,16 @@ func (pg *PostgressWorkoutStore) GetWorkoutByIDAndUserID(workoutID int64, userID
 		err = rows.Scan(
 			&entry.ID,
 			&entry.ExerciseName,
+			&entry.Activity,
 			&entry.Sets,
 			&entry.Reps,
 			&entry.DurationSeconds,
 			&entry.Weight,
+			&entry.Distance,
+			&entry.ElevationGain,
+			&entry.AvgHeartRate,
+			&entry.MaxHeartRate,
+			&entry.RPE,
 			&entry.Notes,
 			&entry.OrderIndex,
 			&entry.CreatedAt,
@@ -187,26 +376,46 @@ func (pg *PostgressWorkoutStore) GetWorkoutByIDAndUserID(workoutID int64, userID
 		}
 		workout.Entries = append(workout.Entries, entry)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.attachSplits([]*Workout{workout})
+	if err != nil {
+		return nil, err
+	}
 
 	return workout, nil
 }
 
 func (pg *PostgressWorkoutStore) UpdateWorkout(workout *Workout) error {
+	err := prepareSharing(workout)
+	if err != nil {
+		return err
+	}
+
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
+
+	// Both the day the workout was on and the day it's moved to
+	err = invalidateTrainingLoad(tx, workout.ID)
+	if err != nil {
+		return err
+	}
+
 	query :=
 		`
-		UPDATE workouts SET title=$1, description=$2, duration_minutes=$3, calories_burned=$4
-		WHERE id=$5
+		UPDATE workouts SET title=$1, description=$2, duration_minutes=$3, calories_burned=$4, calories_estimated=$5, visibility=$6, share_slug=$7, started_at=$8
+		WHERE id=$9
 	
 	`
 	//we use exec when we are doing put/patch/delete or when we are not returning anything
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated, workout.Visibility, workout.ShareSlug, workout.StartedAt, workout.ID)
 	if err != nil {
-		return err
+		return duplicateWorkoutError(err)
 	}
 	rowsAffected, err := result.RowsAffected()
 
@@ -222,70 +431,646 @@ func (pg *PostgressWorkoutStore) UpdateWorkout(workout *Workout) error {
 	if err != nil {
 		return err
 	}
-	for _, entry := range workout.Entries {
-		query := `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
+	err = insertEntries(tx, workout)
+	if err != nil {
+		return err
+	}
 
-		_, err := tx.Exec(query,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
-		)
+	err = invalidateTrainingLoad(tx, workout.ID)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
-		}
+	err = enqueueWebhookEvent(tx, WebhookEventWorkoutUpdated, workout.UserID, workout)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueWorkoutSaved(tx, workout.ID, false)
+	if err != nil {
+		return err
 	}
 
 	return tx.Commit()
 
 }
 
+// duplicateWorkoutError translates a clash of start times into
+// ErrDuplicateWorkout.
+func duplicateWorkoutError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_workouts_user_id_started_at" {
+		return ErrDuplicateWorkout
+	}
+	return err
+}
+
+// insertEntries saves the entries of a workout, and their splits.
+func insertEntries(tx *sql.Tx, workout *Workout) error {
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		query := `
+			INSERT INTO workout_entries (workout_id, exercise_name, activity, sets, reps, duration_seconds, weight_kg,
+				distance_km, elevation_gain_m, avg_heart_rate, max_heart_rate, rpe, notes, order_index)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id
+		`
+		err := tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Activity, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight,
+			entry.Distance, entry.ElevationGain, entry.AvgHeartRate, entry.MaxHeartRate, entry.RPE, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+
+		for j, split := range entry.Splits {
+			query := `
+				INSERT INTO workout_entry_splits (entry_id, split_index, distance_km, duration_seconds, elevation_gain_m, avg_heart_rate)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`
+			_, err = tx.Exec(query, entry.ID, j, split.Distance, split.DurationSeconds, split.ElevationGain, split.AvgHeartRate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (pg *PostgressWorkoutStore) DeleteWorkoutByID(id int64) error {
 	query := `
   DELETE from workouts
   WHERE id = $1
+  RETURNING user_id
   `
 
-	result, err := pg.db.Exec(query, id)
+	return pg.deleteWorkout(id, query, id)
+}
+
+func (pg *PostgressWorkoutStore) DeleteWorkoutByIDAndUserID(workoutID int64, userID int) error {
+	query := `
+  DELETE from workouts
+  WHERE id = $1 AND user_id = $2
+  RETURNING user_id
+  `
+
+	return pg.deleteWorkout(workoutID, query, workoutID, userID)
+}
+
+// deleteWorkout runs a delete query returning the owner's id and queues the
+// workout.deleted event in the same transaction.
+func (pg *PostgressWorkoutStore) deleteWorkout(workoutID int64, query string, args ...any) error {
+	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	defer tx.Rollback()
+
+	// Undone with the rest when there's no such workout
+	err = invalidateTrainingLoad(tx, int(workoutID))
+	if err != nil {
+		return err
 	}
+
+	var userID int
+	err = tx.QueryRow(query, args...).Scan(&userID)
 	if err != nil {
+		// sql.ErrNoRows when nothing was deleted
 		return err
 	}
 
-	return nil
+	err = enqueueWebhookEvent(tx, WebhookEventWorkoutDeleted, userID, map[string]any{"id": workoutID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (pg *PostgressWorkoutStore) DeleteWorkoutByIDAndUserID(workoutID int64, userID int) error {
+// WorkoutSavedPayload is the payload of JobWorkoutSaved jobs.
+type WorkoutSavedPayload struct {
+	WorkoutID int  `json:"workout_id"`
+	Created   bool `json:"created"`
+}
+
+// enqueueWorkoutSaved queues the follow-up work of a saved workout in the
+// transaction that saved it.
+func enqueueWorkoutSaved(tx *sql.Tx, workoutID int, created bool) error {
+	job, err := NewJob(JobWorkoutSaved, WorkoutSavedPayload{WorkoutID: workoutID, Created: created})
+	if err != nil {
+		return err
+	}
+	return EnqueueJob(tx, job)
+}
+
+// GetWorkoutByShareSlug returns the public workout behind a share link.
+func (pg *PostgressWorkoutStore) GetWorkoutByShareSlug(slug string) (*Workout, error) {
+	var workoutID int64
 	query := `
-  DELETE from workouts
-  WHERE id = $1 AND user_id = $2
-  `
+	SELECT id
+	FROM workouts
+	WHERE share_slug = $1 AND visibility = 'public'
+	`
+	err := pg.db.QueryRow(query, slug).Scan(&workoutID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.GetWorkoutByID(workoutID)
+}
+
+// ListFeed returns the newest workouts shared by the users who approved
+// userID following them, with their entries.
+func (pg *PostgressWorkoutStore) ListFeed(userID int, page, pageSize int) ([]*FeedWorkout, int, error) {
+	query := `
+	SELECT count(*) OVER(), w.id, w.user_id, u.username, w.title, w.description, w.duration_minutes, w.calories_burned, w.calories_estimated,
+		w.visibility, w.share_slug, w.assigned_by, w.started_at, w.avg_heart_rate, w.max_heart_rate, w.hr_zone_seconds, w.trimp,
+		w.created_at, w.updated_at
+	FROM workouts w
+	INNER JOIN follows f ON f.followee_id = w.user_id AND f.follower_id = $1 AND f.approved_at IS NOT NULL
+	INNER JOIN users u ON u.id = w.user_id
+	WHERE w.visibility IN ('followers', 'public') AND u.disabled_at IS NULL
+	ORDER BY w.created_at DESC, w.id DESC
+	LIMIT $2 OFFSET $3
+	`
+
+	rows, err := pg.db.Query(query, userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	workouts := []*FeedWorkout{}
+	for rows.Next() {
+		workout := &FeedWorkout{}
+		var zoneSeconds pgtype.Int4Array
+		err = rows.Scan(&total, &workout.ID, &workout.UserID, &workout.Username, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CaloriesEstimated,
+			&workout.Visibility, &workout.ShareSlug, &workout.AssignedBy, &workout.StartedAt, &workout.AvgHeartRate, &workout.MaxHeartRate, &zoneSeconds, &workout.TRIMP,
+			&workout.CreatedAt, &workout.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		err = zoneSeconds.AssignTo(&workout.HRZoneSeconds)
+		if err != nil {
+			return nil, 0, err
+		}
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
 
-	result, err := pg.db.Exec(query, workoutID, userID)
+	list := make([]*Workout, len(workouts))
+	for i := range workouts {
+		list[i] = &workouts[i].Workout
+	}
+	err = pg.attachEntries(list)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = pg.attachCounts(list)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return workouts, total, nil
+}
+
+// ListWorkoutsByUserID returns a user's workouts, newest first, with their entries.
+func (pg *PostgressWorkoutStore) ListWorkoutsByUserID(userID int, page, pageSize int) ([]*Workout, int, error) {
+	query := `
+	SELECT count(*) OVER(), id, user_id, title, description, duration_minutes, calories_burned, calories_estimated, visibility, share_slug, assigned_by, started_at,
+		avg_heart_rate, max_heart_rate, hr_zone_seconds, trimp, created_at, updated_at
+	FROM workouts
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2 OFFSET $3
+	`
+
+	rows, err := pg.db.Query(query, userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	workouts := []*Workout{}
+	for rows.Next() {
+		workout := &Workout{}
+		var zoneSeconds pgtype.Int4Array
+		err = rows.Scan(&total, &workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.CaloriesEstimated,
+			&workout.Visibility, &workout.ShareSlug, &workout.AssignedBy, &workout.StartedAt, &workout.AvgHeartRate, &workout.MaxHeartRate, &zoneSeconds, &workout.TRIMP,
+			&workout.CreatedAt, &workout.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		err = zoneSeconds.AssignTo(&workout.HRZoneSeconds)
+		if err != nil {
+			return nil, 0, err
+		}
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	err = pg.attachEntries(workouts)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = pg.attachCounts(workouts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return workouts, total, nil
+}
+
+// attachEntries loads the entries of several workouts with one query.
+func (pg *PostgressWorkoutStore) attachEntries(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Workout, len(workouts))
+	ids := make([]int64, 0, len(workouts))
+	for _, workout := range workouts {
+		byID[workout.ID] = workout
+		ids = append(ids, int64(workout.ID))
+	}
+
+	entryQuery := `
+	SELECT workout_id, id, exercise_name, activity, sets, reps, duration_seconds, weight_kg,
+		distance_km, elevation_gain_m, avg_heart_rate, max_heart_rate, rpe, notes, order_index, created_at
+	FROM workout_entries
+	WHERE workout_id = ANY($1)
+	ORDER BY workout_id, order_index
+	`
+
+	rows, err := pg.db.Query(entryQuery, ids)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		err = rows.Scan(&workoutID, &entry.ID, &entry.ExerciseName, &entry.Activity, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight,
+			&entry.Distance, &entry.ElevationGain, &entry.AvgHeartRate, &entry.MaxHeartRate, &entry.RPE, &entry.Notes, &entry.OrderIndex, &entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+		byID[workoutID].Entries = append(byID[workoutID].Entries, entry)
 	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return pg.attachSplits(workouts)
+}
+
+// attachSplits loads the splits of the distance entries of several workouts.
+func (pg *PostgressWorkoutStore) attachSplits(workouts []*Workout) error {
+	entries := []*WorkoutEntry{}
+	for _, workout := range workouts {
+		for i := range workout.Entries {
+			entries = append(entries, &workout.Entries[i])
+		}
+	}
+	return pg.attachEntrySplits(entries)
+}
+
+// attachEntrySplits loads the splits of several entries with one query.
+func (pg *PostgressWorkoutStore) attachEntrySplits(entries []*WorkoutEntry) error {
+	byID := make(map[int]*WorkoutEntry, len(entries))
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Distance == nil {
+			continue
+		}
+		byID[entry.ID] = entry
+		ids = append(ids, int64(entry.ID))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT entry_id, distance_km, duration_seconds, elevation_gain_m, avg_heart_rate
+	FROM workout_entry_splits
+	WHERE entry_id = ANY($1)
+	ORDER BY entry_id, split_index
+	`
+
+	rows, err := pg.db.Query(query, ids)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		var entryID int
+		var split Split
+		err = rows.Scan(&entryID, &split.Distance, &split.DurationSeconds, &split.ElevationGain, &split.AvgHeartRate)
+		if err != nil {
+			return err
+		}
+		byID[entryID].Splits = append(byID[entryID].Splits, split)
+	}
+
+	return rows.Err()
+}
+
+// attachCounts loads the comment and reaction counts of several workouts.
+func (pg *PostgressWorkoutStore) attachCounts(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Workout, len(workouts))
+	ids := make([]int64, 0, len(workouts))
+	for _, workout := range workouts {
+		workout.ReactionCounts = map[string]int{}
+		byID[workout.ID] = workout
+		ids = append(ids, int64(workout.ID))
+	}
+
+	commentQuery := `
+	SELECT workout_id, count(*)
+	FROM workout_comments
+	WHERE workout_id = ANY($1)
+	GROUP BY workout_id
+	`
+
+	rows, err := pg.db.Query(commentQuery, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID, count int
+		err = rows.Scan(&workoutID, &count)
+		if err != nil {
+			return err
+		}
+		byID[workoutID].CommentCount = count
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	reactionQuery := `
+	SELECT workout_id, reaction, count(*)
+	FROM workout_reactions
+	WHERE workout_id = ANY($1)
+	GROUP BY workout_id, reaction
+	`
+
+	reactionRows, err := pg.db.Query(reactionQuery, ids)
+	if err != nil {
+		return err
+	}
+	defer reactionRows.Close()
+
+	for reactionRows.Next() {
+		var workoutID, count int
+		var reaction string
+		err = reactionRows.Scan(&workoutID, &reaction, &count)
+		if err != nil {
+			return err
+		}
+		byID[workoutID].ReactionCounts[reaction] = count
+	}
+
+	return reactionRows.Err()
+}
+
+// GetPersonalBests returns the heaviest weight the user has logged for each
+// exercise, leaving out one workout so it can be compared against the rest.
+func (pg *PostgressWorkoutStore) GetPersonalBests(userID int, excludeWorkoutID int) (map[string]float64, error) {
+	query := `
+	SELECT lower(e.exercise_name), max(e.weight_kg)
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	WHERE w.user_id = $1 AND w.id <> $2 AND e.weight_kg IS NOT NULL
+	GROUP BY lower(e.exercise_name)
+	`
+
+	rows, err := pg.db.Query(query, userID, excludeWorkoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bests := map[string]float64{}
+	for rows.Next() {
+		var exercise string
+		var weight float64
+		err = rows.Scan(&exercise, &weight)
+		if err != nil {
+			return nil, err
+		}
+		bests[exercise] = weight
+	}
+
+	return bests, rows.Err()
+}
+
+// ListTrainingDays returns the distinct UTC days since the given time on
+// which the user logged a workout, most recent first.
+func (pg *PostgressWorkoutStore) ListTrainingDays(userID int, since time.Time) ([]time.Time, error) {
+	query := `
+	SELECT DISTINCT (created_at AT TIME ZONE 'UTC')::date AS day
+	FROM workouts
+	WHERE user_id = $1 AND created_at >= $2
+	ORDER BY day DESC
+	`
+
+	rows, err := pg.db.Query(query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []time.Time{}
+	for rows.Next() {
+		var day time.Time
+		err = rows.Scan(&day)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
+
+// ListWeeklyDistance returns the distance the user covered in each week
+// since the given time, oldest first, including weeks without any. An empty
+// activity counts every distance entry.
+func (pg *PostgressWorkoutStore) ListWeeklyDistance(userID int, activity string, since time.Time) ([]WeeklyDistance, error) {
+	query := `
+	SELECT weeks.week_start, COALESCE(sum(e.distance_km), 0)
+	FROM generate_series(
+		date_trunc('week', $3::timestamptz AT TIME ZONE 'UTC'),
+		date_trunc('week', now() AT TIME ZONE 'UTC'),
+		interval '1 week'
+	) AS weeks(week_start)
+	LEFT JOIN workouts w ON w.user_id = $1 AND date_trunc('week', COALESCE(w.started_at, w.created_at) AT TIME ZONE 'UTC') = weeks.week_start
+	LEFT JOIN workout_entries e ON e.workout_id = w.id AND e.distance_km IS NOT NULL AND ($2 = '' OR e.activity = $2)
+	GROUP BY weeks.week_start
+	ORDER BY weeks.week_start
+	`
+
+	rows, err := pg.db.Query(query, userID, activity, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weeks := []WeeklyDistance{}
+	for rows.Next() {
+		var week WeeklyDistance
+		err = rows.Scan(&week.WeekStart, &week.DistanceKm)
+		if err != nil {
+			return nil, err
+		}
+		weeks = append(weeks, week)
+	}
+
+	return weeks, rows.Err()
+}
+
+// ListCardioEntries returns the user's entries of an activity covering at
+// least minDistanceKm, with their splits, oldest first.
+func (pg *PostgressWorkoutStore) ListCardioEntries(userID int, activity string, minDistanceKm float64) ([]*LoggedEntry, error) {
+	query := `
+	SELECT w.id, COALESCE(w.started_at, w.created_at), e.id, e.exercise_name, e.activity, e.sets, e.duration_seconds,
+		e.distance_km, e.elevation_gain_m, e.avg_heart_rate, e.max_heart_rate, e.order_index
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	WHERE w.user_id = $1 AND e.activity = $2 AND e.distance_km >= $3
+	ORDER BY COALESCE(w.started_at, w.created_at), e.order_index
+	`
+
+	rows, err := pg.db.Query(query, userID, activity, minDistanceKm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*LoggedEntry{}
+	for rows.Next() {
+		entry := &LoggedEntry{}
+		err = rows.Scan(&entry.WorkoutID, &entry.LoggedAt, &entry.ID, &entry.ExerciseName, &entry.Activity, &entry.Sets, &entry.DurationSeconds,
+			&entry.Distance, &entry.ElevationGain, &entry.AvgHeartRate, &entry.MaxHeartRate, &entry.OrderIndex)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*WorkoutEntry, len(list))
+	for i, entry := range list {
+		entries[i] = &entry.WorkoutEntry
+	}
+	err = pg.attachEntrySplits(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetFirstWorkoutTime returns when the user's first workout started, if
+// known, or else when it was saved, or nil if they have none.
+func (pg *PostgressWorkoutStore) GetFirstWorkoutTime(userID int) (*time.Time, error) {
+	var first *time.Time
+	err := pg.db.QueryRow(`SELECT min(COALESCE(started_at, created_at)) FROM workouts WHERE user_id = $1`, userID).Scan(&first)
+	if err != nil {
+		return nil, err
+	}
+	return first, nil
+}
+
+// ListWorkoutsBetween returns the user's workouts that started, or were
+// saved when the start isn't known, from from up to but not including to,
+// oldest first, with their entries. Only the fields needed to work out
+// their training load are filled in.
+func (pg *PostgressWorkoutStore) ListWorkoutsBetween(userID int, from, to time.Time) ([]*Workout, error) {
+	query := `
+	SELECT id, user_id, duration_minutes, started_at, created_at
+	FROM workouts
+	WHERE user_id = $1 AND COALESCE(started_at, created_at) >= $2 AND COALESCE(started_at, created_at) < $3
+	ORDER BY COALESCE(started_at, created_at), id
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []*Workout{}
+	for rows.Next() {
+		workout := &Workout{}
+		err = rows.Scan(&workout.ID, &workout.UserID, &workout.DurationMinutes, &workout.StartedAt, &workout.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.attachEntries(workouts)
+	if err != nil {
+		return nil, err
+	}
+	return workouts, nil
+}
+
+// ListExerciseHistory returns the user's entries of an exercise done for
+// reps in their most recent workouts, matching its name whatever the case,
+// newest first. Only the heaviest entry of each workout is kept, so that
+// back-off sets don't hide the top set.
+func (pg *PostgressWorkoutStore) ListExerciseHistory(userID int, exerciseName string, limit int) ([]*LoggedEntry, error) {
+	query := `
+	SELECT * FROM (
+		SELECT DISTINCT ON (w.id) w.id, COALESCE(w.started_at, w.created_at) AS logged_at, e.id, e.exercise_name,
+			e.sets, e.reps, e.weight_kg, e.rpe, e.order_index
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = $1 AND lower(e.exercise_name) = lower($2) AND e.reps IS NOT NULL
+		ORDER BY w.id, e.weight_kg DESC NULLS LAST, e.order_index
+	) top_entries
+	ORDER BY logged_at DESC
+	LIMIT $3
+	`
+
+	rows, err := pg.db.Query(query, userID, exerciseName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*LoggedEntry{}
+	for rows.Next() {
+		entry := &LoggedEntry{}
+		err = rows.Scan(&entry.WorkoutID, &entry.LoggedAt, &entry.ID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.Weight, &entry.RPE, &entry.OrderIndex)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+
+	return list, rows.Err()
 }
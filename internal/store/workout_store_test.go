@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"testing"
 
+	// Registers the Go migrations alongside the SQL files
+	_ "github.com/LikhithMar14/workout-tracker/migrations"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
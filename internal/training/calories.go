@@ -0,0 +1,185 @@
+package training
+
+import (
+	"math"
+	"strings"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// MET values from the Compendium of Physical Activities for the parts of a
+// workout that aren't covered by ResistanceTrainingMET.
+const (
+	// CompoundLiftMET is for heavy multi-joint lifts such as squats and
+	// deadlifts.
+	CompoundLiftMET = 6.0
+	// IsolationLiftMET is for single-joint exercises such as curls.
+	IsolationLiftMET = 3.5
+	// CalisthenicsMET is for timed exercises without a cardio activity,
+	// such as planks and wall sits.
+	CalisthenicsMET = 3.8
+	// LightActivityMET is for the time in a cardio workout not spent on
+	// any entry: warming up, stretching, resting.
+	LightActivityMET = 2.5
+)
+
+// secondsPerSet is how long a set of a strength exercise takes with the
+// rest after it, used when the workout's duration doesn't say.
+const secondsPerSet = 120
+
+// activityMETs are for cardio activities at a moderate effort, used when
+// the entry has no distance to work out its speed.
+var activityMETs = map[string]float64{
+	store.ActivityRun:  9.8,
+	store.ActivityRide: 7.5,
+	store.ActivityRow:  7.0,
+	store.ActivitySwim: 7.0,
+	store.ActivityWalk: 3.5,
+	store.ActivityHike: 6.0,
+}
+
+// speedMET is a MET value for the pace speedKmh starts at.
+type speedMET struct {
+	speedKmh float64
+	met      float64
+}
+
+// speedMETs grade rides and walks by speed, slowest first.
+var speedMETs = map[string][]speedMET{
+	store.ActivityRide: {{0, 4.0}, {16, 6.8}, {19, 8.0}, {22, 10.0}, {25, 12.0}, {30, 15.8}},
+	store.ActivityWalk: {{0, 2.8}, {4, 3.5}, {5.5, 4.3}, {6.5, 5.0}},
+}
+
+// Running costs close to one MET per km/h across the range of paces.
+const (
+	minRunningMET = 6.0
+	maxRunningMET = 19.0
+)
+
+var (
+	compoundLifts  = []string{"squat", "deadlift", "clean", "snatch", "jerk", "thruster", "lunge", "press", "row", "pull up", "pull-up", "chin up", "chin-up", "dip"}
+	isolationLifts = []string{"curl", "raise", "extension", "fly", "flye", "kickback", "shrug", "calf"}
+)
+
+// ActivityMET returns the MET value of a cardio activity done at speedKmh,
+// or at a moderate effort when speedKmh is 0.
+func ActivityMET(activity string, speedKmh float64) float64 {
+	if speedKmh > 0 {
+		if activity == store.ActivityRun {
+			return min(max(speedKmh, minRunningMET), maxRunningMET)
+		}
+		if grades, ok := speedMETs[activity]; ok {
+			met := grades[0].met
+			for _, grade := range grades {
+				if speedKmh >= grade.speedKmh {
+					met = grade.met
+				}
+			}
+			return met
+		}
+	}
+	if met, ok := activityMETs[activity]; ok {
+		return met
+	}
+	return ResistanceTrainingMET
+}
+
+// ExerciseMET returns the MET value of a strength exercise, going by its
+// name. Isolation is checked first, so a "leg extension" isn't a press.
+func ExerciseMET(exerciseName string) float64 {
+	name := strings.ToLower(exerciseName)
+	for _, keyword := range isolationLifts {
+		if strings.Contains(name, keyword) {
+			return IsolationLiftMET
+		}
+	}
+	for _, keyword := range compoundLifts {
+		if strings.Contains(name, keyword) {
+			return CompoundLiftMET
+		}
+	}
+	return ResistanceTrainingMET
+}
+
+// entrySeconds splits the time of a workout between its entries. Cardio
+// entries take their duration and other timed entries sets × duration.
+// Strength entries share the rest of the workout's duration by their number
+// of sets, or take secondsPerSet for each set when there's none left. The
+// time not given to any entry is returned as well; there's only any when
+// the workout has no strength entries.
+func entrySeconds(workout *store.Workout) ([]float64, float64) {
+	seconds := make([]float64, len(workout.Entries))
+	timedSeconds, strengthSets := 0.0, 0
+	for i, entry := range workout.Entries {
+		switch {
+		case entry.Activity != nil && entry.DurationSeconds != nil:
+			seconds[i] = float64(*entry.DurationSeconds)
+		case entry.DurationSeconds != nil:
+			seconds[i] = float64(entry.Sets * *entry.DurationSeconds)
+		default:
+			strengthSets += entry.Sets
+			continue
+		}
+		timedSeconds += seconds[i]
+	}
+
+	remaining := max(float64(workout.DurationMinutes*60)-timedSeconds, 0)
+	if strengthSets == 0 {
+		return seconds, remaining
+	}
+
+	secondsPerStrengthSet := float64(secondsPerSet)
+	if remaining > 0 {
+		secondsPerStrengthSet = remaining / float64(strengthSets)
+	}
+	for i, entry := range workout.Entries {
+		if entry.DurationSeconds == nil {
+			seconds[i] = secondsPerStrengthSet * float64(entry.Sets)
+		}
+	}
+	return seconds, 0
+}
+
+// EstimateWorkoutCalories estimates the calories burned by a workout,
+// summing MET × bodyweight in kg × hours over its entries, with their time
+// split as entrySeconds does:
+//
+//   - Cardio entries count at a MET for their activity and speed.
+//   - Other timed entries count at CalisthenicsMET.
+//   - Strength entries count from 80% to 120% of the exercise's MET as the
+//     weight lifted approaches bodyweight, so the same session burns more
+//     with a heavier load.
+//
+// Time in a workout with cardio but no strength entries is counted at
+// LightActivityMET, and a workout without entries is estimated with
+// EstimateCalories.
+func EstimateWorkoutCalories(workout *store.Workout, bodyweightKg float64) int {
+	if len(workout.Entries) == 0 {
+		return EstimateCalories(workout.DurationMinutes, bodyweightKg)
+	}
+
+	seconds, unassigned := entrySeconds(workout)
+	metSeconds := LightActivityMET * unassigned
+	for i, entry := range workout.Entries {
+		var met float64
+		switch {
+		case entry.Activity != nil && entry.DurationSeconds != nil:
+			speed := 0.0
+			if entry.Distance != nil {
+				speed = *entry.Distance / (float64(*entry.DurationSeconds) / 3600)
+			}
+			met = ActivityMET(*entry.Activity, speed)
+		case entry.DurationSeconds != nil:
+			met = CalisthenicsMET
+		default:
+			load := 1.0
+			if entry.Weight != nil && bodyweightKg > 0 {
+				load = min(*entry.Weight/bodyweightKg, 1)
+			}
+			met = ExerciseMET(entry.ExerciseName) * (0.8 + 0.4*load)
+		}
+		metSeconds += met * seconds[i]
+	}
+
+	return int(math.Round(metSeconds * bodyweightKg / 3600))
+}
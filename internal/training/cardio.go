@@ -0,0 +1,92 @@
+package training
+
+import (
+	"math"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// BestEffortDistances are the distances, in kilometres, best efforts are
+// tracked over.
+var BestEffortDistances = []struct {
+	Name string
+	Km   float64
+}{
+	{"1k", 1},
+	{"5k", 5},
+	{"10k", 10},
+	{"half_marathon", 21.0975},
+	{"marathon", 42.195},
+}
+
+// Effort is the fastest time over one of the BestEffortDistances and where
+// it was set.
+type Effort struct {
+	Distance        string    `json:"distance"`
+	DurationSeconds int       `json:"duration_seconds"`
+	WorkoutID       int       `json:"workout_id"`
+	LoggedAt        time.Time `json:"logged_at"`
+}
+
+// Pace returns the seconds taken to cover each unit of distance.
+func Pace(distance float64, seconds int) float64 {
+	return round(float64(seconds)/distance, 1)
+}
+
+// Speed returns the distance covered per hour.
+func Speed(distance float64, seconds int) float64 {
+	return round(distance*3600/float64(seconds), 2)
+}
+
+// BestEffort returns the fastest time over distanceKm found in the entries,
+// or nil when none of them is long enough.
+func BestEffort(entries []*store.LoggedEntry, distanceKm float64) *Effort {
+	var best *Effort
+	for _, entry := range entries {
+		seconds, ok := fastestWithin(&entry.WorkoutEntry, distanceKm)
+		if !ok {
+			continue
+		}
+		if best == nil || seconds < best.DurationSeconds {
+			best = &Effort{
+				DurationSeconds: seconds,
+				WorkoutID:       entry.WorkoutID,
+				LoggedAt:        entry.LoggedAt,
+			}
+		}
+	}
+	return best
+}
+
+// fastestWithin returns the fastest time over distanceKm within an entry.
+// Consecutive splits are tried from the start of each one, assuming an even
+// pace within a split; an entry without splits is one long split.
+func fastestWithin(entry *store.WorkoutEntry, distanceKm float64) (int, bool) {
+	if entry.Distance == nil || entry.DurationSeconds == nil {
+		return 0, false
+	}
+
+	splits := entry.Splits
+	if len(splits) == 0 {
+		splits = []store.Split{{Distance: *entry.Distance, DurationSeconds: *entry.DurationSeconds}}
+	}
+
+	const tolerance = 1e-9
+	best, found := 0.0, false
+	for start := range splits {
+		covered, elapsed := 0.0, 0.0
+		for _, split := range splits[start:] {
+			if covered+split.Distance >= distanceKm-tolerance {
+				elapsed += float64(split.DurationSeconds) * (distanceKm - covered) / split.Distance
+				if !found || elapsed < best {
+					best, found = elapsed, true
+				}
+				break
+			}
+			covered += split.Distance
+			elapsed += float64(split.DurationSeconds)
+		}
+	}
+	return int(math.Round(best)), found
+}
@@ -0,0 +1,97 @@
+package training
+
+import (
+	"math"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// Heart rates assumed for users who haven't set their own.
+const (
+	DefaultMaxHeartRate     = 190
+	DefaultRestingHeartRate = 60
+)
+
+// heartRateZoneFloors are where the five heart rate zones start, as a
+// fraction of maximum heart rate. Time below the first zone isn't counted.
+var heartRateZoneFloors = [5]float64{0.5, 0.6, 0.7, 0.8, 0.9}
+
+// maxSampleGapMs caps how long a reading counts for, so a pause in
+// recording doesn't credit the last heart rate with the whole break.
+const maxSampleGapMs = 10000
+
+// HeartRateAccumulator derives heart rate metrics from readings as they
+// stream in. Each reading counts until the next one, up to maxSampleGapMs.
+type HeartRateAccumulator struct {
+	maxHeartRate     int
+	restingHeartRate int
+
+	count, sum, max int
+	zoneMs          [5]float64
+	trimp           float64
+	lastOffsetMs    int
+	lastBPM         int
+}
+
+// NewHeartRateAccumulator returns an accumulator for an athlete with the
+// given maximum and resting heart rates; zero means unknown.
+func NewHeartRateAccumulator(maxHeartRate, restingHeartRate int) *HeartRateAccumulator {
+	if maxHeartRate == 0 {
+		maxHeartRate = DefaultMaxHeartRate
+	}
+	if restingHeartRate == 0 || restingHeartRate >= maxHeartRate {
+		restingHeartRate = DefaultRestingHeartRate
+	}
+	return &HeartRateAccumulator{maxHeartRate: maxHeartRate, restingHeartRate: restingHeartRate}
+}
+
+// Add records a reading offsetMs into the workout. Readings must be added
+// in order.
+func (a *HeartRateAccumulator) Add(offsetMs, bpm int) {
+	if a.count > 0 {
+		a.credit(min(offsetMs-a.lastOffsetMs, maxSampleGapMs))
+	}
+
+	a.count++
+	a.sum += bpm
+	a.max = max(a.max, bpm)
+	a.lastOffsetMs, a.lastBPM = offsetMs, bpm
+}
+
+// credit counts the last reading for durationMs towards the zones and
+// Banister's TRIMP, which weights each minute by heart rate reserve.
+func (a *HeartRateAccumulator) credit(durationMs int) {
+	fraction := float64(a.lastBPM) / float64(a.maxHeartRate)
+	for zone := len(heartRateZoneFloors) - 1; zone >= 0; zone-- {
+		if fraction >= heartRateZoneFloors[zone] {
+			a.zoneMs[zone] += float64(durationMs)
+			break
+		}
+	}
+
+	reserve := float64(a.lastBPM-a.restingHeartRate) / float64(a.maxHeartRate-a.restingHeartRate)
+	reserve = math.Max(0, math.Min(1, reserve))
+	minutes := float64(durationMs) / 60000
+	a.trimp += minutes * reserve * 0.64 * math.Exp(1.92*reserve)
+}
+
+// Metrics returns what the readings add up to, all nil when there were none.
+func (a *HeartRateAccumulator) Metrics() store.HeartRateMetrics {
+	if a.count == 0 {
+		return store.HeartRateMetrics{}
+	}
+
+	avg := int(math.Round(float64(a.sum) / float64(a.count)))
+	maxBPM := a.max
+	zoneSeconds := make([]int, len(a.zoneMs))
+	for i, ms := range a.zoneMs {
+		zoneSeconds[i] = int(math.Round(ms / 1000))
+	}
+	trimp := round(a.trimp, 1)
+	return store.HeartRateMetrics{
+		AvgHeartRate:  &avg,
+		MaxHeartRate:  &maxBPM,
+		HRZoneSeconds: zoneSeconds,
+		TRIMP:         &trimp,
+	}
+}
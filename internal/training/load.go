@@ -0,0 +1,85 @@
+package training
+
+import (
+	"math"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// DefaultRPE is the effort, on the 1-10 rating of perceived exertion scale,
+// assumed for entries logged without one.
+const DefaultRPE = 5.0
+
+// Time constants of the load model, in days.
+const (
+	AcuteLoadDays   = 7
+	ChronicLoadDays = 28
+	FitnessDays     = 42
+	FatigueDays     = 7
+)
+
+// WorkoutLoad returns the training load of a workout in arbitrary units:
+// minutes × RPE summed over its entries, with their time split as
+// entrySeconds does. This is the session RPE method, applied per entry so
+// that a hard interval block isn't averaged away by an easy warm-up. Time
+// outside the entries, or the whole of a workout without any, counts at
+// DefaultRPE.
+func WorkoutLoad(workout *store.Workout) float64 {
+	seconds, unassigned := entrySeconds(workout)
+	load := DefaultRPE * unassigned / 60
+	for i, entry := range workout.Entries {
+		rpe := DefaultRPE
+		if entry.RPE != nil {
+			rpe = *entry.RPE
+		}
+		load += rpe * seconds[i] / 60
+	}
+	return load
+}
+
+// NextLoadDay advances the load model from previous, or from nothing when
+// it's nil, to a day with the given training load. Acute and chronic load
+// are exponentially weighted moving averages; fitness and fatigue decay
+// towards the day's load with their time constants, as in Banister's
+// impulse-response model.
+func NextLoadDay(previous *store.LoadDay, day time.Time, load float64) *store.LoadDay {
+	if previous == nil {
+		previous = &store.LoadDay{}
+	}
+	return &store.LoadDay{
+		Day:     day,
+		Load:    load,
+		Acute:   ewma(previous.Acute, load, AcuteLoadDays),
+		Chronic: ewma(previous.Chronic, load, ChronicLoadDays),
+		Fitness: decay(previous.Fitness, load, FitnessDays),
+		Fatigue: decay(previous.Fatigue, load, FatigueDays),
+	}
+}
+
+// ACWR returns the acute:chronic workload ratio of a day, or nil before
+// there's any chronic load to compare with.
+func ACWR(day *store.LoadDay) *float64 {
+	if day.Chronic == 0 {
+		return nil
+	}
+	ratio := round(day.Acute/day.Chronic, 2)
+	return &ratio
+}
+
+// Form is fitness less fatigue: positive when rested, negative when
+// carrying fatigue.
+func Form(day *store.LoadDay) float64 {
+	return day.Fitness - day.Fatigue
+}
+
+// ewma weights the day's load by 2 / (days + 1), the usual smoothing
+// factor for an average over days.
+func ewma(previous, load float64, days int) float64 {
+	alpha := 2 / float64(days+1)
+	return alpha*load + (1-alpha)*previous
+}
+
+func decay(previous, load float64, days int) float64 {
+	return previous + (load-previous)*(1-math.Exp(-1/float64(days)))
+}
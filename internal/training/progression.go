@@ -0,0 +1,142 @@
+package training
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// Progression defaults for exercises without settings of their own.
+const (
+	DefaultIncrementKg = 2.5
+	DefaultMinReps     = 8
+	DefaultMaxReps     = 12
+	DefaultTargetRPE   = 8.0
+)
+
+// deloadFactor is the share of the weight kept after a stalled session.
+const deloadFactor = 0.9
+
+// Recommendation is what to do for an exercise next session. Weight is in
+// kilograms, and nil for bodyweight exercises.
+type Recommendation struct {
+	Scheme     string   `json:"scheme"`
+	Sets       int      `json:"sets"`
+	Reps       int      `json:"reps"`
+	Weight     *float64 `json:"weight,omitempty"`
+	WeightUnit string   `json:"weight_unit,omitempty"`
+	TargetRPE  *float64 `json:"target_rpe,omitempty"`
+	Reason     string   `json:"reason"`
+}
+
+// DefaultProgression returns the settings used for an exercise the user
+// hasn't configured.
+func DefaultProgression(exerciseName string) store.ProgressionSettings {
+	return store.ProgressionSettings{
+		ExerciseName: exerciseName,
+		Scheme:       store.ProgressionLinear,
+		Increment:    DefaultIncrementKg,
+		MinReps:      DefaultMinReps,
+		MaxReps:      DefaultMaxReps,
+		TargetRPE:    DefaultTargetRPE,
+	}
+}
+
+// Recommend suggests the next session of an exercise from its history,
+// newest first, of entries done for reps. It returns nil without history.
+//
+//   - Linear keeps the sets and reps and adds the increment, unless reps
+//     dropped since the session before at the same or a lower weight: then
+//     the lift has stalled, and it takes 10% off to build back up.
+//   - Double adds a rep each session until MaxReps, then adds the increment
+//     and starts again from MinReps.
+//   - RPE estimates a one rep max from the last session's weight, reps and
+//     RPE, and picks the weight for the same reps at TargetRPE. Without an
+//     RPE logged it repeats the last session.
+//
+// Bodyweight exercises can't add weight, so they add reps instead.
+func Recommend(settings store.ProgressionSettings, history []*store.LoggedEntry) *Recommendation {
+	if len(history) == 0 {
+		return nil
+	}
+	last := history[0]
+	next := &Recommendation{Scheme: settings.Scheme, Sets: last.Sets, Reps: *last.Reps}
+
+	if settings.Scheme == store.ProgressionRPE {
+		target := settings.TargetRPE
+		next.TargetRPE = &target
+	}
+
+	if last.Weight == nil {
+		switch {
+		case settings.Scheme == store.ProgressionRPE && last.RPE != nil && *last.RPE > settings.TargetRPE:
+			next.Reps = max(next.Reps-1, 1)
+			next.Reason = fmt.Sprintf("RPE %.3g was above the target: one rep fewer", *last.RPE)
+		case settings.Scheme == store.ProgressionRPE && (last.RPE == nil || *last.RPE == settings.TargetRPE):
+			next.Reason = "repeat the last session"
+		default:
+			next.Reps++
+			next.Reason = "add a rep"
+		}
+		return next
+	}
+
+	weight := *last.Weight
+	switch settings.Scheme {
+	case store.ProgressionDouble:
+		if next.Reps >= settings.MaxReps {
+			weight += settings.Increment
+			next.Reps = settings.MinReps
+			next.Reason = fmt.Sprintf("reached %d reps: add weight and start again from %d", settings.MaxReps, settings.MinReps)
+		} else {
+			next.Reps++
+			next.Reason = fmt.Sprintf("add a rep on the way to %d", settings.MaxReps)
+		}
+
+	case store.ProgressionRPE:
+		if last.RPE == nil {
+			next.Reason = "repeat the last session, and log its RPE to adjust the weight"
+			break
+		}
+		oneRepMax := weight * (1 + (float64(next.Reps)+10-*last.RPE)/30)
+		weight = roundToIncrement(oneRepMax/(1+(float64(next.Reps)+10-settings.TargetRPE)/30), settings.Increment)
+		next.Reason = fmt.Sprintf("%d reps were RPE %.3g: set the weight for RPE %.3g", next.Reps, *last.RPE, settings.TargetRPE)
+
+	default:
+		if previous := stalledFrom(history); previous != nil {
+			weight = roundToIncrement(weight*deloadFactor, settings.Increment)
+			next.Reps = *previous.Reps
+			next.Reason = fmt.Sprintf("reps dropped from %d to %d: take 10%% off and build back up", *previous.Reps, *last.Reps)
+		} else {
+			weight += settings.Increment
+			next.Reason = "add weight"
+		}
+	}
+
+	weight = round(weight, 3)
+	next.Weight = &weight
+	return next
+}
+
+// stalledFrom returns the session before the last one when the last one
+// managed fewer reps at the same or a lower weight.
+func stalledFrom(history []*store.LoggedEntry) *store.LoggedEntry {
+	if len(history) < 2 {
+		return nil
+	}
+	last, previous := history[0], history[1]
+	if previous.Weight == nil || *last.Weight > *previous.Weight || *last.Reps >= *previous.Reps {
+		return nil
+	}
+	return previous
+}
+
+// roundToIncrement rounds a weight to the nearest multiple of increment, so
+// that it can be loaded with the plates the increment implies.
+func roundToIncrement(weight, increment float64) float64 {
+	if increment <= 0 {
+		return weight
+	}
+	return math.Round(weight/increment) * increment
+}
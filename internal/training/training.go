@@ -0,0 +1,78 @@
+// Package training holds the calculations derived from workouts and body
+// measurements.
+package training
+
+import (
+	"math"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// ResistanceTrainingMET is the metabolic equivalent of a general strength
+// training session, used to estimate calories burned.
+const ResistanceTrainingMET = 5.0
+
+// Volume returns the total weight moved in a workout: sets × reps × weight
+// summed over its entries. Entries with reps but no weight are bodyweight
+// exercises and count bodyweightKg, when known, as the weight. Timed entries
+// have no volume.
+func Volume(workout *store.Workout, bodyweightKg *float64) float64 {
+	volume := 0.0
+	for _, entry := range workout.Entries {
+		if entry.Reps == nil {
+			continue
+		}
+
+		weight := 0.0
+		switch {
+		case entry.Weight != nil:
+			weight = *entry.Weight
+		case bodyweightKg != nil:
+			weight = *bodyweightKg
+		}
+		volume += float64(entry.Sets*(*entry.Reps)) * weight
+	}
+	return round(volume, 2)
+}
+
+// EstimateCalories estimates the calories burned by a strength training
+// session of the given length: MET × bodyweight in kg × hours.
+func EstimateCalories(durationMinutes int, bodyweightKg float64) int {
+	return int(math.Round(ResistanceTrainingMET * bodyweightKg * float64(durationMinutes) / 60))
+}
+
+// TrendPoint is a measurement alongside the moving average ending at it.
+type TrendPoint struct {
+	MeasuredAt time.Time `json:"measured_at"`
+	Value      float64   `json:"value"`
+	Average    float64   `json:"average"`
+}
+
+// MovingAverage smooths measurements of a single metric, sorted by time,
+// averaging each one with those taken in the window before it. Averaging
+// over time rather than a fixed count keeps irregular weigh-ins from
+// skewing the trend.
+func MovingAverage(measurements []*store.Measurement, window time.Duration) []TrendPoint {
+	points := make([]TrendPoint, 0, len(measurements))
+	start, sum := 0, 0.0
+	for i, measurement := range measurements {
+		sum += measurement.Value
+		for measurements[start].MeasuredAt.Before(measurement.MeasuredAt.Add(-window)) {
+			sum -= measurements[start].Value
+			start++
+		}
+
+		points = append(points, TrendPoint{
+			MeasuredAt: measurement.MeasuredAt,
+			Value:      round(measurement.Value, 2),
+			Average:    round(sum/float64(i-start+1), 2),
+		})
+	}
+	return points
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,319 @@
+package training
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestVolume(t *testing.T) {
+	workout := &store.Workout{
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 3, Reps: intPtr(5), Weight: floatPtr(100)},
+			{ExerciseName: "Pull Up", Sets: 3, Reps: intPtr(10)},
+			{ExerciseName: "Plank", Sets: 2, DurationSeconds: intPtr(60)},
+		},
+	}
+
+	assert.Equal(t, 1500.0, Volume(workout, nil))
+	assert.Equal(t, 3750.0, Volume(workout, floatPtr(75)))
+}
+
+func TestEstimateCalories(t *testing.T) {
+	assert.Equal(t, 300, EstimateCalories(45, 80))
+	assert.Equal(t, 0, EstimateCalories(0, 80))
+}
+
+func TestEstimateWorkoutCalories(t *testing.T) {
+	run := store.ActivityRun
+	tests := []struct {
+		name    string
+		workout *store.Workout
+		want    int
+	}{
+		{
+			name:    "no entries",
+			workout: &store.Workout{DurationMinutes: 45},
+			want:    300,
+		},
+		{
+			name: "run with a warm-up",
+			workout: &store.Workout{
+				DurationMinutes: 30,
+				Entries: []store.WorkoutEntry{
+					{ExerciseName: "Tempo Run", Activity: &run, Sets: 1, DurationSeconds: intPtr(1500), Distance: floatPtr(5)},
+				},
+			},
+			want: 417,
+		},
+		{
+			name: "strength session",
+			workout: &store.Workout{
+				DurationMinutes: 60,
+				Entries: []store.WorkoutEntry{
+					{ExerciseName: "Back Squat", Sets: 5, Reps: intPtr(5), Weight: floatPtr(100)},
+					{ExerciseName: "Bicep Curl", Sets: 3, Reps: intPtr(12), Weight: floatPtr(20)},
+					{ExerciseName: "Plank", Sets: 2, DurationSeconds: intPtr(60)},
+				},
+			},
+			want: 449,
+		},
+		{
+			name: "no duration",
+			workout: &store.Workout{
+				Entries: []store.WorkoutEntry{
+					{ExerciseName: "Bench Press", Sets: 3, Reps: intPtr(8), Weight: floatPtr(40)},
+				},
+			},
+			want: 48,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EstimateWorkoutCalories(tt.workout, 80))
+		})
+	}
+}
+
+func TestActivityAndExerciseMET(t *testing.T) {
+	assert.Equal(t, 8.0, ActivityMET(store.ActivityRide, 20))
+	assert.Equal(t, 3.5, ActivityMET(store.ActivityWalk, 0))
+	assert.Equal(t, minRunningMET, ActivityMET(store.ActivityRun, 5))
+	assert.Equal(t, IsolationLiftMET, ExerciseMET("Leg Extension"))
+	assert.Equal(t, CompoundLiftMET, ExerciseMET("Romanian Deadlift"))
+	assert.Equal(t, ResistanceTrainingMET, ExerciseMET("Burpee"))
+}
+
+func TestWorkoutLoad(t *testing.T) {
+	run := store.ActivityRun
+	strength := &store.Workout{
+		DurationMinutes: 60,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Back Squat", Sets: 5, Reps: intPtr(5), Weight: floatPtr(100), RPE: floatPtr(8)},
+			{ExerciseName: "Bicep Curl", Sets: 3, Reps: intPtr(12), Weight: floatPtr(20)},
+			{ExerciseName: "Plank", Sets: 2, DurationSeconds: intPtr(60), RPE: floatPtr(6)},
+		},
+	}
+	cardio := &store.Workout{
+		DurationMinutes: 30,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Tempo Run", Activity: &run, Sets: 1, DurationSeconds: intPtr(1500), RPE: floatPtr(7)},
+		},
+	}
+
+	assert.InDelta(t, 410.75, WorkoutLoad(strength), 1e-9)
+	// The five minutes outside the run count at DefaultRPE
+	assert.InDelta(t, 200.0, WorkoutLoad(cardio), 1e-9)
+	assert.InDelta(t, 225.0, WorkoutLoad(&store.Workout{DurationMinutes: 45}), 1e-9)
+}
+
+func TestNextLoadDay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := NextLoadDay(nil, start, 100)
+	assert.Equal(t, start, first.Day)
+	assert.InDelta(t, 25.0, first.Acute, 1e-9)
+	assert.InDelta(t, 6.897, first.Chronic, 0.001)
+	assert.InDelta(t, 2.353, first.Fitness, 0.001)
+	assert.InDelta(t, 13.312, first.Fatigue, 0.001)
+	assert.Equal(t, floatPtr(3.63), ACWR(first))
+	assert.Less(t, Form(first), 0.0)
+
+	// A rest day: everything decays, fatigue faster than fitness
+	rest := NextLoadDay(first, start.AddDate(0, 0, 1), 0)
+	assert.InDelta(t, 18.75, rest.Acute, 1e-9)
+	assert.Equal(t, floatPtr(2.92), ACWR(rest))
+	assert.Greater(t, Form(rest), Form(first))
+
+	assert.Nil(t, ACWR(NextLoadDay(nil, start, 0)))
+}
+
+func TestRecommend(t *testing.T) {
+	session := func(weight *float64, reps int, rpe *float64) *store.LoggedEntry {
+		return &store.LoggedEntry{WorkoutEntry: store.WorkoutEntry{ExerciseName: "Squat", Sets: 3, Reps: intPtr(reps), Weight: weight, RPE: rpe}}
+	}
+	settings := func(scheme string) store.ProgressionSettings {
+		settings := DefaultProgression("squat")
+		settings.Scheme = scheme
+		return settings
+	}
+
+	tests := []struct {
+		name     string
+		settings store.ProgressionSettings
+		history  []*store.LoggedEntry
+		reps     int
+		weight   *float64
+	}{
+		{
+			name:     "linear adds weight",
+			settings: settings(store.ProgressionLinear),
+			history:  []*store.LoggedEntry{session(floatPtr(100), 5, nil), session(floatPtr(97.5), 5, nil)},
+			reps:     5,
+			weight:   floatPtr(102.5),
+		},
+		{
+			name:     "linear deloads after a stall",
+			settings: settings(store.ProgressionLinear),
+			history:  []*store.LoggedEntry{session(floatPtr(100), 3, nil), session(floatPtr(100), 5, nil)},
+			reps:     5,
+			weight:   floatPtr(90),
+		},
+		{
+			name:     "double adds a rep",
+			settings: settings(store.ProgressionDouble),
+			history:  []*store.LoggedEntry{session(floatPtr(60), 10, nil)},
+			reps:     11,
+			weight:   floatPtr(60),
+		},
+		{
+			name:     "double adds weight at the top of the range",
+			settings: settings(store.ProgressionDouble),
+			history:  []*store.LoggedEntry{session(floatPtr(60), 12, nil)},
+			reps:     8,
+			weight:   floatPtr(62.5),
+		},
+		{
+			name:     "rpe lightens a grinder",
+			settings: settings(store.ProgressionRPE),
+			history:  []*store.LoggedEntry{session(floatPtr(100), 5, floatPtr(9))},
+			reps:     5,
+			weight:   floatPtr(97.5),
+		},
+		{
+			name:     "rpe without one logged repeats",
+			settings: settings(store.ProgressionRPE),
+			history:  []*store.LoggedEntry{session(floatPtr(100), 5, nil)},
+			reps:     5,
+			weight:   floatPtr(100),
+		},
+		{
+			name:     "bodyweight adds a rep",
+			settings: settings(store.ProgressionLinear),
+			history:  []*store.LoggedEntry{session(nil, 8, nil)},
+			reps:     9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := Recommend(tt.settings, tt.history)
+			assert.Equal(t, tt.settings.Scheme, next.Scheme)
+			assert.Equal(t, 3, next.Sets)
+			assert.Equal(t, tt.reps, next.Reps)
+			assert.Equal(t, tt.weight, next.Weight)
+			assert.NotEmpty(t, next.Reason)
+		})
+	}
+
+	assert.Nil(t, Recommend(settings(store.ProgressionLinear), nil))
+}
+
+func TestMovingAverage(t *testing.T) {
+	start := time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	measurements := []*store.Measurement{
+		{Value: 80, MeasuredAt: start},
+		{Value: 82, MeasuredAt: start.Add(day)},
+		{Value: 81, MeasuredAt: start.Add(2 * day)},
+		// A gap longer than the window starts the average over
+		{Value: 78, MeasuredAt: start.Add(10 * day)},
+		{Value: 79, MeasuredAt: start.Add(11 * day)},
+	}
+
+	points := MovingAverage(measurements, 7*day)
+
+	averages := make([]float64, len(points))
+	for i, point := range points {
+		averages[i] = point.Average
+		assert.Equal(t, measurements[i].Value, point.Value)
+		assert.Equal(t, measurements[i].MeasuredAt, point.MeasuredAt)
+	}
+	assert.Equal(t, []float64{80, 81, 81, 78, 78.5}, averages)
+	assert.Empty(t, MovingAverage(nil, 7*day))
+}
+
+func TestPaceAndSpeed(t *testing.T) {
+	assert.Equal(t, 300.0, Pace(10, 3000))
+	assert.Equal(t, 12.0, Speed(10, 3000))
+	assert.Equal(t, 482.8, Pace(6.2137, 3000))
+}
+
+func TestBestEffort(t *testing.T) {
+	day := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	entries := []*store.LoggedEntry{
+		{
+			// An even 5:00/km 10k without splits
+			WorkoutEntry: store.WorkoutEntry{Distance: floatPtr(10), DurationSeconds: intPtr(3000)},
+			WorkoutID:    1,
+			LoggedAt:     day,
+		},
+		{
+			// A 6k with a fast middle
+			WorkoutEntry: store.WorkoutEntry{
+				Distance:        floatPtr(6),
+				DurationSeconds: intPtr(1710),
+				Splits: []store.Split{
+					{Distance: 1, DurationSeconds: 330},
+					{Distance: 1, DurationSeconds: 270},
+					{Distance: 1, DurationSeconds: 270},
+					{Distance: 1, DurationSeconds: 270},
+					{Distance: 1, DurationSeconds: 270},
+					{Distance: 1, DurationSeconds: 300},
+				},
+			},
+			WorkoutID: 2,
+			LoggedAt:  day.Add(24 * time.Hour),
+		},
+	}
+
+	best5k := BestEffort(entries, 5)
+	assert.Equal(t, 2, best5k.WorkoutID)
+	assert.Equal(t, 1380, best5k.DurationSeconds)
+
+	best1k := BestEffort(entries, 1)
+	assert.Equal(t, 2, best1k.WorkoutID)
+	assert.Equal(t, 270, best1k.DurationSeconds)
+
+	best10k := BestEffort(entries, 10)
+	assert.Equal(t, 1, best10k.WorkoutID)
+	assert.Equal(t, 3000, best10k.DurationSeconds)
+	assert.Equal(t, day, best10k.LoggedAt)
+
+	assert.Nil(t, BestEffort(entries, 21.0975))
+	assert.Nil(t, BestEffort(nil, 5))
+}
+
+func TestHeartRateAccumulator(t *testing.T) {
+	accumulator := NewHeartRateAccumulator(200, 50)
+	// A minute at 140 (zone 3), a minute at 170 (zone 4), then a long pause
+	for offset := 0; offset < 60000; offset += 1000 {
+		accumulator.Add(offset, 140)
+	}
+	for offset := 60000; offset < 120000; offset += 1000 {
+		accumulator.Add(offset, 170)
+	}
+	accumulator.Add(600000, 90)
+
+	metrics := accumulator.Metrics()
+	assert.Equal(t, 154, *metrics.AvgHeartRate)
+	assert.Equal(t, 170, *metrics.MaxHeartRate)
+	// The last reading at 170 counts for the 10 second cap, not the pause
+	assert.Equal(t, []int{0, 0, 60, 69, 0}, metrics.HRZoneSeconds)
+	assert.Equal(t, 4.0, *metrics.TRIMP)
+
+	empty := NewHeartRateAccumulator(0, 0).Metrics()
+	assert.Nil(t, empty.AvgHeartRate)
+	assert.Nil(t, empty.TRIMP)
+}
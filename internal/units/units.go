@@ -0,0 +1,114 @@
+// Package units converts between the metric and imperial units users can
+// choose to see. Weights are stored in kilograms, distances in kilometres
+// and elevation in metres; conversion happens at the API boundary.
+package units
+
+// Unit systems a user can prefer.
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+// Units of weight, distance, elevation and body length.
+const (
+	Kilograms   = "kg"
+	Pounds      = "lb"
+	Kilometers  = "km"
+	Miles       = "mi"
+	Meters      = "m"
+	Feet        = "ft"
+	Centimeters = "cm"
+	Inches      = "in"
+)
+
+// Exact conversion factors.
+const (
+	KilogramsPerPound  = 0.45359237
+	KilometersPerMile  = 1.609344
+	MetersPerFoot      = 0.3048
+	CentimetersPerInch = 2.54
+)
+
+func ValidSystem(system string) bool {
+	return system == Metric || system == Imperial
+}
+
+// WeightUnit returns the unit weights are shown in for the system.
+func WeightUnit(system string) string {
+	if system == Imperial {
+		return Pounds
+	}
+	return Kilograms
+}
+
+// DistanceUnit returns the unit distances are shown in for the system.
+func DistanceUnit(system string) string {
+	if system == Imperial {
+		return Miles
+	}
+	return Kilometers
+}
+
+// ElevationUnit returns the unit elevation is shown in for the system.
+func ElevationUnit(system string) string {
+	if system == Imperial {
+		return Feet
+	}
+	return Meters
+}
+
+// LengthUnit returns the unit body measurements are shown in for the system.
+func LengthUnit(system string) string {
+	if system == Imperial {
+		return Inches
+	}
+	return Centimeters
+}
+
+// ToKilograms converts a weight in the system's unit to kilograms.
+func ToKilograms(weight float64, system string) float64 {
+	if system == Imperial {
+		return weight * KilogramsPerPound
+	}
+	return weight
+}
+
+// FromKilograms converts a weight in kilograms to the system's unit.
+func FromKilograms(kg float64, system string) float64 {
+	if system == Imperial {
+		return kg / KilogramsPerPound
+	}
+	return kg
+}
+
+// ToKilometers converts a distance in the system's unit to kilometres.
+func ToKilometers(distance float64, system string) float64 {
+	if system == Imperial {
+		return distance * KilometersPerMile
+	}
+	return distance
+}
+
+// FromKilometers converts a distance in kilometres to the system's unit.
+func FromKilometers(km float64, system string) float64 {
+	if system == Imperial {
+		return km / KilometersPerMile
+	}
+	return km
+}
+
+// ToMeters converts an elevation in the system's unit to metres.
+func ToMeters(elevation float64, system string) float64 {
+	if system == Imperial {
+		return elevation * MetersPerFoot
+	}
+	return elevation
+}
+
+// FromMeters converts an elevation in metres to the system's unit.
+func FromMeters(m float64, system string) float64 {
+	if system == Imperial {
+		return m / MetersPerFoot
+	}
+	return m
+}
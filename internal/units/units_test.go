@@ -0,0 +1,45 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightConversion(t *testing.T) {
+	assert.InDelta(t, 102.058, ToKilograms(225, Imperial), 0.001)
+	assert.Equal(t, 100.0, ToKilograms(100, Metric))
+	assert.InDelta(t, 225.0, FromKilograms(ToKilograms(225, Imperial), Imperial), 1e-9)
+	assert.Equal(t, 100.0, FromKilograms(100, Metric))
+}
+
+func TestDistanceConversion(t *testing.T) {
+	assert.InDelta(t, 42.195, ToKilometers(26.2188, Imperial), 0.001)
+	assert.InDelta(t, 3.10686, FromKilometers(5, Imperial), 0.00001)
+	assert.Equal(t, 5.0, FromKilometers(5, Metric))
+	assert.InDelta(t, 304.8, ToMeters(1000, Imperial), 1e-9)
+	assert.InDelta(t, 1000.0, FromMeters(304.8, Imperial), 1e-9)
+}
+
+func TestUnitsForSystem(t *testing.T) {
+	tests := []struct {
+		system    string
+		weight    string
+		distance  string
+		elevation string
+		length    string
+	}{
+		{Metric, Kilograms, Kilometers, Meters, Centimeters},
+		{Imperial, Pounds, Miles, Feet, Inches},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.weight, WeightUnit(tt.system))
+		assert.Equal(t, tt.distance, DistanceUnit(tt.system))
+		assert.Equal(t, tt.elevation, ElevationUnit(tt.system))
+		assert.Equal(t, tt.length, LengthUnit(tt.system))
+	}
+
+	assert.True(t, ValidSystem(Imperial))
+	assert.False(t, ValidSystem("nautical"))
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -26,14 +28,52 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 
 
 func ReadIDParam(r *http.Request) (int64, error) {
-	idParam := chi.URLParam(r, "id")
+	return ReadInt64Param(r, "id")
+}
+
+// ReadInt64Param reads the numeric URL parameter with the given name.
+func ReadInt64Param(r *http.Request, name string) (int64, error) {
+	idParam := chi.URLParam(r, name)
 	if idParam == "" {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	id, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		return 0, errors.New("invalid id parameter type")
+		return 0, fmt.Errorf("invalid %s parameter type", name)
 	}
 
 	return id, nil
-}
\ No newline at end of file
+}
+
+// ClientIP returns the IP address of the client without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ReadPagination reads the page and page_size query parameters. Missing
+// values fall back to page 1 and defaultPageSize.
+func ReadPagination(r *http.Request, defaultPageSize, maxPageSize int) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+
+	if v := r.URL.Query().Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, errors.New("page must be a positive integer")
+		}
+		page = n
+	}
+
+	if v := r.URL.Query().Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+		pageSize = n
+	}
+
+	return page, pageSize, nil
+}
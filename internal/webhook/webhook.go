@@ -0,0 +1,323 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it fails.
+	MaxAttempts = 8
+	// BaseBackoff is the wait before the first retry; it doubles each time.
+	BaseBackoff = 30 * time.Second
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff = 6 * time.Hour
+
+	// maxResponseBody is how much of a receiver's response is kept in the log.
+	maxResponseBody = 1024
+)
+
+// ErrPrivateAddress is returned when a webhook URL resolves to an address
+// that isn't publicly routable.
+var ErrPrivateAddress = errors.New("webhook: refusing to connect to a private address")
+
+var (
+	// sharedAddressSpace is the carrier-grade NAT range (RFC 6598). It isn't
+	// covered by IsPrivate but is just as internal.
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+	// nat64WellKnown is the NAT64 prefix (RFC 6052); the last four bytes of
+	// an address in it are the IPv4 address the translator connects to.
+	nat64WellKnown = netip.MustParsePrefix("64:ff9b::/96")
+	// nat64LocalUse is the local-use NAT64 prefix (RFC 8215). Where the IPv4
+	// address sits in it depends on the network, so it is refused outright.
+	nat64LocalUse = netip.MustParsePrefix("64:ff9b:1::/48")
+)
+
+// checkAddress is a net.Dialer Control function that stops deliveries from
+// reaching loopback, private, shared (CGNAT), link-local or unspecified
+// addresses, including IPv4 ones reached through IPv4-mapped or NAT64
+// addresses. It runs after DNS resolution, so a public hostname pointing
+// inside the network is caught too.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := addrPort.Addr().Unmap()
+	if nat64LocalUse.Contains(ip) {
+		return ErrPrivateAddress
+	}
+	if nat64WellKnown.Contains(ip) {
+		b := ip.As16()
+		ip = netip.AddrFrom4([4]byte(b[12:]))
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with. It only connects
+// to public addresses, ignores proxy settings so that check can't be
+// bypassed, and doesn't follow redirects.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: checkAddress,
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Sign returns the signature of a delivery: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret, prefixed "sha256=".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature. Receivers should also reject
+// timestamps too far from their clock to stop replays.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff returns how long to wait before retrying after the given number
+// of failed attempts.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return wait
+}
+
+// Result is the outcome of sending a delivery once.
+type Result struct {
+	StatusCode int
+	Body       string
+	Err        error
+	Duration   time.Duration
+}
+
+// OK reports whether the receiver accepted the delivery with a 2xx response.
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Send POSTs a delivery's payload to the webhook URL, signed with its secret.
+func Send(ctx context.Context, client *http.Client, delivery *store.PendingDelivery, now time.Time) Result {
+	start := time.Now()
+	result := func(r Result) Result {
+		r.Duration = time.Since(start)
+		return r
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return result(Result{Err: err})
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "workout-tracker-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return result(Result{Err: err})
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	r := Result{StatusCode: resp.StatusCode, Body: strings.ToValidUTF8(string(body), "")}
+	if !r.OK() {
+		r.Err = fmt.Errorf("receiver responded %d", resp.StatusCode)
+	}
+	return result(r)
+}
+
+// Deliverer sends queued deliveries, retrying failures with exponential
+// backoff until MaxAttempts. Deliveries have their own queue rather than
+// running as jobs because their owners can see each attempt and redeliver
+// them, and receivers are given far longer to recover than jobs are.
+type Deliverer struct {
+	WebhookStore store.WebhookStore
+	Client       *http.Client
+	Workers      int
+	Logger       *log.Logger
+}
+
+func NewDeliverer(webhookStore store.WebhookStore, workers int, logger *log.Logger) *Deliverer {
+	return &Deliverer{
+		WebhookStore: webhookStore,
+		Client:       NewClient(),
+		Workers:      workers,
+		Logger:       logger,
+	}
+}
+
+// DeliverDue sends every delivery that is due, a batch at a time, and
+// returns how many it attempted.
+func (d *Deliverer) DeliverDue(ctx context.Context) (int, error) {
+	batch := max(d.Workers, 1) * 4
+	// Long enough for a whole batch to time out on a single worker
+	lease := d.Client.Timeout*time.Duration(batch) + time.Minute
+
+	attempted := 0
+	for ctx.Err() == nil {
+		deliveries, err := d.WebhookStore.ClaimDueDeliveries(batch, lease)
+		if err != nil {
+			return attempted, err
+		}
+		if len(deliveries) == 0 {
+			return attempted, nil
+		}
+
+		jobs := make(chan *store.PendingDelivery)
+		var wg sync.WaitGroup
+		for range max(d.Workers, 1) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for delivery := range jobs {
+					d.deliver(ctx, delivery)
+				}
+			}()
+		}
+		for _, delivery := range deliveries {
+			jobs <- delivery
+		}
+		close(jobs)
+		wg.Wait()
+
+		attempted += len(deliveries)
+	}
+	return attempted, ctx.Err()
+}
+
+func (d *Deliverer) deliver(ctx context.Context, delivery *store.PendingDelivery) {
+	result := Send(ctx, d.Client, delivery, time.Now())
+
+	attempt := &store.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		DurationMS: int(result.Duration.Milliseconds()),
+	}
+	if result.StatusCode != 0 {
+		attempt.ResponseStatus = &result.StatusCode
+		// Only admins see what a receiver answered; a user could otherwise
+		// read responses from servers they don't control
+		if delivery.Global {
+			attempt.ResponseBody = &result.Body
+		}
+	}
+	if result.Err != nil {
+		message := result.Err.Error()
+		attempt.Error = &message
+	}
+
+	status := store.DeliverySucceeded
+	var nextAttemptAt *time.Time
+	if !result.OK() {
+		status = store.DeliveryFailed
+		if attempts := delivery.Attempts + 1; attempts < MaxAttempts {
+			status = store.DeliveryPending
+			next := time.Now().Add(Backoff(attempts))
+			nextAttemptAt = &next
+		}
+	}
+
+	err := d.WebhookStore.CompleteAttempt(attempt, status, nextAttemptAt)
+	if err != nil {
+		d.Logger.Printf("ERROR: recording webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// Run delivers due webhooks every interval until ctx is done.
+func (d *Deliverer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := d.DeliverDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				d.Logger.Printf("ERROR: delivering webhooks: %v", err)
+			}
+		}
+	}
+}
+
+// GenerateSecret returns a random signing secret for a new webhook.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// ValidURL reports whether deliveries can be sent to rawURL: an absolute
+// https URL.
+func ValidURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "https" && u.Hostname() != ""
+}
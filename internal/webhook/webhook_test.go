@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LikhithMar14/workout-tracker/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore hands out its deliveries once and records completed attempts.
+type fakeStore struct {
+	store.WebhookStore
+
+	mu         sync.Mutex
+	due        []*store.PendingDelivery
+	statuses   map[int64]string
+	nextAt     map[int64]*time.Time
+	attemptLog []*store.WebhookDeliveryAttempt
+}
+
+func (f *fakeStore) ClaimDueDeliveries(limit int, lease time.Duration) ([]*store.PendingDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(limit, len(f.due))
+	claimed := f.due[:n]
+	f.due = f.due[n:]
+	return claimed, nil
+}
+
+func (f *fakeStore) CompleteAttempt(attempt *store.WebhookDeliveryAttempt, status string, nextAttemptAt *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[attempt.DeliveryID] = status
+	f.nextAt[attempt.DeliveryID] = nextAttemptAt
+	f.attemptLog = append(f.attemptLog, attempt)
+	return nil
+}
+
+func pendingDelivery(id int64, url string, attempts int) *store.PendingDelivery {
+	delivery := &store.PendingDelivery{URL: url, Secret: "s3cret"}
+	delivery.ID = id
+	delivery.EventType = store.WebhookEventWorkoutCreated
+	delivery.Payload = []byte(`{"event":"workout.created","data":{"id":1}}`)
+	delivery.Attempts = attempts
+	return delivery
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	var gotBody []byte
+	var gotHeader http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	delivery := pendingDelivery(42, receiver.URL, 0)
+	result := Send(context.Background(), receiver.Client(), delivery, time.Unix(1700000000, 0))
+
+	require.True(t, result.OK())
+	assert.Equal(t, http.StatusAccepted, result.StatusCode)
+	assert.Equal(t, string(delivery.Payload), string(gotBody))
+	assert.Equal(t, "workout.created", gotHeader.Get(HeaderEvent))
+	assert.Equal(t, "42", gotHeader.Get(HeaderDelivery))
+	assert.Equal(t, "1700000000", gotHeader.Get(HeaderTimestamp))
+
+	timestamp, err := strconv.ParseInt(gotHeader.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.True(t, Verify("s3cret", timestamp, gotBody, gotHeader.Get(HeaderSignature)))
+	assert.False(t, Verify("wrong", timestamp, gotBody, gotHeader.Get(HeaderSignature)))
+	assert.False(t, Verify("s3cret", timestamp+1, gotBody, gotHeader.Get(HeaderSignature)))
+}
+
+func TestDeliverDue(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	global := pendingDelivery(2, receiver.URL+"/broken", 0)
+	global.Global = true
+	fake := &fakeStore{
+		due: []*store.PendingDelivery{
+			pendingDelivery(1, receiver.URL+"/ok", 0),
+			global,
+			pendingDelivery(3, receiver.URL+"/broken", MaxAttempts-1),
+		},
+		statuses: map[int64]string{},
+		nextAt:   map[int64]*time.Time{},
+	}
+	deliverer := NewDeliverer(fake, 2, log.New(io.Discard, "", 0))
+	deliverer.Client = receiver.Client()
+
+	attempted, err := deliverer.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempted)
+
+	assert.Equal(t, store.DeliverySucceeded, fake.statuses[1])
+	assert.Nil(t, fake.nextAt[1])
+
+	assert.Equal(t, store.DeliveryPending, fake.statuses[2], "failed deliveries are retried")
+	require.NotNil(t, fake.nextAt[2])
+	assert.WithinDuration(t, time.Now().Add(BaseBackoff), *fake.nextAt[2], 5*time.Second)
+
+	assert.Equal(t, store.DeliveryFailed, fake.statuses[3], "the last attempt gives up")
+	assert.Nil(t, fake.nextAt[3])
+
+	assert.Len(t, fake.attemptLog, 3)
+	for _, attempt := range fake.attemptLog {
+		require.NotNil(t, attempt.ResponseStatus)
+		if attempt.DeliveryID != 1 {
+			assert.Equal(t, http.StatusInternalServerError, *attempt.ResponseStatus)
+			assert.NotNil(t, attempt.Error)
+		}
+		if attempt.DeliveryID == 2 {
+			require.NotNil(t, attempt.ResponseBody)
+			assert.Equal(t, "boom\n", *attempt.ResponseBody)
+		} else {
+			assert.Nil(t, attempt.ResponseBody, "bodies are only kept for admin webhooks")
+		}
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	hit := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"loopback", receiver.URL},
+		{"IPv6 loopback", "http://[::1]:9/"},
+		{"private", "http://10.0.0.1:9/"},
+		{"link-local", "http://169.254.169.254/"},
+		{"unspecified", "http://0.0.0.0:9/"},
+		{"shared address space", "http://100.64.0.1:9/"},
+		{"top of shared address space", "http://100.127.255.254:9/"},
+		{"IPv4-mapped private", "http://[::ffff:10.0.0.1]:9/"},
+		{"IPv4-mapped shared address space", "http://[::ffff:100.64.0.1]:9/"},
+		{"NAT64 private", "http://[64:ff9b::a00:1]:9/"},
+		{"NAT64 loopback", "http://[64:ff9b::7f00:1]:9/"},
+		{"NAT64 metadata", "http://[64:ff9b::a9fe:a9fe]:9/"},
+		{"NAT64 shared address space", "http://[64:ff9b::6440:1]:9/"},
+		{"local-use NAT64", "http://[64:ff9b:1::808:808]:9/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Send(context.Background(), NewClient(), pendingDelivery(1, tt.url, 0), time.Now())
+			assert.ErrorIs(t, result.Err, ErrPrivateAddress)
+		})
+	}
+	assert.False(t, hit)
+}
+
+func TestCheckAddressAllowsPublicAddresses(t *testing.T) {
+	for _, address := range []string{
+		"93.184.216.34:443",
+		"100.63.255.255:443",
+		"100.128.0.1:443",
+		"[2606:2800:220:1::1]:443",
+		"[::ffff:93.184.216.34]:443",
+		"[64:ff9b::5db8:d822]:443",
+	} {
+		assert.NoError(t, checkAddress("tcp", address, nil), address)
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	followed := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	client := NewClient()
+	client.Transport = receiver.Client().Transport
+	result := Send(context.Background(), client, pendingDelivery(1, receiver.URL, 0), time.Now())
+
+	assert.False(t, result.OK())
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	assert.False(t, followed)
+}
+
+func TestValidURL(t *testing.T) {
+	assert.True(t, ValidURL("https://dashboards.example.com/hooks"))
+	assert.False(t, ValidURL("http://dashboards.example.com/hooks"), "plain http")
+	assert.False(t, ValidURL("ftp://dashboards.example.com/hooks"))
+	assert.False(t, ValidURL("https:///hooks"))
+	assert.False(t, ValidURL("/hooks"))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, MaxBackoff, Backoff(20))
+}
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+-- actor_id and target_id deliberately have no foreign keys: events must
+-- outlive the users and workouts they describe.
+CREATE TABLE IF NOT EXISTS audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  actor_id BIGINT,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id BIGINT,
+  ip TEXT,
+  user_agent TEXT,
+  request_id TEXT,
+  changes JSONB,
+  metadata JSONB,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER audit_events_no_update_delete
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION audit_events_append_only();
+-- +goose StatementEnd
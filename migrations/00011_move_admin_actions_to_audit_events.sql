@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO audit_events (actor_id, action, target_type, target_id, metadata, created_at)
+SELECT admin_id, 'admin.' || action, target_type, target_id, details, created_at
+FROM admin_actions
+ORDER BY id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE admin_actions;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS admin_actions (
+  id BIGSERIAL PRIMARY KEY,
+  admin_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id BIGINT,
+  details JSONB,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS coach_links (
+  id BIGSERIAL PRIMARY KEY,
+  coach_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  athlete_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  invited_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active')),
+  can_view_history BOOLEAN NOT NULL DEFAULT TRUE,
+  can_assign_workouts BOOLEAN NOT NULL DEFAULT FALSE,
+  can_comment BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  accepted_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (coach_id, athlete_id),
+  CHECK (coach_id <> athlete_id),
+  CHECK (invited_by IN (coach_id, athlete_id))
+);
+
+CREATE INDEX IF NOT EXISTS idx_coach_links_athlete_id ON coach_links(athlete_id);
+
+-- Workouts a coach planned for an athlete remember who assigned them
+ALTER TABLE workouts ADD COLUMN assigned_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN assigned_by;
+DROP TABLE coach_links;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_grants (
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (workout_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS workout_comments (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL CHECK (char_length(body) BETWEEN 1 AND 2000),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_comments_workout_id ON workout_comments(workout_id, created_at);
+
+CREATE TABLE IF NOT EXISTS workout_reactions (
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  reaction TEXT NOT NULL CHECK (reaction IN ('like', 'fire', 'strong', 'clap')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (workout_id, user_id, reaction)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_reactions;
+DROP TABLE workout_comments;
+DROP TABLE workout_grants;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries RENAME COLUMN weight TO weight_kg;
+ALTER TABLE workout_entries ALTER COLUMN weight_kg TYPE DECIMAL(8, 3);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS unit_system VARCHAR(10) NOT NULL DEFAULT 'metric'
+  CHECK (unit_system IN ('metric', 'imperial'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN unit_system;
+
+-- Keep the wider type: weights of 1000 or more don't fit in DECIMAL(5, 2)
+ALTER TABLE workout_entries RENAME COLUMN weight_kg TO weight;
+-- +goose StatementEnd
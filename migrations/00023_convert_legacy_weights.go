@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/LikhithMar14/workout-tracker/internal/units"
+	"github.com/pressly/goose/v3"
+)
+
+// LegacyWeightUnit is the unit weights logged before units were tracked
+// are assumed to be in. Set it before migrating; weights in pounds are
+// converted to kilograms and their owners keep seeing pounds.
+var LegacyWeightUnit = units.Kilograms
+
+func init() {
+	goose.AddMigrationContext(upConvertLegacyWeights, downConvertLegacyWeights)
+}
+
+func upConvertLegacyWeights(ctx context.Context, tx *sql.Tx) error {
+	switch LegacyWeightUnit {
+	case units.Kilograms:
+		return nil
+	case units.Pounds:
+		return convertLegacyWeights(ctx, tx, units.KilogramsPerPound, units.Imperial)
+	}
+	return fmt.Errorf("legacy weight unit must be %s or %s, not %q", units.Kilograms, units.Pounds, LegacyWeightUnit)
+}
+
+func downConvertLegacyWeights(ctx context.Context, tx *sql.Tx) error {
+	if LegacyWeightUnit != units.Pounds {
+		return nil
+	}
+	return convertLegacyWeights(ctx, tx, 1/units.KilogramsPerPound, units.Metric)
+}
+
+func convertLegacyWeights(ctx context.Context, tx *sql.Tx, factor float64, system string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE workout_entries SET weight_kg = weight_kg * $1 WHERE weight_kg IS NOT NULL`, factor)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET unit_system = $1`, system)
+	return err
+}
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+  ADD COLUMN IF NOT EXISTS activity VARCHAR(20),
+  ADD COLUMN IF NOT EXISTS distance_km DECIMAL(9, 3) CHECK (distance_km > 0),
+  ADD COLUMN IF NOT EXISTS elevation_gain_m DECIMAL(7, 1) CHECK (elevation_gain_m >= 0),
+  ADD COLUMN IF NOT EXISTS avg_heart_rate INTEGER CHECK (avg_heart_rate BETWEEN 20 AND 250),
+  ADD COLUMN IF NOT EXISTS max_heart_rate INTEGER CHECK (max_heart_rate BETWEEN 20 AND 250),
+  ADD CONSTRAINT timed_distance CHECK (distance_km IS NULL OR duration_seconds IS NOT NULL);
+
+CREATE TABLE IF NOT EXISTS workout_entry_splits (
+  entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+  split_index INTEGER NOT NULL,
+  distance_km DECIMAL(9, 3) NOT NULL CHECK (distance_km > 0),
+  duration_seconds INTEGER NOT NULL CHECK (duration_seconds > 0),
+  elevation_gain_m DECIMAL(7, 1) CHECK (elevation_gain_m >= 0),
+  avg_heart_rate INTEGER CHECK (avg_heart_rate BETWEEN 20 AND 250),
+  PRIMARY KEY (entry_id, split_index)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_entry_splits;
+
+ALTER TABLE workout_entries
+  DROP CONSTRAINT timed_distance,
+  DROP COLUMN max_heart_rate,
+  DROP COLUMN avg_heart_rate,
+  DROP COLUMN elevation_gain_m,
+  DROP COLUMN distance_km,
+  DROP COLUMN activity;
+-- +goose StatementEnd
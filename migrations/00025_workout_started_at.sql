@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workouts_user_id_started_at ON workouts(user_id, started_at) WHERE started_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_id_started_at;
+ALTER TABLE workouts DROP COLUMN started_at;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Written with COPY, so there are no indexes beyond the primary key
+CREATE TABLE IF NOT EXISTS workout_samples (
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  offset_ms INTEGER NOT NULL CHECK (offset_ms >= 0),
+  heart_rate SMALLINT CHECK (heart_rate BETWEEN 20 AND 250),
+  power SMALLINT CHECK (power >= 0),
+  cadence SMALLINT CHECK (cadence >= 0),
+  PRIMARY KEY (workout_id, offset_ms)
+);
+
+ALTER TABLE workouts
+  ADD COLUMN IF NOT EXISTS avg_heart_rate INTEGER,
+  ADD COLUMN IF NOT EXISTS max_heart_rate INTEGER,
+  ADD COLUMN IF NOT EXISTS hr_zone_seconds INTEGER[],
+  ADD COLUMN IF NOT EXISTS trimp DECIMAL(7, 1);
+
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS max_heart_rate INTEGER CHECK (max_heart_rate BETWEEN 100 AND 250),
+  ADD COLUMN IF NOT EXISTS resting_heart_rate INTEGER CHECK (resting_heart_rate BETWEEN 20 AND 120);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN resting_heart_rate, DROP COLUMN max_heart_rate;
+ALTER TABLE workouts DROP COLUMN trimp, DROP COLUMN hr_zone_seconds, DROP COLUMN max_heart_rate, DROP COLUMN avg_heart_rate;
+DROP TABLE workout_samples;
+-- +goose StatementEnd
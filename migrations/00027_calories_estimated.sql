@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS calories_estimated BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN calories_estimated;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries ADD COLUMN IF NOT EXISTS rpe DECIMAL(3, 1) CHECK (rpe BETWEEN 1 AND 10);
+
+-- The load model's state at the end of each UTC day, from the user's first
+-- workout on. Rows from the day of a saved or deleted workout onwards are
+-- removed in the same transaction, so the rows left are always up to date.
+CREATE TABLE IF NOT EXISTS training_load_days (
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  day DATE NOT NULL,
+  load DOUBLE PRECISION NOT NULL,
+  acute DOUBLE PRECISION NOT NULL,
+  chronic DOUBLE PRECISION NOT NULL,
+  fitness DOUBLE PRECISION NOT NULL,
+  fatigue DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY (user_id, day)
+);
+
+-- Bumped whenever rows are removed, so that rows computed before then
+-- aren't saved
+CREATE TABLE IF NOT EXISTS training_load_versions (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  version BIGINT NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE training_load_versions;
+DROP TABLE training_load_days;
+ALTER TABLE workout_entries DROP COLUMN rpe;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- exercise_name is stored lowercased, matching entries whatever their case
+CREATE TABLE IF NOT EXISTS progression_settings (
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  exercise_name VARCHAR(255) NOT NULL,
+  scheme VARCHAR(20) NOT NULL,
+  increment_kg DECIMAL(6, 3) NOT NULL CHECK (increment_kg > 0),
+  min_reps INTEGER NOT NULL CHECK (min_reps > 0),
+  max_reps INTEGER NOT NULL,
+  target_rpe DECIMAL(3, 1) NOT NULL CHECK (target_rpe BETWEEN 1 AND 10),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, exercise_name),
+  CONSTRAINT valid_rep_range CHECK (max_reps >= min_reps)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_lower_exercise_name ON workout_entries(lower(exercise_name));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workout_entries_lower_exercise_name;
+DROP TABLE progression_settings;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Follows start out as requests the followee has to approve. Follows made
+-- before approvals existed stay in place.
+ALTER TABLE follows ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE follows SET approved_at = created_at WHERE approved_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM follows WHERE approved_at IS NULL;
+ALTER TABLE follows DROP COLUMN approved_at;
+-- +goose StatementEnd
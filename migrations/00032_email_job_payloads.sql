@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Email jobs used to carry the rendered token in their payload. They now
+-- only name the user and the token's scope, so drop the old ones rather
+-- than keep plaintext tokens around; users can ask for a new email.
+DELETE FROM jobs WHERE type = 'email.send' AND payload->'data' IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The deleted jobs can't be brought back.
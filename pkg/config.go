@@ -8,4 +8,27 @@ type Config struct {
     DBPort     int
     DBSSLMode  string
     ServerPort int
+
+    JWTSecret  string
+    JWTKeysDir string
+
+    SMTPHost     string
+    SMTPPort     int
+    SMTPUsername string
+    SMTPPassword string
+    SMTPSender   string
+    MailDir      string
+
+    OIDCConfigFile string
+
+    PasswordMinLength int
+    BcryptCost        int
+
+    TrainingGapDays int
+
+    WebhookWorkers int
+
+    JobWorkers int
+
+    LegacyWeightUnit string
 }